@@ -0,0 +1,275 @@
+// Command authctl manages users, sessions and signing keys directly in the
+// storage configured in config.yml, for operators without access to the
+// admin API.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/term"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/application"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const usage = `usage: authctl [-v] <command> [arguments]
+
+commands:
+  user add [-role user|domain_admin|admin] <login>
+                                        create a user, prompting for the password
+  user passwd [-generate] <login>       set a password and sign the user out everywhere
+  user lock <login>                     disable a user and sign it out everywhere
+  user unlock <login>                   enable a disabled user and lift a login lockout
+  user delete <login>                   delete a user
+  user list [-prefix p] [-domain d] [-offset n] [-limit n]
+                                        list users ordered by login
+  sessions list <login>                 list the signed-in devices of a user
+  sessions revoke <login> [session-id]  revoke the tokens of one or all sessions
+  hash                                  print the hash of a password in the current format
+  rotate-keys                           generate a new active signing key in signing.keys_dir
+
+Passwords are prompted for on a terminal and read from the first line of
+standard input otherwise.
+`
+
+var errUsage = errors.New("invalid arguments")
+
+func main() {
+	flags := flag.NewFlagSet("authctl", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	verbose := flags.Bool("v", false, "log storage and service messages")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	log := zap.NewNop()
+	if *verbose {
+		log, _ = zap.NewDevelopment()
+	}
+
+	err := run(context.Background(), log, flags.Args())
+	if errors.Is(err, errUsage) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "authctl: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, log *zap.Logger, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "rotate-keys":
+		kid, err := application.RotateSigningKey()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("new signing key: %s\n", kid)
+		return nil
+	case "user", "sessions", "hash":
+	default:
+		return errUsage
+	}
+
+	admin, err := application.OpenAdmin(ctx, log)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	switch args[0] {
+	case "user":
+		return runUser(ctx, admin, args[1:])
+	case "sessions":
+		return runSessions(ctx, admin, args[1:])
+	default:
+		password, err := readPassword("Password: ")
+		if err != nil {
+			return err
+		}
+		hash, err := admin.HashPassword(password)
+		if err != nil {
+			return err
+		}
+		fmt.Println(hash)
+		return nil
+	}
+}
+
+func runUser(ctx context.Context, admin *application.Admin, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	flags := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	flags.Usage = func() {}
+	role := flags.String("role", models.RoleUser, "")
+	generate := flags.Bool("generate", false, "")
+	prefix := flags.String("prefix", "", "")
+	domain := flags.String("domain", "", "")
+	offset := flags.Int("offset", 0, "")
+	limit := flags.Int("limit", 0, "")
+	if err := flags.Parse(args[1:]); err != nil {
+		return errUsage
+	}
+
+	if args[0] == "list" {
+		if flags.NArg() != 0 {
+			return errUsage
+		}
+		users, total, err := admin.ListUsers(ctx, application.Operator, models.UserFilter{LoginPrefix: *prefix, Domain: *domain, Offset: *offset, Limit: *limit})
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "LOGIN\tDOMAIN\tROLE\tSTATUS")
+		for _, user := range users {
+			status := "active"
+			if user.Disabled {
+				status = "locked"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.Login, user.Domain, user.Role, status)
+		}
+		w.Flush()
+		fmt.Printf("%d of %d users\n", len(users), total)
+		return nil
+	}
+
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	login := flags.Arg(0)
+	if err := requireWritable(admin); err != nil {
+		return err
+	}
+	switch args[0] {
+	case "add":
+		password, err := readPassword("Password: ")
+		if err != nil {
+			return err
+		}
+		user, err := admin.CreateUser(ctx, application.Operator, login, password, *role)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("user %s created with role %s\n", user.Login, user.Role)
+	case "passwd":
+		password := ""
+		if !*generate {
+			var err error
+			if password, err = readPassword("New password: "); err != nil {
+				return err
+			}
+		}
+		set, err := admin.ResetPassword(ctx, application.Operator, login, password)
+		if err != nil {
+			return err
+		}
+		if *generate {
+			fmt.Printf("new password of %s: %s\n", login, set)
+		} else {
+			fmt.Printf("password of %s changed\n", login)
+		}
+	case "lock", "unlock":
+		disabled := args[0] == "lock"
+		if _, err := admin.UpdateUser(ctx, application.Operator, login, models.UserUpdate{Disabled: &disabled}); err != nil {
+			return err
+		}
+		if !disabled {
+			if err := admin.UnlockLogin(ctx, application.Operator, login); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("user %s %sed\n", login, args[0])
+	case "delete":
+		if err := admin.DeleteUser(ctx, application.Operator, login); err != nil {
+			return err
+		}
+		fmt.Printf("user %s deleted\n", login)
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func runSessions(ctx context.Context, admin *application.Admin, args []string) error {
+	if err := requireSharedSessions(admin); err != nil {
+		return err
+	}
+	switch {
+	case len(args) == 2 && args[0] == "list":
+		sessions, err := admin.Sessions(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tLAST SEEN\tIP\tUSER AGENT")
+		for _, s := range sessions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID,
+				s.CreatedAt.Format(time.RFC3339), s.LastSeenAt.Format(time.RFC3339), s.IP, s.UserAgent)
+		}
+		return w.Flush()
+	case len(args) == 2 && args[0] == "revoke":
+		revoked, err := admin.RevokeSessions(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d sessions of %s revoked\n", revoked, args[1])
+		return nil
+	case len(args) == 3 && args[0] == "revoke":
+		if err := admin.RevokeSession(ctx, args[1], args[2]); err != nil {
+			return err
+		}
+		fmt.Printf("session %s revoked\n", args[2])
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+// requireWritable rejects changes that would only live in this process: the
+// file driver keeps users read-only and the memory driver shares nothing
+// with the running servers.
+func requireWritable(admin *application.Admin) error {
+	if admin.Driver != "postgres" {
+		return fmt.Errorf("storage driver %s cannot be changed from authctl; use 'authctl hash' and edit the users file", admin.Driver)
+	}
+	return nil
+}
+
+// requireSharedSessions rejects session commands unless sessions are in
+// postgres: with the other drivers they live in the memory of each running
+// server, and authctl would only see an empty store of its own.
+func requireSharedSessions(admin *application.Admin) error {
+	if admin.Driver != "postgres" {
+		return fmt.Errorf("sessions of storage driver %s live in the running servers and cannot be listed or revoked from authctl", admin.Driver)
+	}
+	return nil
+}
+
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password failed: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
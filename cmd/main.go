@@ -2,17 +2,84 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/application"
 )
 
+const usage = `usage: main [command]
+
+commands:
+  (none)        start the HTTP and gRPC servers
+  rotate-keys   generate a new active signing key in signing.keys_dir
+  migrate up    apply pending Postgres schema migrations
+  migrate down [n]
+                revert the last n (default 1) applied migrations
+  migrate status
+                list migrations and when they were applied
+`
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 	go application.Start(ctx)
 	<-ctx.Done()
 	application.Stop()
 }
+
+func runCommand(args []string) int {
+	switch args[0] {
+	case "rotate-keys":
+		kid, err := application.RotateSigningKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "key rotation failed: %s\n", err)
+			return 1
+		}
+		fmt.Printf("new signing key: %s\n", kid)
+		return 0
+	case "migrate":
+		return runMigrate(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+func runMigrate(args []string) int {
+	if len(args) == 0 || len(args) > 2 || len(args) == 2 && args[0] != "down" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	steps := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid number of steps %q\n", args[1])
+			return 2
+		}
+		steps = n
+	}
+
+	status, err := application.Migrate(context.Background(), args[0], steps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s failed: %s\n", args[0], err)
+		return 1
+	}
+	for _, m := range status {
+		applied := "pending"
+		if m.AppliedAt != nil {
+			applied = m.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, applied)
+	}
+	return 0
+}
@@ -2,17 +2,137 @@ package data_file
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
 	"go.uber.org/zap"
 )
 
+// reloadDelay lets writers finish saving the users file before it is read,
+// since saving in place produces several events and an empty file between
+// them.
+const reloadDelay = 200 * time.Millisecond
+
+// DataFile serves users from a YAML, JSON or htpasswd file and reloads it
+// whenever it changes. Without a file it serves the single user from the
+// auth section of config.yml.
 type DataFile struct {
+	mu     sync.RWMutex
+	path   string
+	users  map[string]models.User
 	logger *zap.SugaredLogger
+	// reloaded, if set, is told the outcome of every reload by the watcher.
+	reloaded func(error)
+}
+
+func New(ctx context.Context, logger *zap.SugaredLogger, path string) (*DataFile, error) {
+	return newDataFile(ctx, logger, path, nil)
 }
 
-func New(ctx context.Context, logger *zap.SugaredLogger, pgconn string) (*DataFile, error) {
-	return &DataFile{logger}, nil
+func newDataFile(ctx context.Context, logger *zap.SugaredLogger, path string, reloaded func(error)) (*DataFile, error) {
+	db := &DataFile{path: path, logger: logger, reloaded: reloaded}
+	if path == "" {
+		cfg := config.GetConfig(logger)
+		db.users = map[string]models.User{
+			cfg.Auth.Login: {Login: cfg.Auth.Login, PasswordHash: cfg.Auth.PasswordHash, Role: cfg.Auth.Role},
+		}
+		return db, nil
+	}
+
+	if err := db.Reload(); err != nil {
+		logger.Errorf("users file load failed: %s", err.Error())
+		return nil, fmt.Errorf("users file load failed: %s", err.Error())
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Errorf("users file watcher creating failed: %s", err.Error())
+		return nil, fmt.Errorf("users file watcher creating failed: %s", err.Error())
+	}
+	// Editors and config management tools replace files by renaming, so the
+	// directory is watched rather than the file itself.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		logger.Errorf("users file watching failed: %s", err.Error())
+		return nil, fmt.Errorf("users file watching failed: %s", err.Error())
+	}
+	go db.watch(ctx, watcher)
+
+	return db, nil
+}
+
+// Reload rereads the users file. The previous users are kept if the file
+// cannot be parsed or has no users anymore, which is what a file read while
+// it is being written looks like.
+func (db *DataFile) Reload() error {
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	users, err := parseUsers(db.path, data)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(users) == 0 && len(db.users) > 0 {
+		return fmt.Errorf("%s has no users", db.path)
+	}
+	db.users = users
+	return nil
+}
+
+// watch reloads the users file once it has not changed for reloadDelay.
+func (db *DataFile) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	name := filepath.Clean(db.path)
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			db.logger.Errorf("users file watcher failed: %s", err.Error())
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != name || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(reloadDelay)
+		case <-timer.C:
+			err := db.Reload()
+			switch {
+			case err == nil:
+				db.logger.Infof("users file %s reloaded", db.path)
+			case !os.IsNotExist(err):
+				db.logger.Errorf("users file reload failed, keeping previous users: %s", err.Error())
+			}
+			if db.reloaded != nil {
+				db.reloaded(err)
+			}
+		}
+	}
 }
 
 func (db *DataFile) annotatedLogger(ctx context.Context) *zap.SugaredLogger {
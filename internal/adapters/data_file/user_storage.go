@@ -2,17 +2,100 @@ package data_file
 
 import (
 	"context"
+	"sort"
+	"strings"
 
-	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
 )
 
+var _ ports.UserStorage = (*DataFile)(nil)
+
 func (db *DataFile) Get(ctx context.Context, login string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[login]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (db *DataFile) GetByAddress(ctx context.Context, address string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, user := range db.users {
+		for _, a := range user.Addresses() {
+			if a == address {
+				return &user, nil
+			}
+		}
+	}
+	return nil, errors.ErrNotFound
+}
+
+func (db *DataFile) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users := db.filterUsers(filter)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Login < users[j].Login
+	})
+
+	if filter.Offset > len(users) {
+		filter.Offset = len(users)
+	}
+	users = users[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(users) {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (db *DataFile) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.filterUsers(filter)), nil
+}
+
+func (db *DataFile) filterUsers(filter models.UserFilter) []models.User {
+	users := []models.User{}
+	for login, user := range db.users {
+		if strings.HasPrefix(login, filter.LoginPrefix) && (filter.Domain == "" || user.Domain == filter.Domain) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (db *DataFile) Create(ctx context.Context, user *models.User) error {
+	return errors.ErrReadOnly
+}
+
+// Update changes the in-memory copy only; the file is not rewritten, so the
+// change is lost on the next reload or restart.
+func (db *DataFile) Update(ctx context.Context, user *models.User) error {
 	logger := db.annotatedLogger(ctx)
 
-	user := &models.User{
-		Login:        config.GetConfig(logger).Auth.Login,
-		PasswordHash: config.GetConfig(logger).Auth.PasswordHash,
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[user.Login]; !ok {
+		return errors.ErrNotFound
 	}
-	return user, nil
+	if _, _, ok := addressOwner(db.users, user); ok {
+		return errors.ErrAlreadyExists
+	}
+	db.users[user.Login] = *user
+	logger.Warnf("user %s updated in memory only", user.Login)
+	return nil
+}
+
+func (db *DataFile) Delete(ctx context.Context, login string) error {
+	return errors.ErrReadOnly
 }
@@ -0,0 +1,150 @@
+package data_file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.UserStorage(t, func(t *testing.T, users ...models.User) ports.UserStorage {
+		var file usersFile
+		for _, user := range users {
+			file.Users = append(file.Users, usersFileEntry{
+				Login: user.Login, Address: user.Address, Aliases: user.Aliases, DisplayName: user.DisplayName,
+				PasswordHash: user.PasswordHash, Role: user.Role, Disabled: user.Disabled,
+			})
+		}
+		data, _ := json.Marshal(file)
+		path := filepath.Join(t.TempDir(), "users.json")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		db, err := New(ctx, zap.NewNop().Sugar(), path)
+		if err != nil {
+			t.Fatalf("open failed: %s", err)
+		}
+		return db
+	})
+}
+
+func TestParseUsers(t *testing.T) {
+	cases := []struct {
+		name  string
+		file  string
+		data  string
+		valid bool
+	}{
+		{name: "yaml", file: "users.yml", data: "users:\n  - login: alice\n    password_hash: h1\n  - login: bob\n    password_hash: h2\n", valid: true},
+		{name: "json", file: "users.json", data: `{"users": [{"login": "alice", "password_hash": "h1"}, {"login": "bob", "password_hash": "h2"}]}`, valid: true},
+		{name: "htpasswd", file: "users", data: "# staging\nalice:h1\n\nbob:h2\n", valid: true},
+		{name: "duplicate", file: "users", data: "alice:h1\nalice:h2\n"},
+		{name: "no hash", file: "users.yml", data: "users:\n  - login: alice\n"},
+		{name: "malformed line", file: "users", data: "alice\n"},
+		{name: "invalid address", file: "users.yml", data: "users:\n  - login: alice\n    password_hash: h1\n    address: alice\n"},
+		{name: "shared address", file: "users.yml", data: "users:\n  - login: alice\n    password_hash: h1\n    address: a@example.com\n  - login: bob\n    password_hash: h2\n    aliases: [A@Example.com]\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			users, err := parseUsers(c.file, []byte(c.data))
+			if !c.valid {
+				if err == nil {
+					t.Fatalf("Expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse failed: %s", err)
+			}
+			if len(users) != 2 || users["alice"].PasswordHash != "h1" || users["bob"].PasswordHash != "h2" {
+				t.Fatalf("Unexpected users %v", users)
+			}
+		})
+	}
+}
+
+func TestParseUsersAddresses(t *testing.T) {
+	data := "users:\n  - login: alice\n    password_hash: h1\n    address: Alice@Bücher.Example\n    aliases: [Info@Example.COM]\n"
+	users, err := parseUsers("users.yml", []byte(data))
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+	alice := users["alice"]
+	if alice.Address != "alice@xn--bcher-kva.example" || alice.Domain != "xn--bcher-kva.example" || len(alice.Aliases) != 1 || alice.Aliases[0] != "info@example.com" {
+		t.Fatalf("Expected normalized addresses, but was %+v", alice)
+	}
+}
+
+func TestDataFileReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte("alice:h1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	reloads := make(chan error, 16)
+	db, err := newDataFile(ctx, zap.NewNop().Sugar(), path, func(err error) { reloads <- err })
+	if err != nil {
+		t.Fatalf("open failed: %s", err)
+	}
+	if user, err := db.Get(ctx, "alice"); err != nil || user.PasswordHash != "h1" {
+		t.Fatalf("Expected alice, but was %v, %v", user, err)
+	}
+	if _, err := db.Get(ctx, "bob"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	// waitReload returns the outcome of the next reload.
+	waitReload := func() error {
+		t.Helper()
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Expected the users file to be reloaded")
+			return nil
+		}
+	}
+
+	// Replace the file the way editors do.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("alice:h1\nbob:h2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitReload(); err != nil {
+		t.Fatalf("reload failed: %s", err)
+	}
+	if _, err := db.Get(ctx, "bob"); err != nil {
+		t.Fatalf("Expected bob to appear after reload, but was %v", err)
+	}
+
+	// A broken or emptied file keeps the users loaded before.
+	for _, data := range []string{"broken\n", ""} {
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := waitReload(); err == nil {
+			t.Fatalf("Expected reload of %q to fail", data)
+		}
+		if _, err := db.Get(ctx, "bob"); err != nil {
+			t.Fatalf("Expected previous users to be kept, but was %v", err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package data_file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/mailaddr"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gopkg.in/yaml.v3"
+)
+
+type usersFile struct {
+	Users []usersFileEntry `yaml:"users" json:"users"`
+}
+
+type usersFileEntry struct {
+	Login        string   `yaml:"login" json:"login"`
+	Address      string   `yaml:"address" json:"address"`
+	Aliases      []string `yaml:"aliases" json:"aliases"`
+	DisplayName  string   `yaml:"display_name" json:"display_name"`
+	PasswordHash string   `yaml:"password_hash" json:"password_hash"`
+	SCRAMSHA256  string   `yaml:"scram_sha256" json:"scram_sha256"`
+	Role         string   `yaml:"role" json:"role"`
+	Disabled     bool     `yaml:"disabled" json:"disabled"`
+}
+
+// parseUsers decodes a users file; the format is chosen by extension:
+// .yml/.yaml and .json hold a users list, anything else is read as
+// htpasswd-style "login:hash" lines of users with the default role.
+func parseUsers(path string, data []byte) (map[string]models.User, error) {
+	var file usersFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return parseHtpasswd(path, data)
+	}
+
+	users := map[string]models.User{}
+	for i, u := range file.Users {
+		user := models.User{Login: u.Login, DisplayName: u.DisplayName, PasswordHash: u.PasswordHash, SCRAMSHA256: u.SCRAMSHA256, Role: u.Role, Disabled: u.Disabled}
+		err := setAddresses(&user, u.Address, u.Aliases)
+		if err == nil {
+			err = addUser(users, user)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: user %d: %w", path, i+1, err)
+		}
+	}
+	return users, nil
+}
+
+// setAddresses normalizes the addresses of a users file entry, which may be
+// written in any case or with a Unicode domain.
+func setAddresses(user *models.User, address string, aliases []string) error {
+	if address != "" {
+		normalized, err := mailaddr.Normalize(address)
+		if err != nil {
+			return err
+		}
+		user.Address, user.Domain = normalized, mailaddr.Domain(normalized)
+	}
+	for _, alias := range aliases {
+		normalized, err := mailaddr.Normalize(alias)
+		if err != nil {
+			return err
+		}
+		user.Aliases = append(user.Aliases, normalized)
+	}
+	return nil
+}
+
+func parseHtpasswd(path string, data []byte) (map[string]models.User, error) {
+	users := map[string]models.User{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		login, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected login:hash", path, n)
+		}
+		if err := addUser(users, models.User{Login: login, PasswordHash: hash}); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	return users, scanner.Err()
+}
+
+func addUser(users map[string]models.User, user models.User) error {
+	if user.Login == "" || user.PasswordHash == "" {
+		return fmt.Errorf("login and password hash are required")
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	if _, ok := users[user.Login]; ok {
+		return fmt.Errorf("duplicate login %s", user.Login)
+	}
+	if address, owner, ok := addressOwner(users, &user); ok {
+		return fmt.Errorf("address %s of %s is also used by %s", address, user.Login, owner)
+	}
+	users[user.Login] = user
+	return nil
+}
+
+// addressOwner finds another user with the address or one of the aliases of
+// user.
+func addressOwner(users map[string]models.User, user *models.User) (address, owner string, ok bool) {
+	for login, other := range users {
+		if login == user.Login {
+			continue
+		}
+		for _, address := range other.Addresses() {
+			for _, own := range user.Addresses() {
+				if own == address {
+					return own, login, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
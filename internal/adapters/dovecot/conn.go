@@ -0,0 +1,319 @@
+package dovecot
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/sasl"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+const (
+	// requestTTL bounds the wait for the CONT of a request.
+	requestTTL = time.Minute
+	// maxPendingRequests limits the requests of a connection, as clients
+	// may start requests and never continue them.
+	maxPendingRequests = 32
+)
+
+// request is an AUTH exchange in progress.
+type request struct {
+	ctx     context.Context
+	id      string
+	service string
+	mech    sasl.Mechanism
+	// waiting is set while a challenge awaits the client's CONT, until
+	// expires.
+	waiting bool
+	expires time.Time
+}
+
+// connection is one auth client. Requests are multiplexed by id and
+// answered as their authentication finishes, not in order.
+type connection struct {
+	s    *Server
+	conn net.Conn
+	mu   sync.Mutex
+	w    *bufio.Writer
+	// pendingMu guards pending, which steps running in the background
+	// update as they finish.
+	pendingMu sync.Mutex
+	pending   map[string]*request
+	running   sync.WaitGroup
+}
+
+func (s *Server) serve(conn net.Conn) {
+	c := &connection{s: s, conn: conn, w: bufio.NewWriter(conn), pending: map[string]*request{}}
+	defer c.running.Wait()
+
+	if err := c.handshake(); err != nil {
+		s.logger.Errorf("dovecot handshake failed: %s", err)
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxLineLength)
+	versionSeen := false
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch fields[0] {
+		case "VERSION":
+			if len(fields) < 2 || fields[1] != strconv.Itoa(versionMajor) {
+				s.logger.Errorf("dovecot client speaks unsupported protocol version %v", fields[1:])
+				return
+			}
+			versionSeen = true
+		case "CPID":
+		case "AUTH":
+			if !versionSeen {
+				s.logger.Errorf("dovecot client sent AUTH before VERSION")
+				return
+			}
+			c.auth(fields[1:])
+		case "CONT":
+			c.cont(fields[1:])
+		default:
+			s.logger.Errorf("dovecot client sent unknown command %q", fields[0])
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && !s.isClosing() {
+		s.logger.Errorf("dovecot connection read failed: %s", err)
+	}
+}
+
+// handshake announces the protocol version and the mechanisms.
+func (c *connection) handshake() error {
+	lines := [][]byte{line("VERSION", strconv.Itoa(versionMajor), strconv.Itoa(versionMinor))}
+	for _, info := range sasl.Mechanisms {
+		fields := []string{"MECH", info.Name}
+		if info.Plaintext {
+			fields = append(fields, "plaintext")
+		}
+		if info.MutualAuth {
+			fields = append(fields, "mutual-auth")
+		}
+		lines = append(lines, line(fields...))
+	}
+	lines = append(lines,
+		line("SPID", strconv.Itoa(os.Getpid())),
+		line("CUID", strconv.FormatUint(c.s.connectionID(), 10)),
+		line("COOKIE", c.s.cookie),
+		line("DONE"),
+	)
+	return c.write(lines...)
+}
+
+func (c *connection) write(lines ...[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range lines {
+		if _, err := c.w.Write(l); err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
+
+// auth starts a request: AUTH <id> <mechanism> [<parameter>...].
+func (c *connection) auth(fields []string) {
+	if len(fields) < 2 {
+		c.s.logger.Errorf("dovecot AUTH without id or mechanism")
+		return
+	}
+	id, name := fields[0], strings.ToUpper(fields[1])
+	params, err := parseAuthParams(fields[2:])
+	if err != nil {
+		c.fail(context.Background(), id, "", fmt.Errorf("invalid AUTH parameters: %s", err))
+		return
+	}
+	ctx := context.WithValue(context.Background(), utils.CtxKeyRequestIDGet(), uuid.NewString())
+	ctx = context.WithValue(ctx, utils.CtxKeyMethodGet(), "dovecot")
+	ctx = context.WithValue(ctx, utils.CtxKeyURLGet(), params["service"]+"/"+name)
+	ctx = context.WithValue(ctx, utils.CtxKeyRemoteIPGet(), params["rip"])
+
+	if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+		c.fail(ctx, id, "", fmt.Errorf("invalid request id %q", id))
+		return
+	}
+	if params["service"] == "" {
+		c.fail(ctx, id, "", fmt.Errorf("AUTH without service"))
+		return
+	}
+	mech, err := sasl.New(name, c.s.auth, protocol(params["service"]))
+	if err != nil {
+		c.fail(ctx, id, "Unsupported authentication mechanism", err)
+		return
+	}
+	var response []byte
+	if resp, ok := params["resp"]; ok {
+		if response, err = base64.StdEncoding.DecodeString(resp); err != nil {
+			c.fail(ctx, id, "", fmt.Errorf("invalid initial response: %s", err))
+			return
+		}
+	}
+	req := &request{ctx: ctx, id: id, service: params["service"], mech: mech}
+
+	for _, expired := range c.expire(time.Now()) {
+		c.fail(expired.ctx, expired.id, "", fmt.Errorf("request %s expired", expired.id))
+	}
+	c.pendingMu.Lock()
+	_, inUse := c.pending[id]
+	full := len(c.pending) >= maxPendingRequests
+	if !inUse && !full {
+		c.pending[id] = req
+	}
+	c.pendingMu.Unlock()
+	if inUse {
+		c.fail(ctx, id, "", fmt.Errorf("request id %s is in use", id))
+		return
+	}
+	if full {
+		c.fail(ctx, id, "Too many pending requests", fmt.Errorf("%d requests pending", maxPendingRequests))
+		return
+	}
+	c.step(req, response)
+}
+
+// expire forgets the requests whose CONT has not come by now and returns
+// them.
+func (c *connection) expire(now time.Time) []*request {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	var expired []*request
+	for id, req := range c.pending {
+		if req.waiting && now.After(req.expires) {
+			delete(c.pending, id)
+			expired = append(expired, req)
+		}
+	}
+	return expired
+}
+
+// cont continues a request: CONT <id> <base64 response>.
+func (c *connection) cont(fields []string) {
+	if len(fields) < 2 {
+		c.s.logger.Errorf("dovecot CONT without id or response")
+		return
+	}
+	c.pendingMu.Lock()
+	req, ok := c.pending[fields[0]]
+	waiting := ok && req.waiting
+	expired := waiting && time.Now().After(req.expires)
+	if expired {
+		delete(c.pending, req.id)
+	} else if waiting {
+		req.waiting = false
+	}
+	c.pendingMu.Unlock()
+	if expired {
+		c.fail(req.ctx, req.id, "", fmt.Errorf("request %s expired", req.id))
+		return
+	}
+	if !waiting {
+		c.fail(context.Background(), fields[0], "", fmt.Errorf("CONT for unknown or busy request %s", fields[0]))
+		return
+	}
+	response, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		c.finish(req)
+		c.fail(req.ctx, req.id, "", fmt.Errorf("invalid response: %s", err))
+		return
+	}
+	c.step(req, response)
+}
+
+// step runs the mechanism in the background, as it may check credentials,
+// and answers with the next challenge or the result.
+func (c *connection) step(req *request, response []byte) {
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+
+		challenge, user, err := req.mech.Next(req.ctx, response)
+		if err == nil && user == nil {
+			c.pendingMu.Lock()
+			req.waiting, req.expires = true, time.Now().Add(requestTTL)
+			c.pendingMu.Unlock()
+			_ = c.write(line("CONT", req.id, base64.StdEncoding.EncodeToString(challenge)))
+			return
+		}
+		c.finish(req)
+		c.result(req, challenge, user, err)
+	}()
+}
+
+func (c *connection) finish(req *request) {
+	c.pendingMu.Lock()
+	delete(c.pending, req.id)
+	c.pendingMu.Unlock()
+}
+
+// result answers a finished request. Additional success data, such as the
+// SCRAM server signature, is sent as resp.
+func (c *connection) result(req *request, data []byte, user *models.User, err error) {
+	logger := c.s.annotatedLogger(req.ctx)
+
+	if errors.Is(err, domainerrors.ErrMalformed) {
+		c.fail(req.ctx, req.id, "", err)
+		return
+	}
+	login := req.mech.Login()
+	if err != nil {
+		reason := ""
+		switch {
+		case errors.Is(err, domainerrors.ErrTooManyLogins):
+			reason = "Too many failed logins, try again later"
+		case errors.Is(err, domainerrors.ErrForbidden):
+			reason = "App password is not valid for " + req.service
+		}
+		fields := []string{"FAIL", req.id, "user=" + escape(login)}
+		if reason != "" {
+			fields = append(fields, "reason="+escape(reason))
+		}
+		if errors.Is(err, domainerrors.ErrUserDisabled) {
+			fields = append(fields, "user_disabled")
+		}
+		logger.Errorf("dovecot %s login of %s failed: %s", req.service, login, err.Error())
+		_ = c.write(line(fields...))
+		return
+	}
+	logger.Infof("dovecot %s login of %s succeeded", req.service, user.Login)
+	fields := []string{"OK", req.id, "user=" + escape(user.Login)}
+	if len(data) > 0 {
+		fields = append(fields, "resp="+base64.StdEncoding.EncodeToString(data))
+	}
+	_ = c.write(line(fields...))
+}
+
+// fail answers a request that never reached the password check.
+func (c *connection) fail(ctx context.Context, id, reason string, err error) {
+	c.s.annotatedLogger(ctx).Errorf("dovecot request %s failed: %s", id, err.Error())
+	fields := []string{"FAIL", escape(id)}
+	if reason != "" {
+		fields = append(fields, "reason="+escape(reason))
+	}
+	_ = c.write(line(fields...))
+}
+
+// protocol maps a Dovecot service name to an app password scope.
+func protocol(service string) string {
+	service = strings.ToLower(service)
+	if service == "submission" {
+		return models.ProtocolSMTP
+	}
+	return service
+}
@@ -0,0 +1,86 @@
+package dovecot
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Protocol version spoken by this server, see
+// https://doc.dovecot.org/developer_manual/design/auth_protocol/.
+const (
+	versionMajor = 1
+	versionMinor = 2
+	// maxLineLength bounds a request line; AUTH lines carry client
+	// certificates at most.
+	maxLineLength = 64 * 1024
+)
+
+// escape applies the Dovecot tab escaping to a parameter value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		"\x01", "\x011",
+		"\x00", "\x010",
+		"\t", "\x01t",
+		"\r", "\x01r",
+		"\n", "\x01n",
+	).Replace(s)
+}
+
+// unescape reverses escape.
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, "\x01") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\x01' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("escape at end of value")
+		}
+		switch s[i] {
+		case '1':
+			b.WriteByte('\x01')
+		case '0':
+			b.WriteByte('\x00')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			return "", fmt.Errorf("invalid escape %q", s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// line formats a response line from already escaped fields.
+func line(fields ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString(strings.Join(fields, "\t"))
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// authParams are the parameters of an AUTH request. Flags such as secured
+// have an empty value.
+type authParams map[string]string
+
+func parseAuthParams(fields []string) (authParams, error) {
+	params := authParams{}
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		value, err := unescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %s", key, err)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
@@ -0,0 +1,216 @@
+package dovecot
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"go.uber.org/zap"
+)
+
+// fakeAuth accepts alice with secret for imap only.
+type fakeAuth struct {
+	ports.Auth
+}
+
+func (fakeAuth) AuthenticatePlain(ctx context.Context, login, password, protocol string) (*models.User, error) {
+	switch {
+	case login == "disabled":
+		return nil, domainerrors.ErrUserDisabled
+	case login != "alice" || password != "secret":
+		return nil, fmt.Errorf("invalid password")
+	case protocol != models.ProtocolIMAP:
+		return nil, domainerrors.ErrForbidden
+	}
+	return &models.User{Login: login}, nil
+}
+
+func dial(t *testing.T) (*bufio.Reader, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	s := newServer(zap.NewNop().Sugar(), fakeAuth{}, l)
+	go s.Start()
+	t.Cleanup(func() { s.Stop(context.Background()) })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	r := bufio.NewReader(conn)
+	var mechs []string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("handshake failed: %s", err)
+		}
+		if strings.HasPrefix(l, "MECH\t") {
+			mechs = append(mechs, strings.Split(strings.TrimSuffix(l, "\n"), "\t")[1])
+		}
+		if l == "DONE\n" {
+			break
+		}
+	}
+	if want := "SCRAM-SHA-256,OAUTHBEARER,XOAUTH2,PLAIN,LOGIN"; strings.Join(mechs, ",") != want {
+		t.Fatalf("Expected %s, but was %v", want, mechs)
+	}
+	fmt.Fprintf(conn, "VERSION\t1\t2\nCPID\t42\n")
+	return r, conn
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestAuth(t *testing.T) {
+	cases := []struct {
+		name string
+		// exchange alternates client lines and expected server lines.
+		exchange []string
+	}{
+		{
+			name: "PLAIN with initial response",
+			exchange: []string{
+				"AUTH\t1\tPLAIN\tservice=imap\tsecured\trip=192.0.2.1\tresp=" + b64("\x00alice\x00secret"),
+				"OK\t1\tuser=alice",
+			},
+		},
+		{
+			name: "PLAIN without initial response",
+			exchange: []string{
+				"AUTH\t2\tPLAIN\tservice=imap",
+				"CONT\t2\t",
+				"CONT\t2\t" + b64("alice\x00alice\x00secret"),
+				"OK\t2\tuser=alice",
+			},
+		},
+		{
+			name: "LOGIN",
+			exchange: []string{
+				"AUTH\t3\tLOGIN\tservice=imap",
+				"CONT\t3\t" + b64("Username:"),
+				"CONT\t3\t" + b64("alice"),
+				"CONT\t3\t" + b64("Password:"),
+				"CONT\t3\t" + b64("secret"),
+				"OK\t3\tuser=alice",
+			},
+		},
+		{
+			name: "wrong password",
+			exchange: []string{
+				"AUTH\t4\tPLAIN\tservice=imap\tresp=" + b64("\x00alice\x00wrong"),
+				"FAIL\t4\tuser=alice",
+			},
+		},
+		{
+			name: "app password out of scope",
+			exchange: []string{
+				"AUTH\t5\tPLAIN\tservice=pop3\tresp=" + b64("\x00alice\x00secret"),
+				"FAIL\t5\tuser=alice\treason=App password is not valid for pop3",
+			},
+		},
+		{
+			name: "disabled user",
+			exchange: []string{
+				"AUTH\t6\tPLAIN\tservice=imap\tresp=" + b64("\x00disabled\x00secret"),
+				"FAIL\t6\tuser=disabled\tuser_disabled",
+			},
+		},
+		{
+			name: "acting as another user",
+			exchange: []string{
+				"AUTH\t7\tPLAIN\tservice=imap\tresp=" + b64("bob\x00alice\x00secret"),
+				"FAIL\t7",
+			},
+		},
+		{
+			name: "unsupported mechanism",
+			exchange: []string{
+				"AUTH\t8\tCRAM-MD5\tservice=imap",
+				"FAIL\t8\treason=Unsupported authentication mechanism",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r, conn := dial(t)
+			defer conn.Close()
+			for i := 0; i < len(c.exchange); i += 2 {
+				fmt.Fprintf(conn, "%s\n", c.exchange[i])
+				got, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatalf("read failed: %s", err)
+				}
+				if want := c.exchange[i+1] + "\n"; got != want {
+					t.Fatalf("Expected %q, but was %q", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPendingRequests(t *testing.T) {
+	r, conn := dial(t)
+	defer conn.Close()
+
+	// Requests left waiting for their CONT fill the connection.
+	for i := 1; i <= maxPendingRequests; i++ {
+		fmt.Fprintf(conn, "AUTH\t%d\tPLAIN\tservice=imap\n", i)
+	}
+	for i := 1; i <= maxPendingRequests; i++ {
+		if got, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(got, "CONT\t") {
+			t.Fatalf("Expected CONT, but was %q, %v", got, err)
+		}
+	}
+	fmt.Fprintf(conn, "AUTH\t100\tPLAIN\tservice=imap\n")
+	if got, _ := r.ReadString('\n'); got != "FAIL\t100\treason=Too many pending requests\n" {
+		t.Fatalf("Expected the request to be refused, but was %q", got)
+	}
+
+	// Finishing one makes room for another.
+	fmt.Fprintf(conn, "CONT\t1\t%s\n", b64("\x00alice\x00secret"))
+	if got, _ := r.ReadString('\n'); got != "OK\t1\tuser=alice\n" {
+		t.Fatalf("Expected OK, but was %q", got)
+	}
+	fmt.Fprintf(conn, "AUTH\t101\tPLAIN\tservice=imap\tresp=%s\n", b64("\x00alice\x00secret"))
+	if got, _ := r.ReadString('\n'); got != "OK\t101\tuser=alice\n" {
+		t.Fatalf("Expected OK, but was %q", got)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+	c := &connection{pending: map[string]*request{
+		"1": {id: "1", waiting: true, expires: now.Add(-time.Second)},
+		"2": {id: "2", waiting: true, expires: now.Add(requestTTL)},
+		"3": {id: "3"},
+	}}
+	if expired := c.expire(now); len(expired) != 1 || expired[0].id != "1" {
+		t.Fatalf("Expected request 1 to expire, but was %v", expired)
+	}
+	if len(c.pending) != 2 || c.pending["1"] != nil {
+		t.Fatalf("Expected requests 2 and 3 to be left, but was %v", c.pending)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	value := "a\tb\nc\rd\x00e\x01f"
+	escaped := escape(value)
+	if strings.ContainsAny(escaped, "\t\n\r\x00") {
+		t.Fatalf("Expected no separators, but was %q", escaped)
+	}
+	if unescaped, err := unescape(escaped); err != nil || unescaped != value {
+		t.Fatalf("Expected %q, but was %q, %v", value, unescaped, err)
+	}
+}
@@ -0,0 +1,47 @@
+package grpc
+
+import (
+	"context"
+	"net"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// AnnotateContext stores request metadata in the context the same way the
+// HTTP adapter does, so domain logs and sessions look alike for both.
+func (s *Server) AnnotateContext() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = context.WithValue(ctx, utils.CtxKeyRequestIDGet(), firstValue(md, "x-request-id"))
+		ctx = context.WithValue(ctx, utils.CtxKeyMethodGet(), "grpc")
+		ctx = context.WithValue(ctx, utils.CtxKeyURLGet(), info.FullMethod)
+		ctx = context.WithValue(ctx, utils.CtxKeyUserAgentGet(), firstValue(md, "user-agent"))
+		ctx = context.WithValue(ctx, utils.CtxKeyRemoteIPGet(), s.remoteIP(ctx, md))
+
+		return handler(ctx, req)
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// remoteIP returns the peer address or, if the peer is a trusted proxy, the
+// client address it reports in x-forwarded-for.
+func (s *Server) remoteIP(ctx context.Context, md metadata.MD) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	return s.proxies.ClientIP(host, md.Get("x-forwarded-for"))
+}
@@ -0,0 +1,52 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RateLimit rejects calls over the configured limits with ResourceExhausted.
+// It runs after AnnotateContext, which stores the client address. The API
+// client is named by x-client-id metadata and the login is read from
+// requests that carry one.
+func (s *Server) RateLimit() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if s.limiter == nil {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		subject := models.RateLimitSubject{Client: firstValue(md, "x-client-id")}
+		subject.IP, _ = ctx.Value(utils.CtxKeyRemoteIPGet()).(string)
+		if r, ok := req.(interface{ GetLogin() string }); ok {
+			subject.Login = r.GetLogin()
+		}
+
+		err := s.limiter.Allow(ctx, info.FullMethod, subject)
+		var limited *domainerrors.RateLimitError
+		if errors.As(err, &limited) {
+			return nil, resourceExhausted(err, limited.RetryAfter)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// resourceExhausted returns err as ResourceExhausted with a RetryInfo detail.
+func resourceExhausted(err error, retryAfter time.Duration) error {
+	st, detailsErr := status.New(codes.ResourceExhausted, err.Error()).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if detailsErr != nil {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return st.Err()
+}
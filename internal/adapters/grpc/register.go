@@ -0,0 +1,31 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/pkg/authgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) Register(ctx context.Context, req *authgrpc.RegisterRequest) (*authgrpc.RegisterResponse, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.auth.Register(ctx, req.Login, req.Password)
+	if err != nil {
+		logger.Errorf(err.Error())
+		code := codes.Internal
+		switch {
+		case errors.Is(err, domainerrors.ErrInvalidLogin), errors.Is(err, domainerrors.ErrWeakPassword):
+			code = codes.InvalidArgument
+		case errors.Is(err, domainerrors.ErrAlreadyExists):
+			code = codes.AlreadyExists
+		case errors.Is(err, domainerrors.ErrReadOnly):
+			code = codes.Unimplemented
+		}
+		return nil, status.Errorf(code, err.Error())
+	}
+	return &authgrpc.RegisterResponse{Login: user.Login}, nil
+}
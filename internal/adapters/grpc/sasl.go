@@ -0,0 +1,174 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/sasl"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/pkg/authgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// saslExchangeTTL bounds the wait for the next step of an exchange.
+	saslExchangeTTL = time.Minute
+	// Anyone can start exchanges, so the pending ones are limited in
+	// total and per client address.
+	maxSaslExchanges        = 10000
+	maxSaslExchangesPerPeer = 32
+)
+
+var errTooManySaslExchanges = errors.New("too many pending SASL exchanges")
+
+type saslExchange struct {
+	mech    sasl.Mechanism
+	peer    string
+	expires time.Time
+}
+
+// saslExchanges keeps exchanges between steps. They live in the replica
+// that started them, so clients must send every step to the same one.
+type saslExchanges struct {
+	mu        sync.Mutex
+	exchanges map[string]*saslExchange
+	peers     map[string]int
+}
+
+// take removes and returns the exchange id unless it has expired.
+func (e *saslExchanges) take(id string) (*saslExchange, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	exchange, ok := e.exchanges[id]
+	if !ok {
+		return nil, false
+	}
+	e.remove(id)
+	return exchange, time.Now().Before(exchange.expires)
+}
+
+// put keeps exchange as id, failing with errTooManySaslExchanges over the
+// limits.
+func (e *saslExchanges) put(id string, exchange *saslExchange) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.exchanges == nil {
+		e.exchanges, e.peers = map[string]*saslExchange{}, map[string]int{}
+	}
+	if len(e.exchanges) >= maxSaslExchanges || e.peers[exchange.peer] >= maxSaslExchangesPerPeer {
+		return errTooManySaslExchanges
+	}
+	exchange.expires = time.Now().Add(saslExchangeTTL)
+	e.exchanges[id] = exchange
+	e.peers[exchange.peer]++
+	return nil
+}
+
+// remove forgets exchange id; the caller holds mu.
+func (e *saslExchanges) remove(id string) {
+	peer := e.exchanges[id].peer
+	delete(e.exchanges, id)
+	if e.peers[peer]--; e.peers[peer] <= 0 {
+		delete(e.peers, peer)
+	}
+}
+
+// sweep forgets the exchanges expired at now.
+func (e *saslExchanges) sweep(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, exchange := range e.exchanges {
+		if now.After(exchange.expires) {
+			e.remove(id)
+		}
+	}
+}
+
+// run sweeps expired exchanges until done is closed.
+func (e *saslExchanges) run(done <-chan struct{}) {
+	ticker := time.NewTicker(saslExchangeTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			e.sweep(now)
+		}
+	}
+}
+
+// SaslStep runs one step of a SASL exchange for a mail server that
+// authenticates its clients with this service.
+func (s *Server) SaslStep(ctx context.Context, req *authgrpc.SaslStepRequest) (*authgrpc.SaslStepResponse, error) {
+	logger := s.annotatedLogger(ctx)
+
+	id := req.ExchangeID
+	response := req.Response
+	var exchange *saslExchange
+	if id == "" {
+		if req.Service == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Service is required")
+		}
+		mech, err := sasl.New(req.Mechanism, s.auth, protocol(req.Service))
+		if err != nil {
+			logger.Errorf("%s", err.Error())
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		peer, _ := ctx.Value(utils.CtxKeyRemoteIPGet()).(string)
+		id, exchange = uuid.NewString(), &saslExchange{mech: mech, peer: peer}
+		if !req.HasResponse {
+			response = nil
+		}
+	} else {
+		var ok bool
+		if exchange, ok = s.sasl.take(id); !ok {
+			return nil, status.Errorf(codes.NotFound, "SASL exchange %s not found or expired", id)
+		}
+		if response == nil {
+			response = []byte{}
+		}
+	}
+
+	challenge, user, err := exchange.mech.Next(ctx, response)
+	if err != nil {
+		logger.Errorf("SASL %s exchange of %s failed: %s", req.Mechanism, exchange.mech.Login(), err.Error())
+		var retry *domainerrors.RetryAfterError
+		switch {
+		case errors.As(err, &retry):
+			return nil, resourceExhausted(err, retry.RetryAfter)
+		case errors.Is(err, domainerrors.ErrMalformed):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, domainerrors.ErrUserDisabled):
+			return nil, status.Errorf(codes.PermissionDenied, "user is disabled")
+		}
+		return nil, status.Errorf(codes.PermissionDenied, "authentication failed")
+	}
+	if user == nil {
+		if err := s.sasl.put(id, exchange); err != nil {
+			logger.Errorf("SASL %s exchange rejected: %s", req.Mechanism, err.Error())
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return &authgrpc.SaslStepResponse{ExchangeID: id, Challenge: challenge}, nil
+	}
+	return &authgrpc.SaslStepResponse{ExchangeID: id, Challenge: challenge, Done: true, Login: user.Login}, nil
+}
+
+// protocol maps a mail service name to an app password scope.
+func protocol(service string) string {
+	service = strings.ToLower(service)
+	if service == "submission" {
+		return models.ProtocolSMTP
+	}
+	return service
+}
@@ -0,0 +1,40 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSaslExchanges(t *testing.T) {
+	var e saslExchanges
+
+	for i := 0; i < maxSaslExchangesPerPeer; i++ {
+		if err := e.put(fmt.Sprint(i), &saslExchange{peer: "192.0.2.1"}); err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	if err := e.put("over", &saslExchange{peer: "192.0.2.1"}); !errors.Is(err, errTooManySaslExchanges) {
+		t.Fatalf("Expected %v, but was %v", errTooManySaslExchanges, err)
+	}
+	if err := e.put("other", &saslExchange{peer: "192.0.2.2"}); err != nil {
+		t.Fatalf("Expected another peer to be accepted, but was %v", err)
+	}
+
+	// Taking an exchange frees its place.
+	if _, ok := e.take("0"); !ok {
+		t.Fatalf("Expected exchange 0")
+	}
+	if _, ok := e.take("0"); ok {
+		t.Fatalf("Expected exchange 0 to be taken once")
+	}
+	if err := e.put("again", &saslExchange{peer: "192.0.2.1"}); err != nil {
+		t.Fatalf("Expected a freed place, but was %v", err)
+	}
+
+	e.sweep(time.Now().Add(saslExchangeTTL + time.Second))
+	if len(e.exchanges) != 0 || len(e.peers) != 0 {
+		t.Fatalf("Expected expired exchanges to be swept, but was %d, %v", len(e.exchanges), e.peers)
+	}
+}
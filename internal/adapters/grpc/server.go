@@ -3,6 +3,7 @@ package grpc
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 
@@ -16,14 +17,18 @@ import (
 
 type Server struct {
 	authgrpc.UnimplementedAuthGrpcServer
-	auth   ports.Auth
-	server *grpc.Server
-	l      net.Listener
-	port   int
-	logger *zap.SugaredLogger
+	auth    ports.Auth
+	limiter ports.RateLimiter
+	proxies utils.TrustedProxies
+	sasl    saslExchanges
+	done    chan struct{}
+	server  *grpc.Server
+	l       net.Listener
+	port    int
+	logger  *zap.SugaredLogger
 }
 
-func New(logger *zap.SugaredLogger, auth ports.Auth) (*Server, error) {
+func New(logger *zap.SugaredLogger, auth ports.Auth, limiter ports.RateLimiter) (*Server, error) {
 	var (
 		s   Server
 		err error
@@ -34,11 +39,19 @@ func New(logger *zap.SugaredLogger, auth ports.Auth) (*Server, error) {
 		logger.Fatalf("failed listen port: %s", err)
 	}
 	s.auth = auth
+	s.limiter = limiter
+	s.proxies, err = utils.ParseTrustedProxies(config.GetConfig(logger).TrustedProxies)
+	if err != nil {
+		logger.Errorf("trusted proxies loading failed: %s", err.Error())
+		return nil, fmt.Errorf("trusted proxies loading failed: %w", err)
+	}
 	s.port = s.l.Addr().(*net.TCPAddr).Port
 
-	s.server = grpc.NewServer()
+	s.server = grpc.NewServer(grpc.ChainUnaryInterceptor(s.AnnotateContext(), s.RateLimit()))
 	s.logger = logger
 	authgrpc.RegisterAuthGrpcServer(s.server, &s)
+	s.done = make(chan struct{})
+	go s.sasl.run(s.done)
 
 	return &s, nil
 }
@@ -68,6 +81,7 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) Stop(ctx context.Context) error {
+	close(s.done)
 	s.server.Stop()
 	return nil
 }
@@ -0,0 +1,68 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/pkg/authgrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Server) ListSessions(ctx context.Context, req *authgrpc.SessionsRequest) (*authgrpc.SessionsResponse, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.auth.Validate(ctx, req.AccessToken)
+	if err != nil {
+		logger.Errorf("failed to validate token")
+		return nil, status.Errorf(codes.Unauthenticated, "failed to validate token")
+	}
+	sessions, err := s.auth.Sessions(ctx, user.Login)
+	if err != nil {
+		logger.Errorf(err.Error())
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+
+	resp := &authgrpc.SessionsResponse{}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, &authgrpc.Session{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastSeenAt: session.LastSeenAt.Unix(),
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) RevokeSession(ctx context.Context, req *authgrpc.RevokeSessionRequest) (*authgrpc.RevokeSessionResponse, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.auth.Validate(ctx, req.AccessToken)
+	if err != nil {
+		logger.Errorf("failed to validate token")
+		return nil, status.Errorf(codes.Unauthenticated, "failed to validate token")
+	}
+	if req.All {
+		revoked, err := s.auth.RevokeSessions(ctx, user.Login)
+		if err != nil {
+			logger.Errorf(err.Error())
+			return nil, status.Errorf(codes.Internal, err.Error())
+		}
+		return &authgrpc.RevokeSessionResponse{Revoked: int32(revoked)}, nil
+	}
+	if req.SessionID == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "either SessionID or All must be set")
+	}
+	if err := s.auth.RevokeSession(ctx, user.Login, req.SessionID); err != nil {
+		logger.Errorf(err.Error())
+		if errors.Is(err, domainerrors.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, fmt.Sprintf("session %s not found", req.SessionID))
+		}
+		return nil, status.Errorf(codes.Internal, err.Error())
+	}
+	return &authgrpc.RevokeSessionResponse{Revoked: 1}, nil
+}
@@ -0,0 +1,272 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	ownAccount      = "administrators cannot disable, demote or delete their own account"
+)
+
+type userResponse struct {
+	Login       string   `json:"login"`
+	Address     string   `json:"address"`
+	Domain      string   `json:"domain"`
+	Aliases     []string `json:"aliases"`
+	DisplayName string   `json:"displayName"`
+	Role        string   `json:"role"`
+	Disabled    bool     `json:"disabled"`
+}
+
+type usersResponse struct {
+	Users  []userResponse `json:"users"`
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+}
+
+type createUserRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// updateUserRequest changes the fields present. An empty address removes
+// the primary address and aliases replaces all aliases.
+type updateUserRequest struct {
+	Role        *string   `json:"role"`
+	Disabled    *bool     `json:"disabled"`
+	Address     *string   `json:"address"`
+	Aliases     *[]string `json:"aliases"`
+	DisplayName *string   `json:"displayName"`
+}
+
+type resetPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func newUserResponse(user *models.User) userResponse {
+	resp := userResponse{
+		Login:       user.Login,
+		Address:     user.Address,
+		Domain:      user.Domain,
+		Aliases:     user.Aliases,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+		Disabled:    user.Disabled,
+	}
+	if resp.Aliases == nil {
+		resp.Aliases = []string{}
+	}
+	return resp
+}
+
+func (s *Server) adminHandlers() http.Handler {
+	h := chi.NewRouter()
+	h.Use(s.AnnotateContext())
+	h.Use(s.RequireRole(models.RoleAdmin, models.RoleDomainAdmin))
+	h.Get("/users", s.ListUsers)
+	h.Post("/users", s.CreateUser)
+	h.Get("/users/{login}", s.GetUser)
+	h.Patch("/users/{login}", s.UpdateUser)
+	h.Post("/users/{login}/disable", s.setDisabled(true))
+	h.Post("/users/{login}/enable", s.setDisabled(false))
+	h.Post("/users/{login}/unlock", s.UnlockUser)
+	h.Post("/users/{login}/password", s.ResetPassword)
+	h.Delete("/users/{login}", s.DeleteUser)
+	return h
+}
+
+// ListUsers serves ?prefix=&domain=&offset=&limit= pages of users ordered by
+// login. Domain administrators only get the users of their domain.
+func (s *Server) ListUsers(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	filter, err := userFilter(r)
+	if err != nil {
+		utils.ResponseJSON(w, http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+	users, total, err := s.auth.ListUsers(r.Context(), actor(r), filter)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+
+	resp := usersResponse{Users: make([]userResponse, 0, len(users)), Total: total, Offset: filter.Offset, Limit: filter.Limit}
+	for i := range users {
+		resp.Users = append(resp.Users, newUserResponse(&users[i]))
+	}
+	utils.ResponseJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.auth.GetUser(r.Context(), actor(r), chi.URLParam(r, "login"))
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+	user, err := s.auth.CreateUser(r.Context(), actor(r), req.Login, req.Password, req.Role)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusCreated, newUserResponse(user))
+}
+
+func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	s.updateUser(w, r, models.UserUpdate{
+		Role:        req.Role,
+		Disabled:    req.Disabled,
+		Address:     req.Address,
+		Aliases:     req.Aliases,
+		DisplayName: req.DisplayName,
+	})
+}
+
+func (s *Server) setDisabled(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.updateUser(w, r, models.UserUpdate{Disabled: &disabled})
+	}
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request, update models.UserUpdate) {
+	login := chi.URLParam(r, "login")
+	demoted := update.Role != nil && *update.Role != actor(r).Role
+	disabled := update.Disabled != nil && *update.Disabled
+	if (demoted || disabled) && s.isCurrentUser(r, login) {
+		s.ownAccountError(w, r)
+		return
+	}
+
+	user, err := s.auth.UpdateUser(r.Context(), actor(r), login, update)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, newUserResponse(user))
+}
+
+// UnlockUser lifts a lockout caused by failed logins.
+func (s *Server) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if err := s.auth.UnlockLogin(r.Context(), actor(r), chi.URLParam(r, "login")); err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetPassword sets the password from the body or, if it is empty, a
+// generated one that is returned once.
+func (s *Server) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if r.ContentLength != 0 && !s.decodeJSON(w, r, &req) {
+		return
+	}
+	password, err := s.auth.ResetPassword(r.Context(), actor(r), chi.URLParam(r, "login"), req.Password)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	resp := map[string]string{}
+	if req.Password == "" {
+		resp["password"] = password
+	}
+	utils.ResponseJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	login := chi.URLParam(r, "login")
+	if s.isCurrentUser(r, login) {
+		s.ownAccountError(w, r)
+		return
+	}
+	if err := s.auth.DeleteUser(r.Context(), actor(r), login); err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func userFilter(r *http.Request) (models.UserFilter, error) {
+	query := r.URL.Query()
+	filter := models.UserFilter{LoginPrefix: query.Get("prefix"), Domain: query.Get("domain"), Limit: defaultPageSize}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return filter, fmt.Errorf("invalid offset %q", v)
+		}
+		filter.Offset = offset
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			return filter, fmt.Errorf("invalid limit %q, expected 1 to %d", v, maxPageSize)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// actor returns the administrator RequireRole let through.
+func actor(r *http.Request) *models.User {
+	user, _ := r.Context().Value(ctxKeyUser{}).(*models.User)
+	return user
+}
+
+func (s *Server) isCurrentUser(r *http.Request, login string) bool {
+	user := actor(r)
+	return user != nil && user.Login == login
+}
+
+func (s *Server) ownAccountError(w http.ResponseWriter, r *http.Request) {
+	utils.ResponseJSON(w, http.StatusConflict, map[string]string{
+		"error": ownAccount,
+	})
+	s.annotatedLogger(r.Context()).Errorf(ownAccount)
+}
+
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(v); err != nil {
+		utils.ResponseJSON(w, http.StatusBadRequest, map[string]string{
+			"error": invalidRequestBody,
+		})
+		s.annotatedLogger(r.Context()).Errorf("%s: %s", invalidRequestBody, err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) adminError(w http.ResponseWriter, r *http.Request, err error) {
+	utils.ResponseJSON(w, errorStatus(err), map[string]string{
+		"error": err.Error(),
+	})
+	s.annotatedLogger(r.Context()).Errorf(err.Error())
+}
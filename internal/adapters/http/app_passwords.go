@@ -0,0 +1,100 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+type appPasswordRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type appPasswordResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	// Password is only set in the response to its creation.
+	Password string `json:"password,omitempty"`
+}
+
+func (s *Server) appPasswordHandlers() http.Handler {
+	h := chi.NewRouter()
+	h.Use(s.AnnotateContext())
+	h.Use(s.ValidateAuth())
+	h.Get("/", s.AppPasswords)
+	h.Post("/", s.CreateAppPassword)
+	h.Delete("/{id}", s.RevokeAppPassword)
+	return h
+}
+
+// CreateAppPassword returns a new password for a mail client. It is never
+// shown again.
+func (s *Server) CreateAppPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var req appPasswordRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	appPassword, password, err := s.auth.CreateAppPassword(r.Context(), user.Login, req.Name, req.Scopes)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	resp := newAppPasswordResponse(*appPassword)
+	resp.Password = password
+	utils.ResponseJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) AppPasswords(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	passwords, err := s.auth.AppPasswords(r.Context(), user.Login)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	resp := make([]appPasswordResponse, 0, len(passwords))
+	for _, password := range passwords {
+		resp = append(resp, newAppPasswordResponse(password))
+	}
+	utils.ResponseJSON(w, http.StatusOK, map[string][]appPasswordResponse{
+		"appPasswords": resp,
+	})
+}
+
+func (s *Server) RevokeAppPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.auth.RevokeAppPassword(r.Context(), user.Login, chi.URLParam(r, "id")); err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAppPasswordResponse(password models.AppPassword) appPasswordResponse {
+	resp := appPasswordResponse{
+		ID:        password.ID,
+		Name:      password.Name,
+		Scopes:    password.Scopes,
+		CreatedAt: password.CreatedAt,
+	}
+	if !password.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &password.LastUsedAt
+	}
+	return resp
+}
@@ -2,10 +2,12 @@ package http
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
 	"go.uber.org/zap"
@@ -14,13 +16,32 @@ import (
 const (
 	tokenExtractionFailed = "failed to extract token from request"
 	invalidAuthHeader     = "invalid Authorization header"
+	invalidRequestBody    = "invalid request body"
 )
 
+type infoResponse struct {
+	Login             string `json:"login"`
+	RecoveryCodesLeft int    `json:"recoveryCodesLeft"`
+}
+
+type loginMFARequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type registerRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
 func (s *Server) authHandlers() http.Handler {
 	h := chi.NewRouter()
 	h.With(s.AnnotateContext()).With(s.ValidateAuth()).Get("/i", s.Info)
 	h.With(s.AnnotateContext()).Post("/login", s.Login)
+	h.With(s.AnnotateContext()).Post("/login/mfa", s.LoginMFA)
+	h.With(s.AnnotateContext()).Post("/register", s.Register)
 	h.With(s.AnnotateContext()).Post("/logout", s.Logout)
+	h.With(s.AnnotateContext()).Get("/.well-known/jwks.json", s.JWKS)
 	return h
 }
 
@@ -47,8 +68,17 @@ func (s *Server) Info(w http.ResponseWriter, r *http.Request) {
 		logger.Errorf(tokenExtractionFailed)
 		return
 	}
-	utils.ResponseJSON(w, http.StatusOK, map[string]string{
-		"login": user.Login,
+	codesLeft, err := s.auth.RecoveryCodesLeft(r.Context(), user.Login)
+	if err != nil {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, infoResponse{
+		Login:             user.Login,
+		RecoveryCodesLeft: codesLeft,
 	})
 }
 
@@ -64,13 +94,55 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tokens, err := s.auth.Login(r.Context(), user, password)
-	if err != nil {
-		utils.ResponseJSON(w, http.StatusForbidden, map[string]string{
-			"error": err.Error(),
+	var mfa *domainerrors.MFARequiredError
+	if errors.As(err, &mfa) {
+		utils.ResponseJSON(w, http.StatusUnauthorized, map[string]string{
+			"error":          err.Error(),
+			"challengeToken": mfa.ChallengeToken,
 		})
-		logger.Errorf(err.Error())
+		logger.Infof("login %s needs a second factor", user)
+		return
+	}
+	if err != nil {
+		s.loginError(w, r, err)
+		return
+	}
+	s.writeTokens(w, r, tokens)
+}
+
+// LoginMFA completes a login answered with mfa_required using the challenge
+// token and a TOTP code.
+func (s *Server) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req loginMFARequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	tokens, err := s.auth.LoginMFA(r.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		s.loginError(w, r, err)
 		return
 	}
+	s.writeTokens(w, r, tokens)
+}
+
+// loginError answers failed logins with 403, or 429 and Retry-After during a
+// lockout.
+func (s *Server) loginError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusForbidden
+	var retry *domainerrors.RetryAfterError
+	if errors.As(err, &retry) {
+		setRetryAfter(w, retry.RetryAfter)
+		status = http.StatusTooManyRequests
+	}
+	utils.ResponseJSON(w, status, map[string]string{
+		"error": err.Error(),
+	})
+	s.annotatedLogger(r.Context()).Errorf(err.Error())
+}
+
+// writeTokens sets the token cookies and returns the tokens, redirecting to
+// redirect_uri if given.
+func (s *Server) writeTokens(w http.ResponseWriter, r *http.Request, tokens models.TokenPair) {
 	redirectURI := r.URL.Query().Get("redirect_uri")
 	status := http.StatusOK
 	if redirectURI != "" {
@@ -91,21 +163,64 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	var req registerRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	user, err := s.auth.Register(r.Context(), req.Login, req.Password)
+	if err != nil {
+		utils.ResponseJSON(w, errorStatus(err), map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+	utils.ResponseJSON(w, http.StatusCreated, map[string]string{
+		"login": user.Login,
+	})
+}
+
 func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	var tokens models.TokenPair
+	if cookie, err := r.Cookie("access"); err == nil {
+		tokens.AuthToken = cookie.Value
+	}
+	if cookie, err := r.Cookie("refresh"); err == nil {
+		tokens.RefreshToken = cookie.Value
+	}
+	err := s.auth.Logout(r.Context(), &tokens)
+
 	http.SetCookie(w, &http.Cookie{
-		Name:     "accessToken",
+		Name:     "access",
 		Path:     "/",
 		Expires:  time.Unix(0, 0),
 		HttpOnly: true,
 	})
 	http.SetCookie(w, &http.Cookie{
-		Name:     "refreshToken",
+		Name:     "refresh",
 		Path:     "/",
 		Expires:  time.Unix(0, 0),
 		HttpOnly: true,
 	})
+	if err != nil {
+		utils.ResponseJSON(w, http.StatusForbidden, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
 	utils.ResponseJSON(w, http.StatusOK, map[string]string{
 		"accessToken":  "",
 		"refreshToken": "",
 	})
 }
+
+func (s *Server) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.ResponseJSON(w, http.StatusOK, s.auth.JWKS(r.Context()))
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+// errorStatus maps domain errors to response codes.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, domainerrors.ErrInvalidLogin),
+		errors.Is(err, domainerrors.ErrWeakPassword),
+		errors.Is(err, domainerrors.ErrInvalidRole),
+		errors.Is(err, domainerrors.ErrInvalidCode),
+		errors.Is(err, domainerrors.ErrInvalidScope),
+		errors.Is(err, domainerrors.ErrInvalidAddress):
+		return http.StatusBadRequest
+	case errors.Is(err, domainerrors.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domainerrors.ErrAlreadyExists):
+		return http.StatusConflict
+	case errors.Is(err, domainerrors.ErrForbidden), errors.Is(err, domainerrors.ErrUserDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, domainerrors.ErrTooManyLogins), errors.Is(err, domainerrors.ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, domainerrors.ErrReadOnly):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
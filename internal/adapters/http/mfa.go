@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+type totpEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+	QRCode string `json:"qrCode"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code"`
+}
+
+func (s *Server) mfaHandlers() http.Handler {
+	h := chi.NewRouter()
+	h.Use(s.AnnotateContext())
+	h.Use(s.ValidateAuth())
+	h.Post("/totp", s.EnrollTOTP)
+	h.Post("/totp/confirm", s.ConfirmTOTP)
+	h.Post("/totp/disable", s.DisableTOTP)
+	h.Post("/recovery-codes", s.RegenerateRecoveryCodes)
+	return h
+}
+
+// EnrollTOTP returns a new secret with its otpauth:// URI and the URI as a
+// QR code PNG data URI. 2FA is enabled by ConfirmTOTP.
+func (s *Server) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	enrollment, err := s.auth.EnrollTOTP(r.Context(), user.Login)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusCreated, totpEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(enrollment.QRCode),
+	})
+}
+
+// ConfirmTOTP enables 2FA and returns the recovery codes, which are never
+// shown again.
+func (s *Server) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	s.totpCode(w, r, func(ctx context.Context, login, code string) (interface{}, error) {
+		codes, err := s.auth.ConfirmTOTP(ctx, login, code)
+		return recoveryCodesResponse{RecoveryCodes: codes}, err
+	})
+}
+
+func (s *Server) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	s.totpCode(w, r, func(ctx context.Context, login, code string) (interface{}, error) {
+		return nil, s.auth.DisableTOTP(ctx, login, code)
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes with a new batch.
+func (s *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	s.totpCode(w, r, func(ctx context.Context, login, code string) (interface{}, error) {
+		codes, err := s.auth.RegenerateRecoveryCodes(ctx, login, code)
+		return recoveryCodesResponse{RecoveryCodes: codes}, err
+	})
+}
+
+// totpCode runs action with the code in the body for the current user and
+// answers with its result, or 204 if there is none.
+func (s *Server) totpCode(w http.ResponseWriter, r *http.Request, action func(ctx context.Context, login, code string) (interface{}, error)) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var req totpCodeRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := action(r.Context(), user.Login, req.Code)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, resp)
+}
+
+// currentUser returns the user stored by ValidateAuth.
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, ok := r.Context().Value(ctxKeyUser{}).(*models.User)
+	if !ok {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": tokenExtractionFailed,
+		})
+		s.annotatedLogger(r.Context()).Errorf(tokenExtractionFailed)
+	}
+	return user, ok
+}
@@ -2,9 +2,13 @@ package http
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/middleware"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
 )
 
@@ -20,8 +24,8 @@ func (s *Server) ValidateAuth() func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			logger := s.annotatedLogger(r.Context())
 
-			accessToken, err := r.Cookie("access")
-			if err != nil {
+			accessToken, ok := requestAccessToken(r)
+			if !ok {
 				utils.ResponseJSON(w, http.StatusForbidden, map[string]string{
 					"error": tokenReadingFailed,
 				})
@@ -29,7 +33,7 @@ func (s *Server) ValidateAuth() func(next http.Handler) http.Handler {
 				return
 			}
 
-			user, err := s.auth.Validate(r.Context(), accessToken.Value)
+			user, err := s.auth.Validate(r.Context(), accessToken)
 			if err != nil {
 				utils.ResponseJSON(w, http.StatusForbidden, map[string]string{
 					"error": invalidToken,
@@ -45,6 +49,55 @@ func (s *Server) ValidateAuth() func(next http.Handler) http.Handler {
 	}
 }
 
+// RequireRole is ValidateAuth for endpoints restricted to users with one of
+// roles.
+func (s *Server) RequireRole(roles ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := s.annotatedLogger(r.Context())
+
+			accessToken, ok := requestAccessToken(r)
+			if !ok {
+				utils.ResponseJSON(w, http.StatusUnauthorized, map[string]string{
+					"error": tokenReadingFailed,
+				})
+				logger.Errorf(tokenReadingFailed)
+				return
+			}
+
+			user, err := s.auth.ValidateRole(r.Context(), accessToken, roles...)
+			if err != nil {
+				status := http.StatusUnauthorized
+				if errors.Is(err, domainerrors.ErrForbidden) {
+					status = http.StatusForbidden
+				}
+				utils.ResponseJSON(w, status, map[string]string{
+					"error": err.Error(),
+				})
+				logger.Errorf(err.Error())
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyUser{}, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requestAccessToken reads the access token from a bearer Authorization
+// header, as sent by API clients, or from the access cookie set by /login.
+func requestAccessToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token := strings.TrimPrefix(header, "Bearer ")
+		return token, token != header && token != ""
+	}
+	cookie, err := r.Cookie("access")
+	if err != nil {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
 func (s *Server) AnnotateContext() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -52,8 +105,31 @@ func (s *Server) AnnotateContext() func(next http.Handler) http.Handler {
 			ctx = context.WithValue(ctx, utils.CtxKeyRequestIDGet(), middleware.GetReqID(r.Context()))
 			ctx = context.WithValue(ctx, utils.CtxKeyMethodGet(), r.Method)
 			ctx = context.WithValue(ctx, utils.CtxKeyURLGet(), r.URL.String())
+			ctx = context.WithValue(ctx, utils.CtxKeyUserAgentGet(), r.UserAgent())
+			ctx = context.WithValue(ctx, utils.CtxKeyRemoteIPGet(), remoteIP(r))
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// RealIP replaces RemoteAddr with the client address, which trusted proxies
+// report in X-Forwarded-For.
+func (s *Server) RealIP() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.RemoteAddr = s.proxies.ClientIP(remoteIP(r), r.Header.Values("X-Forwarded-For"))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// remoteIP strips the port from RemoteAddr, which RealIP has already
+// replaced with the client address if a trusted proxy reported one.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,47 @@
+package http
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+// clientIDHeader names the API client, such as a mail frontend, for rules
+// keyed by client.
+const clientIDHeader = "X-Client-ID"
+
+// RateLimit rejects requests over the configured limits with 429 and a
+// Retry-After header. The login is taken from basic auth, as sent to /login.
+func (s *Server) RateLimit() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			login, _, _ := r.BasicAuth()
+			subject := models.RateLimitSubject{IP: remoteIP(r), Login: login, Client: r.Header.Get(clientIDHeader)}
+			err := s.limiter.Allow(r.Context(), r.URL.Path, subject)
+			var limited *domainerrors.RateLimitError
+			if !errors.As(err, &limited) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			setRetryAfter(w, limited.RetryAfter)
+			utils.ResponseJSON(w, http.StatusTooManyRequests, map[string]string{
+				"error": err.Error(),
+			})
+		})
+	}
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounded up.
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
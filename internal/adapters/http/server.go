@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
@@ -11,18 +12,21 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
 	"go.uber.org/zap"
 )
 
 type Server struct {
-	auth   ports.Auth
-	server *http.Server
-	l      net.Listener
-	port   int
-	logger *zap.SugaredLogger
+	auth    ports.Auth
+	limiter ports.RateLimiter
+	proxies utils.TrustedProxies
+	server  *http.Server
+	l       net.Listener
+	port    int
+	logger  *zap.SugaredLogger
 }
 
-func New(logger *zap.SugaredLogger, auth ports.Auth) (*Server, error) {
+func New(logger *zap.SugaredLogger, auth ports.Auth, limiter ports.RateLimiter) (*Server, error) {
 	var (
 		err error
 		s   Server
@@ -32,6 +36,12 @@ func New(logger *zap.SugaredLogger, auth ports.Auth) (*Server, error) {
 		logger.Fatalf("Failed listen port: %s", err)
 	}
 	s.auth = auth
+	s.limiter = limiter
+	s.proxies, err = utils.ParseTrustedProxies(config.GetConfig(logger).TrustedProxies)
+	if err != nil {
+		logger.Errorf("trusted proxies loading failed: %s", err.Error())
+		return nil, fmt.Errorf("trusted proxies loading failed: %w", err)
+	}
 	s.port = s.l.Addr().(*net.TCPAddr).Port
 	s.server = &http.Server{
 		Handler: s.routes(),
@@ -62,12 +72,18 @@ func (s *Server) routes() http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(s.RealIP())
 	r.Use(middleware.Recoverer)
+	r.Use(s.RateLimit())
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	r.Get("/healthz", s.healthzHandler)
 	r.Mount("/", s.authHandlers())
+	r.Mount("/sessions", s.sessionHandlers())
+	r.Mount("/mfa", s.mfaHandlers())
+	r.Mount("/webauthn", s.webauthnHandlers())
+	r.Mount("/app-passwords", s.appPasswordHandlers())
+	r.Mount("/admin", s.adminHandlers())
 	r.Mount("/debug/", middleware.Profiler())
 
 	return r
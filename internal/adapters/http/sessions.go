@@ -0,0 +1,115 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+type sessionResponse struct {
+	ID         string    `json:"id"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+}
+
+func (s *Server) sessionHandlers() http.Handler {
+	h := chi.NewRouter()
+	h.Use(s.AnnotateContext())
+	h.Use(s.ValidateAuth())
+	h.Get("/", s.Sessions)
+	h.Delete("/", s.RevokeSessions)
+	h.Delete("/{id}", s.RevokeSession)
+	return h
+}
+
+func (s *Server) Sessions(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	user, ok := r.Context().Value(ctxKeyUser{}).(*models.User)
+	if !ok {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": tokenExtractionFailed,
+		})
+		logger.Errorf(tokenExtractionFailed)
+		return
+	}
+	sessions, err := s.auth.Sessions(r.Context(), user.Login)
+	if err != nil {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, sessionResponse{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+		})
+	}
+	utils.ResponseJSON(w, http.StatusOK, map[string][]sessionResponse{
+		"sessions": resp,
+	})
+}
+
+func (s *Server) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	user, ok := r.Context().Value(ctxKeyUser{}).(*models.User)
+	if !ok {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": tokenExtractionFailed,
+		})
+		logger.Errorf(tokenExtractionFailed)
+		return
+	}
+	err := s.auth.RevokeSession(r.Context(), user.Login, chi.URLParam(r, "id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, domainerrors.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.ResponseJSON(w, status, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	logger := s.annotatedLogger(r.Context())
+
+	user, ok := r.Context().Value(ctxKeyUser{}).(*models.User)
+	if !ok {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": tokenExtractionFailed,
+		})
+		logger.Errorf(tokenExtractionFailed)
+		return
+	}
+	revoked, err := s.auth.RevokeSessions(r.Context(), user.Login)
+	if err != nil {
+		utils.ResponseJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+		logger.Errorf(err.Error())
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, map[string]int{
+		"revoked": revoked,
+	})
+}
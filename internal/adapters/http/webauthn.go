@@ -0,0 +1,216 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+// base64URL is binary data sent as unpadded base64url, the encoding used by
+// browsers for PublicKeyCredential members.
+type base64URL []byte
+
+func (b *base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+type webauthnRegistrationResponse struct {
+	ChallengeToken string                         `json:"challengeToken"`
+	PublicKey      models.WebAuthnCreationOptions `json:"publicKey"`
+}
+
+type webauthnLoginResponse struct {
+	ChallengeToken string                        `json:"challengeToken"`
+	PublicKey      models.WebAuthnRequestOptions `json:"publicKey"`
+}
+
+type webauthnRegisterRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Name           string `json:"name"`
+	Credential     struct {
+		RawID    base64URL `json:"rawId"`
+		Response struct {
+			ClientDataJSON    base64URL `json:"clientDataJSON"`
+			AttestationObject base64URL `json:"attestationObject"`
+		} `json:"response"`
+	} `json:"credential"`
+}
+
+type webauthnLoginBeginRequest struct {
+	Login string `json:"login"`
+}
+
+type webauthnLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Credential     struct {
+		RawID    base64URL `json:"rawId"`
+		Response struct {
+			ClientDataJSON    base64URL `json:"clientDataJSON"`
+			AuthenticatorData base64URL `json:"authenticatorData"`
+			Signature         base64URL `json:"signature"`
+			UserHandle        base64URL `json:"userHandle"`
+		} `json:"response"`
+	} `json:"credential"`
+}
+
+type webauthnCredentialResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+func (s *Server) webauthnHandlers() http.Handler {
+	h := chi.NewRouter()
+	h.Use(s.AnnotateContext())
+	h.Post("/login/begin", s.BeginWebAuthnLogin)
+	h.Post("/login/finish", s.FinishWebAuthnLogin)
+	h.Group(func(h chi.Router) {
+		h.Use(s.ValidateAuth())
+		h.Post("/register/begin", s.BeginWebAuthnRegistration)
+		h.Post("/register/finish", s.FinishWebAuthnRegistration)
+		h.Get("/credentials", s.WebAuthnCredentials)
+		h.Delete("/credentials/{id}", s.DeleteWebAuthnCredential)
+	})
+	return h
+}
+
+// BeginWebAuthnRegistration returns the options for
+// navigator.credentials.create and the token to finish the ceremony with.
+func (s *Server) BeginWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	registration, err := s.auth.BeginWebAuthnRegistration(r.Context(), user.Login)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, webauthnRegistrationResponse{
+		ChallengeToken: registration.ChallengeToken,
+		PublicKey:      registration.Options,
+	})
+}
+
+func (s *Server) FinishWebAuthnRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	var req webauthnRegisterRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	credential, err := s.auth.FinishWebAuthnRegistration(r.Context(), user.Login, req.ChallengeToken, req.Name, models.WebAuthnAttestation{
+		ClientDataJSON:    req.Credential.Response.ClientDataJSON,
+		AttestationObject: req.Credential.Response.AttestationObject,
+	})
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusCreated, newWebAuthnCredentialResponse(*credential))
+}
+
+// BeginWebAuthnLogin returns the options for navigator.credentials.get. The
+// login is optional: without it any passkey of the user may answer.
+func (s *Server) BeginWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req webauthnLoginBeginRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	login, err := s.auth.BeginWebAuthnLogin(r.Context(), req.Login)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	utils.ResponseJSON(w, http.StatusOK, webauthnLoginResponse{
+		ChallengeToken: login.ChallengeToken,
+		PublicKey:      login.Options,
+	})
+}
+
+// FinishWebAuthnLogin answers like Login: tokens on success, 403 otherwise.
+func (s *Server) FinishWebAuthnLogin(w http.ResponseWriter, r *http.Request) {
+	var req webauthnLoginRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	tokens, err := s.auth.FinishWebAuthnLogin(r.Context(), req.ChallengeToken, models.WebAuthnAssertion{
+		CredentialID:      req.Credential.RawID,
+		ClientDataJSON:    req.Credential.Response.ClientDataJSON,
+		AuthenticatorData: req.Credential.Response.AuthenticatorData,
+		Signature:         req.Credential.Response.Signature,
+		UserHandle:        req.Credential.Response.UserHandle,
+	})
+	if err != nil {
+		s.loginError(w, r, err)
+		return
+	}
+	s.writeTokens(w, r, tokens)
+}
+
+func (s *Server) WebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	credentials, err := s.auth.WebAuthnCredentials(r.Context(), user.Login)
+	if err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	resp := make([]webauthnCredentialResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		resp = append(resp, newWebAuthnCredentialResponse(credential))
+	}
+	utils.ResponseJSON(w, http.StatusOK, map[string][]webauthnCredentialResponse{
+		"credentials": resp,
+	})
+}
+
+func (s *Server) DeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.currentUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := base64.RawURLEncoding.DecodeString(chi.URLParam(r, "id"))
+	if err != nil {
+		s.adminError(w, r, domainerrors.ErrNotFound)
+		return
+	}
+	if err := s.auth.DeleteWebAuthnCredential(r.Context(), user.Login, id); err != nil {
+		s.adminError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newWebAuthnCredentialResponse(credential models.WebAuthnCredential) webauthnCredentialResponse {
+	resp := webauthnCredentialResponse{
+		ID:        base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:      credential.Name,
+		CreatedAt: credential.CreatedAt,
+	}
+	if !credential.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &credential.LastUsedAt
+	}
+	return resp
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.AppPasswordStorage = (*Storage)(nil)
+
+func (db *Storage) CreateAppPassword(ctx context.Context, password *models.AppPassword) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.appPasswords[password.ID]; ok {
+		return errors.ErrAlreadyExists
+	}
+	stored := *password
+	stored.Scopes = append([]string{}, password.Scopes...)
+	db.appPasswords[password.ID] = stored
+	return nil
+}
+
+func (db *Storage) ListAppPasswords(ctx context.Context, login string) ([]models.AppPassword, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	passwords := []models.AppPassword{}
+	for _, password := range db.appPasswords {
+		if password.Login == login {
+			password.Scopes = append([]string{}, password.Scopes...)
+			passwords = append(passwords, password)
+		}
+	}
+	sort.Slice(passwords, func(i, j int) bool {
+		return passwords[i].CreatedAt.Before(passwords[j].CreatedAt)
+	})
+	return passwords, nil
+}
+
+func (db *Storage) UseAppPassword(ctx context.Context, id string, usedAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	password, ok := db.appPasswords[id]
+	if !ok {
+		return errors.ErrNotFound
+	}
+	password.LastUsedAt = usedAt
+	db.appPasswords[id] = password
+	return nil
+}
+
+func (db *Storage) DeleteAppPassword(ctx context.Context, login, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	password, ok := db.appPasswords[id]
+	if !ok || password.Login != login {
+		return errors.ErrNotFound
+	}
+	delete(db.appPasswords, id)
+	return nil
+}
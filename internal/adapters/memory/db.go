@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Storage keeps all data in process memory. It is meant for tests, local
+// development and single-replica deployments; nothing survives a restart.
+type Storage struct {
+	mu            sync.RWMutex
+	users         map[string]models.User
+	refreshTokens map[string]models.RefreshToken
+	revoked       map[string]time.Time
+	sessions      map[string]models.Session
+	loginFailures map[string]models.LoginFailures
+	rateLimits    map[string]models.RateLimitBucket
+	totp          map[string]models.TOTP
+	recoveryCodes map[string]map[string]struct{}
+	webauthn      map[string]models.WebAuthnCredential
+	appPasswords  map[string]models.AppPassword
+	logger        *zap.SugaredLogger
+}
+
+func New(logger *zap.SugaredLogger) *Storage {
+	return &Storage{
+		users:         map[string]models.User{},
+		refreshTokens: map[string]models.RefreshToken{},
+		revoked:       map[string]time.Time{},
+		sessions:      map[string]models.Session{},
+		loginFailures: map[string]models.LoginFailures{},
+		rateLimits:    map[string]models.RateLimitBucket{},
+		totp:          map[string]models.TOTP{},
+		recoveryCodes: map[string]map[string]struct{}{},
+		webauthn:      map[string]models.WebAuthnCredential{},
+		appPasswords:  map[string]models.AppPassword{},
+		logger:        logger,
+	}
+}
+
+func (db *Storage) annotatedLogger(ctx context.Context) *zap.SugaredLogger {
+	request_id, _ := ctx.Value(utils.CtxKeyRequestIDGet()).(string)
+	method, _ := ctx.Value(utils.CtxKeyMethodGet()).(string)
+	url, _ := ctx.Value(utils.CtxKeyURLGet()).(string)
+
+	return db.logger.With(
+		"request_id", request_id,
+		"method", method,
+		"url", url,
+	)
+}
+
+// Seed adds users, replacing any with the same login.
+func (db *Storage) Seed(users ...models.User) *Storage {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, user := range users {
+		db.users[user.Login] = user
+	}
+	return db
+}
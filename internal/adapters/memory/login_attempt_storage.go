@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.LoginAttemptStorage = (*Storage)(nil)
+
+func (db *Storage) RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAfter time.Duration) (*models.LoginFailures, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	failures, ok := db.loginFailures[key]
+	if !ok || now.Sub(failures.LastFailureAt) > resetAfter {
+		failures = models.LoginFailures{Key: key}
+	}
+	failures.Count++
+	failures.LastFailureAt = now
+	db.loginFailures[key] = failures
+	return &failures, nil
+}
+
+func (db *Storage) GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	failures, ok := db.loginFailures[key]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &failures, nil
+}
+
+func (db *Storage) ResetLoginFailures(ctx context.Context, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.loginFailures, key)
+	return nil
+}
+
+func (db *Storage) DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deleted int64
+	for key, failures := range db.loginFailures {
+		if failures.LastFailureAt.Before(before) {
+			delete(db.loginFailures, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.MFAStorage = (*Storage)(nil)
+
+func (db *Storage) GetTOTP(ctx context.Context, login string) (*models.TOTP, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	totp, ok := db.totp[login]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &totp, nil
+}
+
+func (db *Storage) SaveTOTP(ctx context.Context, totp *models.TOTP) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.totp[totp.Login] = *totp
+	return nil
+}
+
+func (db *Storage) DeleteTOTP(ctx context.Context, login string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.totp[login]; !ok {
+		return errors.ErrNotFound
+	}
+	delete(db.totp, login)
+	return nil
+}
+
+func (db *Storage) UseTOTPStep(ctx context.Context, login string, step int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	totp, ok := db.totp[login]
+	if !ok || totp.LastUsedStep >= step {
+		return errors.ErrNotFound
+	}
+	totp.LastUsedStep = step
+	db.totp[login] = totp
+	return nil
+}
+
+func (db *Storage) ReplaceRecoveryCodes(ctx context.Context, login string, hashes []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(hashes) == 0 {
+		delete(db.recoveryCodes, login)
+		return nil
+	}
+	codes := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = struct{}{}
+	}
+	db.recoveryCodes[login] = codes
+	return nil
+}
+
+func (db *Storage) UseRecoveryCode(ctx context.Context, login, hash string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.recoveryCodes[login][hash]; !ok {
+		return errors.ErrNotFound
+	}
+	delete(db.recoveryCodes[login], hash)
+	return nil
+}
+
+func (db *Storage) CountRecoveryCodes(ctx context.Context, login string) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.recoveryCodes[login]), nil
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.RateLimitStorage = (*Storage)(nil)
+
+func (db *Storage) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	bucket, ok := db.rateLimits[key]
+	if !ok {
+		bucket = models.RateLimitBucket{Key: key, Tokens: float64(burst), UpdatedAt: now}
+	}
+	if elapsed := now.Sub(bucket.UpdatedAt); elapsed > 0 {
+		bucket.Tokens = math.Min(float64(burst), bucket.Tokens+elapsed.Seconds()*rate)
+		bucket.UpdatedAt = now
+	}
+	allowed := bucket.Tokens >= 1
+	if allowed {
+		bucket.Tokens--
+	}
+	db.rateLimits[key] = bucket
+	if !allowed {
+		return false, time.Duration((1 - bucket.Tokens) / rate * float64(time.Second)), nil
+	}
+	return true, 0, nil
+}
+
+func (db *Storage) DeleteRateLimitsBefore(ctx context.Context, before time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deleted int64
+	for key, bucket := range db.rateLimits {
+		if bucket.UpdatedAt.Before(before) {
+			delete(db.rateLimits, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
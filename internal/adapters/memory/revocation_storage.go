@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.RevocationStorage = (*Storage)(nil)
+
+func (db *Storage) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.revoked[jti] = expiresAt
+	return nil
+}
+
+func (db *Storage) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	_, ok := db.revoked[jti]
+	return ok, nil
+}
+
+func (db *Storage) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deleted int64
+	for jti, expiresAt := range db.revoked {
+		if expiresAt.Before(now) {
+			delete(db.revoked, jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
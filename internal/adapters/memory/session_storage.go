@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.SessionStorage = (*Storage)(nil)
+
+func (db *Storage) CreateSession(ctx context.Context, session *models.Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.sessions[session.ID] = *session
+	return nil
+}
+
+func (db *Storage) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	session, ok := db.sessions[id]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &session, nil
+}
+
+func (db *Storage) UpdateSession(ctx context.Context, session *models.Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.sessions[session.ID]; !ok {
+		return errors.ErrNotFound
+	}
+	db.sessions[session.ID] = *session
+	return nil
+}
+
+func (db *Storage) ListSessions(ctx context.Context, login string) ([]models.Session, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	sessions := []models.Session{}
+	for _, session := range db.sessions {
+		if session.Login == login {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (db *Storage) DeleteSession(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.sessions[id]; !ok {
+		return errors.ErrNotFound
+	}
+	delete(db.sessions, id)
+	return nil
+}
+
+func (db *Storage) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deleted int64
+	for id, session := range db.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(db.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports/storagetest"
+)
+
+func open(t *testing.T) *Storage {
+	return New(zap.NewNop().Sugar())
+}
+
+func TestUserStorage(t *testing.T) {
+	storagetest.UserStorage(t, func(t *testing.T, users ...models.User) ports.UserStorage {
+		return open(t).Seed(users...)
+	})
+}
+
+func TestTokenStorage(t *testing.T) {
+	storagetest.TokenStorage(t, func(t *testing.T) ports.TokenStorage { return open(t) })
+}
+
+func TestRevocationStorage(t *testing.T) {
+	storagetest.RevocationStorage(t, func(t *testing.T) ports.RevocationStorage { return open(t) })
+}
+
+func TestSessionStorage(t *testing.T) {
+	storagetest.SessionStorage(t, func(t *testing.T) ports.SessionStorage { return open(t) })
+}
+
+func TestLoginAttemptStorage(t *testing.T) {
+	storagetest.LoginAttemptStorage(t, func(t *testing.T) ports.LoginAttemptStorage { return open(t) })
+}
+
+func TestRateLimitStorage(t *testing.T) {
+	storagetest.RateLimitStorage(t, func(t *testing.T) ports.RateLimitStorage { return open(t) })
+}
+
+func TestMFAStorage(t *testing.T) {
+	storagetest.MFAStorage(t, func(t *testing.T) ports.MFAStorage { return open(t) })
+}
+
+func TestWebAuthnStorage(t *testing.T) {
+	storagetest.WebAuthnStorage(t, func(t *testing.T) ports.WebAuthnStorage { return open(t) })
+}
+
+func TestAppPasswordStorage(t *testing.T) {
+	storagetest.AppPasswordStorage(t, func(t *testing.T) ports.AppPasswordStorage { return open(t) })
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.TokenStorage = (*Storage)(nil)
+
+func (db *Storage) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (db *Storage) UseRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	token, ok := db.refreshTokens[id]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	switch {
+	case token.Revoked:
+		return &token, errors.ErrTokenRevoked
+	case token.Used:
+		return &token, errors.ErrTokenReused
+	}
+	token.Used = true
+	db.refreshTokens[id] = token
+	return &token, nil
+}
+
+func (db *Storage) GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	token, ok := db.refreshTokens[id]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &token, nil
+}
+
+func (db *Storage) RevokeTokenFamily(ctx context.Context, family string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for id, token := range db.refreshTokens {
+		if token.Family == family {
+			token.Revoked = true
+			db.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (db *Storage) DeleteExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var deleted int64
+	for id, token := range db.refreshTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(db.refreshTokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.UserStorage = (*Storage)(nil)
+
+func (db *Storage) Get(ctx context.Context, login string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	user, ok := db.users[login]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (db *Storage) GetByAddress(ctx context.Context, address string) (*models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	for _, user := range db.users {
+		for _, a := range user.Addresses() {
+			if a == address {
+				return &user, nil
+			}
+		}
+	}
+	return nil, errors.ErrNotFound
+}
+
+func (db *Storage) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users := db.filterUsers(filter)
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Login < users[j].Login
+	})
+	return page(users, filter.Offset, filter.Limit), nil
+}
+
+func (db *Storage) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.filterUsers(filter)), nil
+}
+
+func (db *Storage) filterUsers(filter models.UserFilter) []models.User {
+	users := []models.User{}
+	for login, user := range db.users {
+		if strings.HasPrefix(login, filter.LoginPrefix) && (filter.Domain == "" || user.Domain == filter.Domain) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+func (db *Storage) Create(ctx context.Context, user *models.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[user.Login]; ok || db.addressTaken(user) {
+		return errors.ErrAlreadyExists
+	}
+	db.users[user.Login] = *user
+	return nil
+}
+
+func (db *Storage) Update(ctx context.Context, user *models.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[user.Login]; !ok {
+		return errors.ErrNotFound
+	}
+	if db.addressTaken(user) {
+		return errors.ErrAlreadyExists
+	}
+	db.users[user.Login] = *user
+	return nil
+}
+
+// addressTaken reports whether another user has the address or one of the
+// aliases of user, which are unique like logins.
+func (db *Storage) addressTaken(user *models.User) bool {
+	for login, other := range db.users {
+		if login == user.Login {
+			continue
+		}
+		for _, address := range other.Addresses() {
+			for _, own := range user.Addresses() {
+				if own == address {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (db *Storage) Delete(ctx context.Context, login string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[login]; !ok {
+		return errors.ErrNotFound
+	}
+	delete(db.users, login)
+	return nil
+}
+
+func page(users []models.User, offset, limit int) []models.User {
+	if offset > len(users) {
+		offset = len(users)
+	}
+	users = users[offset:]
+	if limit > 0 && limit < len(users) {
+		users = users[:limit]
+	}
+	return users
+}
@@ -0,0 +1,77 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.WebAuthnStorage = (*Storage)(nil)
+
+func (db *Storage) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.webauthn[string(credential.ID)]; ok {
+		return errors.ErrAlreadyExists
+	}
+	db.webauthn[string(credential.ID)] = *credential
+	return nil
+}
+
+func (db *Storage) GetWebAuthnCredential(ctx context.Context, id []byte) (*models.WebAuthnCredential, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	credential, ok := db.webauthn[string(id)]
+	if !ok {
+		return nil, errors.ErrNotFound
+	}
+	return &credential, nil
+}
+
+func (db *Storage) ListWebAuthnCredentials(ctx context.Context, login string) ([]models.WebAuthnCredential, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	credentials := []models.WebAuthnCredential{}
+	for _, credential := range db.webauthn {
+		if credential.Login == login {
+			credentials = append(credentials, credential)
+		}
+	}
+	sort.Slice(credentials, func(i, j int) bool {
+		return credentials[i].CreatedAt.Before(credentials[j].CreatedAt)
+	})
+	return credentials, nil
+}
+
+func (db *Storage) UseWebAuthnCredential(ctx context.Context, id []byte, old, new uint32, usedAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	credential, ok := db.webauthn[string(id)]
+	if !ok || credential.SignCount != old {
+		return errors.ErrNotFound
+	}
+	credential.SignCount = new
+	credential.LastUsedAt = usedAt
+	db.webauthn[string(id)] = credential
+	return nil
+}
+
+func (db *Storage) DeleteWebAuthnCredential(ctx context.Context, login string, id []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	credential, ok := db.webauthn[string(id)]
+	if !ok || credential.Login != login {
+		return errors.ErrNotFound
+	}
+	delete(db.webauthn, string(id))
+	return nil
+}
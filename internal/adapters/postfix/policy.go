@@ -0,0 +1,107 @@
+package postfix
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+// maxRequestSize bounds a policy request; Postfix sends well under 4 KiB.
+const maxRequestSize = 64 * 1024
+
+// Actions of the policy. DUNNO leaves the decision to the restrictions
+// that follow, so that this service only ever narrows what Postfix allows.
+const (
+	actionDunno = "DUNNO"
+	actionDefer = "DEFER_IF_PERMIT Service temporarily unavailable"
+)
+
+// serve answers the requests of one connection, which Postfix keeps open
+// for many.
+func (s *Server) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		attrs, err := readRequest(r)
+		if err != nil {
+			if !errors.Is(err, errEOF) && !s.isClosing() {
+				s.logger.Errorf("postfix policy request read failed: %s", err)
+			}
+			return
+		}
+		action := s.check(attrs)
+		if _, err := fmt.Fprintf(conn, "action=%s\n\n", action); err != nil {
+			return
+		}
+	}
+}
+
+var errEOF = errors.New("connection closed")
+
+// readRequest reads name=value lines up to the empty line that ends a
+// request.
+func readRequest(r *bufio.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	size := 0
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			if len(attrs) == 0 && l == "" {
+				return nil, errEOF
+			}
+			return nil, fmt.Errorf("truncated request: %w", err)
+		}
+		if size += len(l); size > maxRequestSize {
+			return nil, fmt.Errorf("request exceeds %d bytes", maxRequestSize)
+		}
+		l = strings.TrimSuffix(strings.TrimSuffix(l, "\n"), "\r")
+		if l == "" {
+			return attrs, nil
+		}
+		name, value, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed attribute %q", l)
+		}
+		attrs[name] = value
+	}
+}
+
+// check decides a request. Only mail from authenticated clients is judged:
+// without sasl_username, or with the null sender of bounces, it answers
+// DUNNO.
+func (s *Server) check(attrs map[string]string) string {
+	ctx := context.WithValue(context.Background(), utils.CtxKeyRequestIDGet(), uuid.NewString())
+	ctx = context.WithValue(ctx, utils.CtxKeyMethodGet(), "postfix")
+	ctx = context.WithValue(ctx, utils.CtxKeyURLGet(), attrs["protocol_state"])
+	ctx = context.WithValue(ctx, utils.CtxKeyRemoteIPGet(), attrs["client_address"])
+	logger := s.annotatedLogger(ctx)
+
+	if attrs["request"] != "smtpd_access_policy" {
+		logger.Errorf("postfix policy request %q is not supported", attrs["request"])
+		return actionDunno
+	}
+	login, sender := attrs["sasl_username"], attrs["sender"]
+	if login == "" || sender == "" {
+		return actionDunno
+	}
+
+	err := s.auth.CanSendAs(ctx, login, sender)
+	switch {
+	case err == nil:
+		logger.Infof("postfix sender %s of %s allowed", sender, login)
+		return actionDunno
+	case errors.Is(err, domainerrors.ErrForbidden), errors.Is(err, domainerrors.ErrNotFound):
+		return fmt.Sprintf("REJECT 5.7.1 <%s>: Sender address rejected: not owned by user %s", sender, login)
+	case errors.Is(err, domainerrors.ErrUserDisabled):
+		return fmt.Sprintf("REJECT 5.7.1 <%s>: Sender address rejected: user %s is disabled", sender, login)
+	default:
+		logger.Errorf("postfix sender check of %s failed: %s", login, err.Error())
+		return actionDefer
+	}
+}
@@ -0,0 +1,158 @@
+// Package postfix serves the Postfix SMTP access policy delegation protocol,
+// so that Postfix can check that an authenticated client sends mail only
+// from its own addresses:
+//
+//	smtpd_sender_restrictions = check_policy_service unix:private/auth-policy, ...
+package postfix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"go.uber.org/zap"
+)
+
+// socketMode lets the group of the service, which Postfix is added to,
+// connect to a UNIX socket.
+const socketMode = 0660
+
+type Server struct {
+	auth    ports.Auth
+	l       net.Listener
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closing bool
+	wg      sync.WaitGroup
+	logger  *zap.SugaredLogger
+}
+
+func New(logger *zap.SugaredLogger, auth ports.Auth) (*Server, error) {
+	cfg := config.GetConfig(logger).Postfix
+
+	if cfg.Network == "unix" {
+		removeStaleSocket(cfg.Address)
+	}
+	l, err := net.Listen(cfg.Network, cfg.Address)
+	if err != nil {
+		logger.Errorf("postfix policy listen on %s %s failed: %s", cfg.Network, cfg.Address, err)
+		return nil, fmt.Errorf("postfix policy listen on %s %s failed: %s", cfg.Network, cfg.Address, err)
+	}
+	if cfg.Network == "unix" {
+		if err := os.Chmod(cfg.Address, socketMode); err != nil {
+			l.Close()
+			logger.Errorf("postfix policy socket chmod failed: %s", err)
+			return nil, fmt.Errorf("postfix policy socket chmod failed: %s", err)
+		}
+	}
+	return newServer(logger, auth, l), nil
+}
+
+func newServer(logger *zap.SugaredLogger, auth ports.Auth, l net.Listener) *Server {
+	return &Server{
+		auth:   auth,
+		l:      l,
+		conns:  map[net.Conn]struct{}{},
+		logger: logger,
+	}
+}
+
+// removeStaleSocket deletes a socket file left behind by a previous run.
+func removeStaleSocket(path string) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+}
+
+func (s *Server) annotatedLogger(ctx context.Context) *zap.SugaredLogger {
+	request_id, _ := ctx.Value(utils.CtxKeyRequestIDGet()).(string)
+	method, _ := ctx.Value(utils.CtxKeyMethodGet()).(string)
+	url, _ := ctx.Value(utils.CtxKeyURLGet()).(string)
+
+	return s.logger.With(
+		"request_id", request_id,
+		"method", method,
+		"url", url,
+	)
+}
+
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+func (s *Server) Start() error {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			if s.isClosing() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serve(conn)
+		}()
+	}
+}
+
+// Stop closes the listener and all client connections and waits for
+// running policy checks to finish.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return err
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+	conn.Close()
+}
+
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closing
+}
@@ -0,0 +1,112 @@
+package postfix
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"go.uber.org/zap"
+)
+
+// fakeAuth lets alice send as alice@example.com; carol is disabled and the
+// storage of dave is down.
+type fakeAuth struct {
+	ports.Auth
+}
+
+func (fakeAuth) CanSendAs(ctx context.Context, login, sender string) error {
+	switch login {
+	case "alice":
+		if strings.EqualFold(sender, "alice@example.com") {
+			return nil
+		}
+		return domainerrors.ErrForbidden
+	case "carol":
+		return domainerrors.ErrUserDisabled
+	case "dave":
+		return fmt.Errorf("connection refused")
+	}
+	return domainerrors.ErrNotFound
+}
+
+// TestPolicy replays requests recorded from Postfix 3.7 over one
+// connection, as Postfix reuses it.
+func TestPolicy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %s", err)
+	}
+	s := newServer(zap.NewNop().Sugar(), fakeAuth{}, l)
+	go s.Start()
+	defer s.Stop(context.Background())
+
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatalf("dial failed: %s", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cases := []struct {
+		request string
+		action  string
+	}{
+		{"own_sender", "DUNNO"},
+		{"own_sender_case", "DUNNO"},
+		{"foreign_sender", "REJECT 5.7.1 <ceo@example.com>: Sender address rejected: not owned by user alice"},
+		{"unknown_user", "REJECT 5.7.1 <mallory@example.com>: Sender address rejected: not owned by user mallory"},
+		{"disabled_user", "REJECT 5.7.1 <carol@example.com>: Sender address rejected: user carol is disabled"},
+		{"null_sender", "DUNNO"},
+		{"unauthenticated", "DUNNO"},
+		{"storage_down", "DEFER_IF_PERMIT Service temporarily unavailable"},
+	}
+	for _, c := range cases {
+		t.Run(c.request, func(t *testing.T) {
+			request, err := os.ReadFile(filepath.Join("testdata", c.request+".txt"))
+			if err != nil {
+				t.Fatalf("read request failed: %s", err)
+			}
+			if _, err := conn.Write(request); err != nil {
+				t.Fatalf("write failed: %s", err)
+			}
+			action, _ := r.ReadString('\n')
+			if empty, _ := r.ReadString('\n'); empty != "\n" {
+				t.Fatalf("Expected an empty line, but was %q", empty)
+			}
+			if want := "action=" + c.action + "\n"; action != want {
+				t.Fatalf("Expected %q, but was %q", want, action)
+			}
+		})
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	cases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"complete", "request=smtpd_access_policy\nsender=a=b@example.com\n\n", false},
+		{"truncated", "request=smtpd_access_policy\nsender=", true},
+		{"without value", "request=smtpd_access_policy\nsender\n\n", true},
+		{"oversized", "ccert_subject=" + strings.Repeat("x", maxRequestSize) + "\n\n", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			attrs, err := readRequest(bufio.NewReader(strings.NewReader(c.input)))
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Expected error %t, but was %v", c.wantErr, err)
+			}
+			if err == nil && attrs["sender"] != "a=b@example.com" {
+				t.Fatalf("Expected a=b@example.com, but was %q", attrs["sender"])
+			}
+		})
+	}
+}
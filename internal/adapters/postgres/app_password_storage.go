@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.AppPasswordStorage = (*Database)(nil)
+
+const appPasswordColumns = "id, login, name, hash, scopes, created_at, last_used_at"
+
+func (db *Database) CreateAppPassword(ctx context.Context, password *models.AppPassword) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		"INSERT INTO app_passwords ("+appPasswordColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		password.ID, password.Login, password.Name, password.Hash, password.Scopes,
+		password.CreatedAt, nullTime(password.LastUsedAt))
+	if isUniqueViolation(err) {
+		return errors.ErrAlreadyExists
+	}
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) ListAppPasswords(ctx context.Context, login string) ([]models.AppPassword, error) {
+	logger := db.annotatedLogger(ctx)
+
+	rows, err := db.DB.Query(ctx,
+		"SELECT "+appPasswordColumns+" FROM app_passwords WHERE login = $1 ORDER BY created_at", login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return nil, fmt.Errorf("query exec failed: %s", err)
+	}
+	defer rows.Close()
+
+	passwords := []models.AppPassword{}
+	for rows.Next() {
+		password, err := scanAppPassword(rows)
+		if err != nil {
+			logger.Errorf("scan exec failed: %s", err)
+			return nil, fmt.Errorf("scan exec failed: %s", err)
+		}
+		passwords = append(passwords, *password)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("rows iteration failed: %s", err)
+		return nil, fmt.Errorf("rows iteration failed: %s", err)
+	}
+	return passwords, nil
+}
+
+func (db *Database) UseAppPassword(ctx context.Context, id string, usedAt time.Time) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "UPDATE app_passwords SET last_used_at = $2 WHERE id = $1", id, usedAt)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) DeleteAppPassword(ctx context.Context, login, id string) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM app_passwords WHERE id = $1 AND login = $2", id, login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func scanAppPassword(row pgx.Row) (*models.AppPassword, error) {
+	var (
+		password   models.AppPassword
+		lastUsedAt *time.Time
+	)
+	err := row.Scan(&password.ID, &password.Login, &password.Name, &password.Hash, &password.Scopes,
+		&password.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt != nil {
+		password.LastUsedAt = *lastUsedAt
+	}
+	return &password, nil
+}
@@ -30,6 +30,10 @@ func New(ctx context.Context, logger *zap.SugaredLogger, pgconn string) (*Databa
 	return &Database{DB: pool, logger: logger}, nil
 }
 
+func (db *Database) Close() {
+	db.DB.Close()
+}
+
 func (db *Database) annotatedLogger(ctx context.Context) *zap.SugaredLogger {
 	request_id, _ := ctx.Value(utils.CtxKeyRequestIDGet()).(string)
 	method, _ := ctx.Value(utils.CtxKeyMethodGet()).(string)
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.LoginAttemptStorage = (*Database)(nil)
+
+const loginFailuresColumns = "key, count, last_failure_at"
+
+func (db *Database) RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAfter time.Duration) (*models.LoginFailures, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx,
+		`INSERT INTO login_failures AS f (`+loginFailuresColumns+`) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN f.last_failure_at < $2 - $3::interval THEN 1 ELSE f.count + 1 END,
+			last_failure_at = $2
+		RETURNING `+loginFailuresColumns,
+		key, now, resetAfter)
+	failures, err := scanLoginFailures(row)
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return failures, nil
+}
+
+func (db *Database) GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx, "SELECT "+loginFailuresColumns+" FROM login_failures WHERE key = $1", key)
+	failures, err := scanLoginFailures(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return failures, nil
+}
+
+func (db *Database) ResetLoginFailures(ctx context.Context, key string) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx, "DELETE FROM login_failures WHERE key = $1", key)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error) {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM login_failures WHERE last_failure_at < $1", before)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return 0, fmt.Errorf("query exec failed: %s", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanLoginFailures(row pgx.Row) (*models.LoginFailures, error) {
+	var failures models.LoginFailures
+	if err := row.Scan(&failures.Key, &failures.Count, &failures.LastFailureAt); err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.MFAStorage = (*Database)(nil)
+
+const totpColumns = "login, secret, confirmed, last_used_step, created_at"
+
+func (db *Database) GetTOTP(ctx context.Context, login string) (*models.TOTP, error) {
+	logger := db.annotatedLogger(ctx)
+
+	var totp models.TOTP
+	err := db.DB.QueryRow(ctx, "SELECT "+totpColumns+" FROM totp WHERE login = $1", login).
+		Scan(&totp.Login, &totp.Secret, &totp.Confirmed, &totp.LastUsedStep, &totp.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return &totp, nil
+}
+
+func (db *Database) SaveTOTP(ctx context.Context, totp *models.TOTP) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		`INSERT INTO totp (`+totpColumns+`) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (login) DO UPDATE SET
+			secret = $2, confirmed = $3, last_used_step = $4, created_at = $5`,
+		totp.Login, totp.Secret, totp.Confirmed, totp.LastUsedStep, totp.CreatedAt)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteTOTP(ctx context.Context, login string) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM totp WHERE login = $1", login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) UseTOTPStep(ctx context.Context, login string, step int64) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx,
+		"UPDATE totp SET last_used_step = $2 WHERE login = $1 AND last_used_step < $2", login, step)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps the codes in one transaction so that a failed
+// regeneration keeps the old batch.
+func (db *Database) ReplaceRecoveryCodes(ctx context.Context, login string, hashes []string) error {
+	logger := db.annotatedLogger(ctx)
+
+	err := db.DB.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE login = $1", login); err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if _, err := tx.Exec(ctx, "INSERT INTO recovery_codes (login, hash) VALUES ($1, $2)", login, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) UseRecoveryCode(ctx context.Context, login, hash string) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM recovery_codes WHERE login = $1 AND hash = $2", login, hash)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) CountRecoveryCodes(ctx context.Context, login string) (int, error) {
+	logger := db.annotatedLogger(ctx)
+
+	var count int
+	if err := db.DB.QueryRow(ctx, "SELECT count(*) FROM recovery_codes WHERE login = $1", login).Scan(&count); err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return 0, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,236 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID serialises migrations run by several replicas at once.
+const migrationLockID = 0x6d61696c61757468
+
+type migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus describes a known migration and whether it is applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded <version>_<name>.(up|down).sql files
+// ordered by version.
+func loadMigrations(files fs.FS) ([]migration, error) {
+	names, err := fs.Glob(files, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, path := range names {
+		base := strings.TrimPrefix(path, "migrations/")
+		stem, direction, ok := cutDirection(base)
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql suffix", base)
+		}
+		prefix, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: expected <version>_<name> file name", base)
+		}
+		body, err := fs.ReadFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(body)
+		} else {
+			m.down = string(body)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func cutDirection(name string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		if stem := strings.TrimSuffix(name, "."+direction+".sql"); stem != name {
+			return stem, direction, true
+		}
+	}
+	return "", "", false
+}
+
+// MigrateUp applies every pending migration and returns the applied versions.
+func (db *Database) MigrateUp(ctx context.Context) ([]int, error) {
+	var applied []int
+	err := db.withMigrationLock(ctx, func(conn *pgx.Conn, migrations []migration, done map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := runMigration(ctx, conn, m.up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, now())", m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %s", m.Version, m.Name, err)
+			}
+			db.logger.Infof("migration %d_%s applied", m.Version, m.Name)
+			applied = append(applied, m.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the latest steps applied migrations and returns the
+// reverted versions.
+func (db *Database) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+	var reverted []int
+	err := db.withMigrationLock(ctx, func(conn *pgx.Conn, migrations []migration, done map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+			}
+			err := runMigration(ctx, conn, m.down, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s revert failed: %s", m.Version, m.Name, err)
+			}
+			db.logger.Infof("migration %d_%s reverted", m.Version, m.Name)
+			reverted = append(reverted, m.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus lists the known migrations in version order.
+func (db *Database) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var status []MigrationStatus
+	err := db.withMigrationLock(ctx, func(conn *pgx.Conn, migrations []migration, done map[int]time.Time) error {
+		for _, m := range migrations {
+			s := MigrationStatus{Version: m.Version, Name: m.Name}
+			if at, ok := done[m.Version]; ok {
+				s.AppliedAt = &at
+			}
+			status = append(status, s)
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (db *Database) withMigrationLock(ctx context.Context, fn func(*pgx.Conn, []migration, map[int]time.Time) error) error {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		db.logger.Errorf("load migrations failed: %s", err)
+		return fmt.Errorf("load migrations failed: %s", err)
+	}
+
+	conn, err := db.DB.Acquire(ctx)
+	if err != nil {
+		db.logger.Errorf("acquire connection failed: %s", err)
+		return fmt.Errorf("acquire connection failed: %s", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		db.logger.Errorf("migration lock failed: %s", err)
+		return fmt.Errorf("migration lock failed: %s", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID) //nolint:errcheck
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)`)
+	if err != nil {
+		db.logger.Errorf("create migrations table failed: %s", err)
+		return fmt.Errorf("create migrations table failed: %s", err)
+	}
+
+	done, err := appliedMigrations(ctx, conn.Conn())
+	if err != nil {
+		db.logger.Errorf("read migrations table failed: %s", err)
+		return fmt.Errorf("read migrations table failed: %s", err)
+	}
+	if err := fn(conn.Conn(), migrations, done); err != nil {
+		db.logger.Errorf(err.Error())
+		return err
+	}
+	return nil
+}
+
+func appliedMigrations(ctx context.Context, conn *pgx.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+// runMigration executes script and the bookkeeping statement in one
+// transaction.
+func runMigration(ctx context.Context, conn *pgx.Conn, script, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("embedded migrations are invalid: %s", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.down == "" {
+			t.Fatalf("Expected migration %d with down script, but was %d_%s", i+1, m.Version, m.Name)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "no direction", files: fstest.MapFS{"migrations/0001_users.sql": {}}},
+		{name: "no version", files: fstest.MapFS{"migrations/users.up.sql": {}}},
+		{name: "no up script", files: fstest.MapFS{"migrations/0001_users.down.sql": {Data: []byte("DROP")}}},
+		{name: "name conflict", files: fstest.MapFS{
+			"migrations/0001_users.up.sql":    {Data: []byte("CREATE")},
+			"migrations/0001_logins.down.sql": {Data: []byte("DROP")},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := loadMigrations(c.files); err == nil {
+				t.Fatalf("Expected error")
+			}
+		})
+	}
+}
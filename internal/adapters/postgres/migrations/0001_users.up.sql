@@ -0,0 +1,4 @@
+CREATE TABLE users (
+    login    TEXT PRIMARY KEY,
+    password TEXT NOT NULL
+);
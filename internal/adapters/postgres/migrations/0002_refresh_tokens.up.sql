@@ -0,0 +1,11 @@
+CREATE TABLE refresh_tokens (
+    id         TEXT PRIMARY KEY,
+    family     TEXT NOT NULL,
+    login      TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used       BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked    BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family);
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
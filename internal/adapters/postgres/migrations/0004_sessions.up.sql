@@ -0,0 +1,14 @@
+CREATE TABLE sessions (
+    id               TEXT PRIMARY KEY,
+    login            TEXT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL,
+    last_seen_at     TIMESTAMPTZ NOT NULL,
+    expires_at       TIMESTAMPTZ NOT NULL,
+    user_agent       TEXT NOT NULL DEFAULT '',
+    ip               TEXT NOT NULL DEFAULT '',
+    access_token_id  TEXT NOT NULL DEFAULT '',
+    refresh_token_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX sessions_login_idx ON sessions (login);
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
@@ -0,0 +1,7 @@
+CREATE TABLE login_failures (
+    key             TEXT PRIMARY KEY,
+    count           INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX login_failures_last_failure_at_idx ON login_failures (last_failure_at);
@@ -0,0 +1,7 @@
+CREATE TABLE totp (
+    login          TEXT PRIMARY KEY,
+    secret         TEXT NOT NULL,
+    confirmed      BOOLEAN NOT NULL DEFAULT false,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE recovery_codes (
+    login TEXT NOT NULL,
+    hash  TEXT NOT NULL,
+    PRIMARY KEY (login, hash)
+);
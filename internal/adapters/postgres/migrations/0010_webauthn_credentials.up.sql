@@ -0,0 +1,12 @@
+CREATE TABLE webauthn_credentials (
+    id           BYTEA PRIMARY KEY,
+    login        TEXT NOT NULL,
+    name         TEXT NOT NULL DEFAULT '',
+    public_key   BYTEA NOT NULL,
+    sign_count   BIGINT NOT NULL DEFAULT 0,
+    aaguid       BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX webauthn_credentials_login_idx ON webauthn_credentials (login);
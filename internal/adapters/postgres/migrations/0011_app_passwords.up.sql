@@ -0,0 +1,11 @@
+CREATE TABLE app_passwords (
+    id           TEXT PRIMARY KEY,
+    login        TEXT NOT NULL,
+    name         TEXT NOT NULL DEFAULT '',
+    hash         TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX app_passwords_login_idx ON app_passwords (login);
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN scram_sha256 TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+DROP INDEX users_aliases_idx;
+DROP INDEX users_address_idx;
+
+ALTER TABLE users
+    DROP COLUMN display_name,
+    DROP COLUMN aliases,
+    DROP COLUMN domain,
+    DROP COLUMN address;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN address      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN domain       TEXT NOT NULL DEFAULT '',
+    ADD COLUMN aliases      TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_address_idx ON users (address) WHERE address <> '';
+CREATE INDEX users_aliases_idx ON users USING GIN (aliases);
@@ -0,0 +1 @@
+CREATE INDEX users_domain_idx ON users (domain, login) WHERE domain <> '';
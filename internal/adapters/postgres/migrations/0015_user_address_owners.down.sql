@@ -0,0 +1,3 @@
+CREATE INDEX users_aliases_idx ON users USING GIN (aliases);
+
+DROP TABLE user_addresses;
@@ -0,0 +1,13 @@
+CREATE TABLE user_addresses (
+    address TEXT PRIMARY KEY,
+    login   TEXT NOT NULL REFERENCES users (login) ON DELETE CASCADE
+);
+
+CREATE INDEX user_addresses_login_idx ON user_addresses (login);
+
+INSERT INTO user_addresses (address, login)
+    SELECT address, login FROM users WHERE address <> ''
+    UNION
+    SELECT unnest(aliases), login FROM users;
+
+DROP INDEX users_aliases_idx;
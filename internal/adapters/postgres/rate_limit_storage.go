@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.RateLimitStorage = (*Database)(nil)
+
+// refilledTokens is the content of bucket b at $4 before taking a token.
+// Buckets never refill backwards when replica clocks disagree.
+const refilledTokens = `LEAST($3::float8, b.tokens + GREATEST(EXTRACT(EPOCH FROM $4 - b.updated_at)::float8, 0) * $2::float8)`
+
+// TakeToken refills and takes in a single upsert so that concurrent replicas
+// never hand out the same token. The decision is stored in the allowed column
+// because the returned tokens alone cannot tell a taken token from a refused
+// one.
+func (db *Database) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	logger := db.annotatedLogger(ctx)
+
+	var (
+		allowed bool
+		tokens  float64
+	)
+	err := db.DB.QueryRow(ctx,
+		`INSERT INTO rate_limits AS b (key, tokens, allowed, updated_at) VALUES ($1, $3::float8 - 1, true, $4)
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE WHEN `+refilledTokens+` >= 1 THEN `+refilledTokens+` - 1 ELSE `+refilledTokens+` END,
+			allowed = `+refilledTokens+` >= 1,
+			updated_at = GREATEST(b.updated_at, $4)
+		RETURNING allowed, tokens`,
+		key, rate, burst, now).Scan(&allowed, &tokens)
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return false, 0, fmt.Errorf("scan exec failed: %s", err)
+	}
+	if !allowed {
+		return false, time.Duration((1 - tokens) / rate * float64(time.Second)), nil
+	}
+	return true, 0, nil
+}
+
+func (db *Database) DeleteRateLimitsBefore(ctx context.Context, before time.Time) (int64, error) {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM rate_limits WHERE updated_at < $1", before)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return 0, fmt.Errorf("query exec failed: %s", err)
+	}
+	return tag.RowsAffected(), nil
+}
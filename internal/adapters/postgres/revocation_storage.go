@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.RevocationStorage = (*Database)(nil)
+
+func (db *Database) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING", jti, expiresAt)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	logger := db.annotatedLogger(ctx)
+
+	var revoked bool
+	err := db.DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", jti).Scan(&revoked)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return false, fmt.Errorf("query exec failed: %s", err)
+	}
+	return revoked, nil
+}
+
+func (db *Database) DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error) {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at < $1", now)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return 0, fmt.Errorf("query exec failed: %s", err)
+	}
+	return tag.RowsAffected(), nil
+}
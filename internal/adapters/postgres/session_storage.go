@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.SessionStorage = (*Database)(nil)
+
+const sessionColumns = "id, login, created_at, last_seen_at, expires_at, user_agent, ip, access_token_id, refresh_token_id"
+
+func (db *Database) CreateSession(ctx context.Context, session *models.Session) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		"INSERT INTO sessions ("+sessionColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		session.ID, session.Login, session.CreatedAt, session.LastSeenAt, session.ExpiresAt,
+		session.UserAgent, session.IP, session.AccessTokenID, session.RefreshTokenID)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1", id)
+	session, err := scanSession(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return session, nil
+}
+
+func (db *Database) UpdateSession(ctx context.Context, session *models.Session) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx,
+		`UPDATE sessions SET last_seen_at = $2, expires_at = $3, user_agent = $4, ip = $5,
+		access_token_id = $6, refresh_token_id = $7 WHERE id = $1`,
+		session.ID, session.LastSeenAt, session.ExpiresAt, session.UserAgent, session.IP,
+		session.AccessTokenID, session.RefreshTokenID)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) ListSessions(ctx context.Context, login string) ([]models.Session, error) {
+	logger := db.annotatedLogger(ctx)
+
+	rows, err := db.DB.Query(ctx,
+		"SELECT "+sessionColumns+" FROM sessions WHERE login = $1 ORDER BY last_seen_at DESC", login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return nil, fmt.Errorf("query exec failed: %s", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			logger.Errorf("scan exec failed: %s", err)
+			return nil, fmt.Errorf("scan exec failed: %s", err)
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("rows iteration failed: %s", err)
+		return nil, fmt.Errorf("rows iteration failed: %s", err)
+	}
+	return sessions, nil
+}
+
+func (db *Database) DeleteSession(ctx context.Context, id string) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) DeleteExpiredSessions(ctx context.Context, now time.Time) (int64, error) {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM sessions WHERE expires_at < $1", now)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return 0, fmt.Errorf("query exec failed: %s", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanSession(row pgx.Row) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.ID, &session.Login, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt,
+		&session.UserAgent, &session.IP, &session.AccessTokenID, &session.RefreshTokenID)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports/storagetest"
+)
+
+// open connects to the database in PG_TEST_URL, migrates it and empties
+// every table. The tests are skipped without it.
+func open(t *testing.T) *Database {
+	url := os.Getenv("PG_TEST_URL")
+	if url == "" {
+		t.Skip("PG_TEST_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := New(ctx, zap.NewNop().Sugar(), url)
+	if err != nil {
+		t.Fatalf("connect failed: %s", err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.MigrateUp(ctx); err != nil {
+		t.Fatalf("migrate failed: %s", err)
+	}
+	if _, err := db.DB.Exec(ctx, "TRUNCATE users, user_addresses, refresh_tokens, revoked_tokens, sessions, login_failures, rate_limits, totp, recovery_codes, webauthn_credentials, app_passwords"); err != nil {
+		t.Fatalf("truncate failed: %s", err)
+	}
+	return db
+}
+
+func TestUserStorage(t *testing.T) {
+	storagetest.UserStorage(t, func(t *testing.T, users ...models.User) ports.UserStorage {
+		db := open(t)
+		for _, user := range users {
+			if err := db.Create(context.Background(), &user); err != nil {
+				t.Fatalf("seed failed: %s", err)
+			}
+		}
+		return db
+	})
+}
+
+func TestTokenStorage(t *testing.T) {
+	storagetest.TokenStorage(t, func(t *testing.T) ports.TokenStorage { return open(t) })
+}
+
+func TestRevocationStorage(t *testing.T) {
+	storagetest.RevocationStorage(t, func(t *testing.T) ports.RevocationStorage { return open(t) })
+}
+
+func TestSessionStorage(t *testing.T) {
+	storagetest.SessionStorage(t, func(t *testing.T) ports.SessionStorage { return open(t) })
+}
+
+func TestLoginAttemptStorage(t *testing.T) {
+	storagetest.LoginAttemptStorage(t, func(t *testing.T) ports.LoginAttemptStorage { return open(t) })
+}
+
+func TestRateLimitStorage(t *testing.T) {
+	storagetest.RateLimitStorage(t, func(t *testing.T) ports.RateLimitStorage { return open(t) })
+}
+
+func TestMFAStorage(t *testing.T) {
+	storagetest.MFAStorage(t, func(t *testing.T) ports.MFAStorage { return open(t) })
+}
+
+func TestWebAuthnStorage(t *testing.T) {
+	storagetest.WebAuthnStorage(t, func(t *testing.T) ports.WebAuthnStorage { return open(t) })
+}
+
+func TestAppPasswordStorage(t *testing.T) {
+	storagetest.AppPasswordStorage(t, func(t *testing.T) ports.AppPasswordStorage { return open(t) })
+}
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.TokenStorage = (*Database)(nil)
+
+const refreshTokenColumns = "id, family, login, expires_at, used, revoked"
+
+func (db *Database) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		"INSERT INTO refresh_tokens ("+refreshTokenColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+		token.ID, token.Family, token.Login, token.ExpiresAt, token.Used, token.Revoked)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) UseRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx,
+		"UPDATE refresh_tokens SET used = TRUE WHERE id = $1 AND NOT used AND NOT revoked RETURNING "+refreshTokenColumns, id)
+	token, err := scanRefreshToken(row)
+	if err == nil {
+		return token, nil
+	}
+	if err != pgx.ErrNoRows {
+		logger.Errorf("query exec failed: %s", err)
+		return nil, fmt.Errorf("query exec failed: %s", err)
+	}
+
+	token, err = db.GetRefreshToken(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if token.Revoked {
+		return token, errors.ErrTokenRevoked
+	}
+	return token, errors.ErrTokenReused
+}
+
+func (db *Database) GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE id = $1", id)
+	token, err := scanRefreshToken(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return token, nil
+}
+
+func (db *Database) RevokeTokenFamily(ctx context.Context, family string) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE family = $1", family)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) DeleteExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM refresh_tokens WHERE expires_at < $1", now)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return 0, fmt.Errorf("query exec failed: %s", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanRefreshToken(row pgx.Row) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := row.Scan(&token.ID, &token.Family, &token.Login, &token.ExpiresAt, &token.Used, &token.Revoked)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
@@ -11,25 +13,201 @@ import (
 
 var _ ports.UserStorage = (*Database)(nil)
 
+const (
+	userColumns     = "login, address, domain, aliases, display_name, password, scram_sha256, role, disabled"
+	uniqueViolation = "23505"
+)
+
 func (db *Database) Get(ctx context.Context, login string) (*models.User, error) {
 	logger := db.annotatedLogger(ctx)
-	var user models.User
 
-	rows, err := db.DB.Query(ctx, "SELECT users.login as login, users.Password as Password FROM users WHERE users.login = $1", login)
+	row := db.DB.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE login = $1", login)
+	user, err := scanUser(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+
+	return user, nil
+}
+
+func (db *Database) GetByAddress(ctx context.Context, address string) (*models.User, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx,
+		"SELECT "+userColumns+" FROM users WHERE login = (SELECT login FROM user_addresses WHERE address = $1)", address)
+	user, err := scanUser(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+
+	return user, nil
+}
+
+func (db *Database) List(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	logger := db.annotatedLogger(ctx)
+
+	rows, err := db.DB.Query(ctx,
+		`SELECT `+userColumns+` FROM users
+		WHERE left(login, length($1)) = $1 AND ($4 = '' OR domain = $4)
+		ORDER BY login OFFSET $2 LIMIT NULLIF($3, 0)`,
+		filter.LoginPrefix, filter.Offset, filter.Limit, filter.Domain)
 	if err != nil {
 		logger.Errorf("query exec failed: %s", err)
 		return nil, fmt.Errorf("query exec failed: %s", err)
 	}
+	defer rows.Close()
 
-	if !rows.Next() {
-		return nil, errors.ErrNotFound
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			logger.Errorf("scan exec failed: %s", err)
+			return nil, fmt.Errorf("scan exec failed: %s", err)
+		}
+		users = append(users, *user)
 	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("rows iteration failed: %s", err)
+		return nil, fmt.Errorf("rows iteration failed: %s", err)
+	}
+
+	return users, nil
+}
+
+func (db *Database) Count(ctx context.Context, filter models.UserFilter) (int, error) {
+	logger := db.annotatedLogger(ctx)
 
-	err = rows.Scan(&user.Login, &user.PasswordHash)
+	var count int
+	err := db.DB.QueryRow(ctx,
+		"SELECT count(*) FROM users WHERE left(login, length($1)) = $1 AND ($2 = '' OR domain = $2)",
+		filter.LoginPrefix, filter.Domain).Scan(&count)
 	if err != nil {
 		logger.Errorf("scan exec failed: %s", err)
-		return nil, fmt.Errorf("scan exec failed: %s", err)
+		return 0, fmt.Errorf("scan exec failed: %s", err)
 	}
 
+	return count, nil
+}
+
+// Create inserts user and claims its addresses in user_addresses, where
+// each address has one owner.
+func (db *Database) Create(ctx context.Context, user *models.User) error {
+	logger := db.annotatedLogger(ctx)
+
+	err := db.DB.BeginFunc(ctx, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "INSERT INTO users ("+userColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			user.Login, user.Address, user.Domain, aliases(user), user.DisplayName, user.PasswordHash, user.SCRAMSHA256, user.Role, user.Disabled)
+		if err != nil {
+			return err
+		}
+		return claimAddresses(ctx, tx, user)
+	})
+	if isUniqueViolation(err) {
+		return errors.ErrAlreadyExists
+	}
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+
+	return nil
+}
+
+// Update replaces user and its addresses in one transaction, so a taken
+// address leaves both unchanged.
+func (db *Database) Update(ctx context.Context, user *models.User) error {
+	logger := db.annotatedLogger(ctx)
+
+	err := db.DB.BeginFunc(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx,
+			`UPDATE users SET address = $2, domain = $3, aliases = $4, display_name = $5,
+			password = $6, scram_sha256 = $7, role = $8, disabled = $9 WHERE login = $1`,
+			user.Login, user.Address, user.Domain, aliases(user), user.DisplayName, user.PasswordHash, user.SCRAMSHA256, user.Role, user.Disabled)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return errors.ErrNotFound
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM user_addresses WHERE login = $1", user.Login); err != nil {
+			return err
+		}
+		return claimAddresses(ctx, tx, user)
+	})
+	if err == errors.ErrNotFound {
+		return err
+	}
+	if isUniqueViolation(err) {
+		return errors.ErrAlreadyExists
+	}
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+
+	return nil
+}
+
+// claimAddresses records user as the owner of its addresses. The primary key
+// of user_addresses fails the claim of an address another user owns.
+func claimAddresses(ctx context.Context, tx pgx.Tx, user *models.User) error {
+	claimed := map[string]bool{}
+	for _, address := range user.Addresses() {
+		if claimed[address] {
+			continue
+		}
+		claimed[address] = true
+		if _, err := tx.Exec(ctx, "INSERT INTO user_addresses (address, login) VALUES ($1, $2)", address, user.Login); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) Delete(ctx context.Context, login string) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM users WHERE login = $1", login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	if err := row.Scan(&user.Login, &user.Address, &user.Domain, &user.Aliases, &user.DisplayName,
+		&user.PasswordHash, &user.SCRAMSHA256, &user.Role, &user.Disabled); err != nil {
+		return nil, err
+	}
+	if len(user.Aliases) == 0 {
+		user.Aliases = nil
+	}
 	return &user, nil
 }
+
+// aliases stores users without aliases as an empty array rather than NULL.
+func aliases(user *models.User) []string {
+	if user.Aliases == nil {
+		return []string{}
+	}
+	return user.Aliases
+}
+
+func isUniqueViolation(err error) bool {
+	pgErr, ok := err.(*pgconn.PgError)
+	return ok && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+var _ ports.WebAuthnStorage = (*Database)(nil)
+
+const webauthnColumns = "id, login, name, public_key, sign_count, aaguid, created_at, last_used_at"
+
+func (db *Database) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	logger := db.annotatedLogger(ctx)
+
+	_, err := db.DB.Exec(ctx,
+		"INSERT INTO webauthn_credentials ("+webauthnColumns+") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		credential.ID, credential.Login, credential.Name, credential.PublicKey, int64(credential.SignCount),
+		credential.AAGUID, credential.CreatedAt, nullTime(credential.LastUsedAt))
+	if isUniqueViolation(err) {
+		return errors.ErrAlreadyExists
+	}
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	return nil
+}
+
+func (db *Database) GetWebAuthnCredential(ctx context.Context, id []byte) (*models.WebAuthnCredential, error) {
+	logger := db.annotatedLogger(ctx)
+
+	row := db.DB.QueryRow(ctx, "SELECT "+webauthnColumns+" FROM webauthn_credentials WHERE id = $1", id)
+	credential, err := scanWebAuthnCredential(row)
+	if err == pgx.ErrNoRows {
+		return nil, errors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("scan exec failed: %s", err)
+		return nil, fmt.Errorf("scan exec failed: %s", err)
+	}
+	return credential, nil
+}
+
+func (db *Database) ListWebAuthnCredentials(ctx context.Context, login string) ([]models.WebAuthnCredential, error) {
+	logger := db.annotatedLogger(ctx)
+
+	rows, err := db.DB.Query(ctx,
+		"SELECT "+webauthnColumns+" FROM webauthn_credentials WHERE login = $1 ORDER BY created_at", login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return nil, fmt.Errorf("query exec failed: %s", err)
+	}
+	defer rows.Close()
+
+	credentials := []models.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			logger.Errorf("scan exec failed: %s", err)
+			return nil, fmt.Errorf("scan exec failed: %s", err)
+		}
+		credentials = append(credentials, *credential)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Errorf("rows iteration failed: %s", err)
+		return nil, fmt.Errorf("rows iteration failed: %s", err)
+	}
+	return credentials, nil
+}
+
+func (db *Database) UseWebAuthnCredential(ctx context.Context, id []byte, old, new uint32, usedAt time.Time) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx,
+		"UPDATE webauthn_credentials SET sign_count = $3, last_used_at = $4 WHERE id = $1 AND sign_count = $2",
+		id, int64(old), int64(new), usedAt)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func (db *Database) DeleteWebAuthnCredential(ctx context.Context, login string, id []byte) error {
+	logger := db.annotatedLogger(ctx)
+
+	tag, err := db.DB.Exec(ctx, "DELETE FROM webauthn_credentials WHERE id = $1 AND login = $2", id, login)
+	if err != nil {
+		logger.Errorf("query exec failed: %s", err)
+		return fmt.Errorf("query exec failed: %s", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+func scanWebAuthnCredential(row pgx.Row) (*models.WebAuthnCredential, error) {
+	var (
+		credential models.WebAuthnCredential
+		signCount  int64
+		lastUsedAt *time.Time
+	)
+	err := row.Scan(&credential.ID, &credential.Login, &credential.Name, &credential.PublicKey, &signCount,
+		&credential.AAGUID, &credential.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+	if lastUsedAt != nil {
+		credential.LastUsedAt = *lastUsedAt
+	}
+	return &credential, nil
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,39 @@
+package application
+
+import (
+	"context"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/auth"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"go.uber.org/zap"
+)
+
+// Operator is the actor of changes made with command-line tools, which may
+// manage every user.
+var Operator = &models.User{Login: "operator", Role: models.RoleAdmin}
+
+// Admin gives command-line tools direct access to the auth service backed by
+// the configured storage, without starting the servers.
+type Admin struct {
+	*auth.Service
+	Driver string
+	close  func()
+}
+
+func OpenAdmin(ctx context.Context, log *zap.Logger) (*Admin, error) {
+	cfg := config.GetConfig(log.Sugar())
+	db, err := newStorage(ctx, cfg, log.Sugar())
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{
+		Service: auth.New(db.users, db.tokens, db.revoked, db.sessions, db.attempts, db.mfa, db.webauthn, db.apps, log.Sugar()),
+		Driver:  cfg.Storage.Driver,
+		close:   db.close,
+	}, nil
+}
+
+func (a *Admin) Close() {
+	a.close()
+}
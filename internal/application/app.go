@@ -3,14 +3,16 @@ package application
 import (
 	"context"
 	"fmt"
-	"os"
 
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/dovecot"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/grpc"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/postfix"
 
 	"github.com/TheZeroSlave/zapsentry"
-	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/data_file"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/http"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/auth"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/ratelimit"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
@@ -19,7 +21,11 @@ import (
 var (
 	hs     *http.Server
 	gs     *grpc.Server
+	ds     *dovecot.Server
+	ps     *postfix.Server
 	logger *zap.Logger
+
+	closeStorage = func() {}
 )
 
 func modifyToSentryLogger(log *zap.Logger, DSN string) *zap.Logger {
@@ -54,26 +60,43 @@ func Start(ctx context.Context) {
 	//defer sentryClient.Flush(2 * time.Second)
 	logger = modifyToSentryLogger(logger, "http://b7dd7b3ce3df4f2b81f5af622512658c@localhost:9000/2")
 
-	pgconn := os.Getenv("PG_URL")
-
-	db, err := data_file.New(ctx, logger.Sugar(), pgconn) // Mock!!!
-	//db, err := postgres.New(ctx, pgconn)
-
+	cfg := config.GetConfig(logger.Sugar())
+	db, err := newStorage(ctx, cfg, logger.Sugar())
 	if err != nil {
 		logger.Sugar().Fatalf("db init failed: %s", err)
 	}
-	authS := auth.New(db, logger.Sugar())
+	if err := db.openRateLimits(ctx, cfg, logger.Sugar()); err != nil {
+		logger.Sugar().Fatalf("rate limit backend init failed: %s", err)
+	}
+	closeStorage = db.close
+	authS := auth.New(db.users, db.tokens, db.revoked, db.sessions, db.attempts, db.mfa, db.webauthn, db.apps, logger.Sugar())
+	go authS.Run(ctx)
+	limiter := ratelimit.New(db.limits, logger.Sugar())
+	go limiter.Run(ctx)
 
-	hs, err = http.New(logger.Sugar(), authS)
+	hs, err = http.New(logger.Sugar(), authS, limiter)
 	if err != nil {
 		logger.Sugar().Fatalf("http server creating failed: %s", err)
 	}
 
-	gs, err = grpc.New(logger.Sugar(), authS)
+	gs, err = grpc.New(logger.Sugar(), authS, limiter)
 	if err != nil {
 		logger.Sugar().Fatalf("grpc server creating failed: %s", err)
 	}
 
+	if cfg.Dovecot.Address != "" {
+		ds, err = dovecot.New(logger.Sugar(), authS)
+		if err != nil {
+			logger.Sugar().Fatalf("dovecot auth server creating failed: %s", err)
+		}
+	}
+	if cfg.Postfix.Address != "" {
+		ps, err = postfix.New(logger.Sugar(), authS)
+		if err != nil {
+			logger.Sugar().Fatalf("postfix policy server creating failed: %s", err)
+		}
+	}
+
 	var g errgroup.Group
 	g.Go(func() error {
 		return hs.Start()
@@ -81,6 +104,18 @@ func Start(ctx context.Context) {
 	g.Go(func() error {
 		return gs.Start()
 	})
+	if ds != nil {
+		g.Go(func() error {
+			return ds.Start()
+		})
+		logger.Sugar().Infof("dovecot auth server is listening on %s", ds.Addr())
+	}
+	if ps != nil {
+		g.Go(func() error {
+			return ps.Start()
+		})
+		logger.Sugar().Infof("postfix policy server is listening on %s", ps.Addr())
+	}
 
 	logger.Sugar().Info(fmt.Sprintf("app is started on ports: %d (http) and %d (grpc)", hs.Port(), gs.Port()))
 
@@ -93,5 +128,24 @@ func Start(ctx context.Context) {
 func Stop() {
 	_ = hs.Stop(context.Background())
 	_ = gs.Stop(context.Background())
+	if ds != nil {
+		_ = ds.Stop(context.Background())
+	}
+	if ps != nil {
+		_ = ps.Stop(context.Background())
+	}
+	closeStorage()
 	logger.Sugar().Info("app has stopped")
 }
+
+// RotateSigningKey generates a new active signing key in the configured key
+// directory. Running instances pick it up on their next key reload.
+func RotateSigningKey() (string, error) {
+	logger, _ = zap.NewProduction()
+
+	keys, err := auth.KeyRingFromConfig(config.GetConfig(logger.Sugar()), logger.Sugar())
+	if err != nil {
+		return "", err
+	}
+	return keys.Rotate()
+}
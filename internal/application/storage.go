@@ -0,0 +1,127 @@
+package application
+
+import (
+	"context"
+	"fmt"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/data_file"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/memory"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/postgres"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"go.uber.org/zap"
+)
+
+// storage bundles the ports backed by the configured storage driver.
+type storage struct {
+	users    ports.UserStorage
+	tokens   ports.TokenStorage
+	revoked  ports.RevocationStorage
+	sessions ports.SessionStorage
+	attempts ports.LoginAttemptStorage
+	mfa      ports.MFAStorage
+	webauthn ports.WebAuthnStorage
+	apps     ports.AppPasswordStorage
+	limits   ports.RateLimitStorage
+	close    func()
+}
+
+func newStorage(ctx context.Context, cfg *config.Config, logger *zap.SugaredLogger) (*storage, error) {
+	switch cfg.Storage.Driver {
+	case "postgres":
+		db, err := postgres.New(ctx, logger, cfg.Storage.PostgresURL)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Storage.AutoMigrate {
+			if _, err := db.MigrateUp(ctx); err != nil {
+				db.Close()
+				return nil, err
+			}
+		}
+		return &storage{users: db, tokens: db, revoked: db, sessions: db, attempts: db, mfa: db, webauthn: db, apps: db, close: db.Close}, nil
+	case "file":
+		db, err := data_file.New(ctx, logger, cfg.Storage.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens := memory.New(logger)
+		return &storage{users: db, tokens: tokens, revoked: tokens, sessions: tokens, attempts: tokens, mfa: tokens, webauthn: tokens, apps: tokens, close: func() {}}, nil
+	case "memory":
+		db := memory.New(logger)
+		if cfg.Auth.Login != "" {
+			user := &models.User{Login: cfg.Auth.Login, PasswordHash: cfg.Auth.PasswordHash, Role: cfg.Auth.Role}
+			if err := db.Create(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+		return &storage{users: db, tokens: db, revoked: db, sessions: db, attempts: db, mfa: db, webauthn: db, apps: db, close: func() {}}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Storage.Driver)
+	}
+}
+
+// openRateLimits selects the rate limit backend. The postgres backend shares
+// the connection of the postgres driver or, with other drivers, opens one to
+// storage.postgres_url.
+func (s *storage) openRateLimits(ctx context.Context, cfg *config.Config, logger *zap.SugaredLogger) error {
+	switch cfg.RateLimit.Backend {
+	case "memory":
+		s.limits = memory.New(logger)
+	case "postgres":
+		if db, ok := s.users.(*postgres.Database); ok {
+			s.limits = db
+			return nil
+		}
+		db, err := postgres.New(ctx, logger, cfg.Storage.PostgresURL)
+		if err != nil {
+			return err
+		}
+		if cfg.Storage.AutoMigrate {
+			if _, err := db.MigrateUp(ctx); err != nil {
+				db.Close()
+				return err
+			}
+		}
+		closeStorage := s.close
+		s.close = func() {
+			closeStorage()
+			db.Close()
+		}
+		s.limits = db
+	default:
+		return fmt.Errorf("unknown rate limit backend %q", cfg.RateLimit.Backend)
+	}
+	return nil
+}
+
+// Migrate runs a migrate subcommand (up, down or status) against the
+// configured Postgres database.
+func Migrate(ctx context.Context, command string, steps int) ([]postgres.MigrationStatus, error) {
+	logger, _ = zap.NewProduction()
+	cfg := config.GetConfig(logger.Sugar())
+	if cfg.Storage.Driver != "postgres" {
+		return nil, fmt.Errorf("migrations require storage driver postgres, but was %q", cfg.Storage.Driver)
+	}
+
+	db, err := postgres.New(ctx, logger.Sugar(), cfg.Storage.PostgresURL)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		_, err = db.MigrateUp(ctx)
+	case "down":
+		_, err = db.MigrateDown(ctx, steps)
+	case "status":
+	default:
+		return nil, fmt.Errorf("unknown migrate command %q", command)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.MigrationStatus(ctx)
+}
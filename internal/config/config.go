@@ -2,6 +2,7 @@ package config
 
 import (
 	"sync"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 	"go.uber.org/zap"
@@ -10,11 +11,107 @@ import (
 type Config struct {
 	IsDebug *bool `yaml:"is_debug"`
 	Auth    struct {
-		Login        string `yaml:"login"`
-		PasswordHash string `yaml:"password_hash"`
-		Salt         string `yaml:"salt"`
-		Secret       string `yaml:"secret"`
+		Login           string `yaml:"login"`
+		PasswordHash    string `yaml:"password_hash"`
+		Role            string `yaml:"role" env-default:"admin"`
+		Salt            string `yaml:"salt"`
+		Secret          string `yaml:"secret"`
+		PasswordHashing struct {
+			Algorithm string `yaml:"algorithm" env-default:"argon2id"`
+			Argon2id  struct {
+				Memory      uint32 `yaml:"memory" env-default:"65536"`
+				Iterations  uint32 `yaml:"iterations" env-default:"3"`
+				Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+			} `yaml:"argon2id"`
+			Bcrypt struct {
+				Cost int `yaml:"cost" env-default:"12"`
+			} `yaml:"bcrypt"`
+			Scrypt struct {
+				LogN uint8 `yaml:"ln" env-default:"15"`
+				R    int   `yaml:"r" env-default:"8"`
+				P    int   `yaml:"p" env-default:"1"`
+			} `yaml:"scrypt"`
+		} `yaml:"password_hashing"`
+		PasswordPolicy struct {
+			MinLength int `yaml:"min_length" env-default:"8"`
+			MaxLength int `yaml:"max_length" env-default:"128"`
+		} `yaml:"password_policy"`
+		Lockout struct {
+			LoginThreshold int           `yaml:"login_threshold" env-default:"5"`
+			IPThreshold    int           `yaml:"ip_threshold" env-default:"20"`
+			BaseDelay      time.Duration `yaml:"base_delay" env-default:"1s"`
+			MaxDelay       time.Duration `yaml:"max_delay" env-default:"15m"`
+			ResetAfter     time.Duration `yaml:"reset_after" env-default:"1h"`
+		} `yaml:"lockout"`
+		MFA struct {
+			Issuer string `yaml:"issuer" env-default:"mail-service-auth"`
+			Skew   int    `yaml:"skew" env-default:"1"`
+		} `yaml:"mfa"`
+		SCRAM struct {
+			Iterations int `yaml:"iterations" env-default:"100000"`
+		} `yaml:"scram"`
+		WebAuthn struct {
+			RPID        string        `yaml:"rp_id" env-default:"localhost"`
+			RPName      string        `yaml:"rp_name" env-default:"Mail"`
+			Origins     []string      `yaml:"origins" env-default:"http://localhost:3000"`
+			Attestation string        `yaml:"attestation" env-default:"none"`
+			Timeout     time.Duration `yaml:"timeout" env-default:"5m"`
+		} `yaml:"webauthn"`
+		Mail struct {
+			Domains       []string `yaml:"domains"`
+			PlusDelimiter string   `yaml:"plus_delimiter"`
+		} `yaml:"mail"`
+		Domains []struct {
+			Name           string `yaml:"name"`
+			PasswordPolicy struct {
+				MinLength int `yaml:"min_length"`
+				MaxLength int `yaml:"max_length"`
+			} `yaml:"password_policy"`
+			AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+			RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+			MFAMethods      []string      `yaml:"mfa_methods"`
+		} `yaml:"domains"`
+		Signing struct {
+			Algorithm        string        `yaml:"algorithm" env-default:"HS256"`
+			KeyID            string        `yaml:"key_id"`
+			PrivateKeyFile   string        `yaml:"private_key_file"`
+			KeysDir          string        `yaml:"keys_dir"`
+			RotationInterval time.Duration `yaml:"rotation_interval" env-default:"720h"`
+			Retention        time.Duration `yaml:"retention" env-default:"24h"`
+		} `yaml:"signing"`
 	}
+	Storage struct {
+		Driver      string `yaml:"driver" env:"STORAGE_DRIVER" env-default:"file"`
+		UsersFile   string `yaml:"users_file" env:"USERS_FILE"`
+		PostgresURL string `yaml:"postgres_url" env:"PG_URL"`
+		AutoMigrate bool   `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+	}
+	Dovecot struct {
+		Network string `yaml:"network" env:"DOVECOT_NETWORK" env-default:"unix"`
+		Address string `yaml:"address" env:"DOVECOT_ADDRESS"`
+	} `yaml:"dovecot"`
+	Postfix struct {
+		Network string `yaml:"network" env:"POSTFIX_POLICY_NETWORK" env-default:"unix"`
+		Address string `yaml:"address" env:"POSTFIX_POLICY_ADDRESS"`
+	} `yaml:"postfix"`
+	// TrustedProxies are the networks of reverse proxies whose
+	// X-Forwarded-For header, or x-forwarded-for gRPC metadata, names the
+	// client.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	RateLimit      struct {
+		Backend string `yaml:"backend" env:"RATE_LIMIT_BACKEND" env-default:"memory"`
+		Rules   []struct {
+			Route      string  `yaml:"route"`
+			Key        string  `yaml:"key"`
+			Rate       float64 `yaml:"rate"`
+			Burst      int     `yaml:"burst"`
+			FailClosed bool    `yaml:"fail_closed"`
+		} `yaml:"rules"`
+		Clients []struct {
+			ID       string   `yaml:"id"`
+			Networks []string `yaml:"networks"`
+		} `yaml:"clients"`
+	} `yaml:"rate_limit"`
 	Ports struct {
 		HttpPort  string `yaml:"http_port"`
 		GrpcPort  string `yaml:"grpc_port"`
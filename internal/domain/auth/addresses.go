@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/mailaddr"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// mailPolicy maps logins to the mail addresses they own.
+type mailPolicy struct {
+	// domains complete logins of users without an address: alice owns
+	// alice@<domain>.
+	domains []string
+	// plusDelimiter separates subaddresses, which belong to the address
+	// without them.
+	plusDelimiter string
+}
+
+func mailPolicyFromConfig(cfg *config.Config) mailPolicy {
+	c := cfg.Auth.Mail
+	domains := make([]string, 0, len(c.Domains))
+	for _, domain := range c.Domains {
+		if normalized, err := mailaddr.Normalize("postmaster@" + domain); err == nil {
+			domains = append(domains, mailaddr.Domain(normalized))
+		}
+	}
+	return mailPolicy{domains: domains, plusDelimiter: c.PlusDelimiter}
+}
+
+// addresses returns the normalized addresses user owns.
+func (p mailPolicy) addresses(user *models.User) []string {
+	if addresses := user.Addresses(); len(addresses) > 0 {
+		return addresses
+	}
+	login := strings.ToLower(user.Login)
+	if strings.Contains(login, "@") {
+		return []string{login}
+	}
+	addresses := make([]string, 0, len(p.domains))
+	for _, domain := range p.domains {
+		addresses = append(addresses, login+"@"+domain)
+	}
+	return addresses
+}
+
+// candidates returns the normalized address and, if it has a subaddress,
+// the address without it.
+func (p mailPolicy) candidates(address string) ([]string, error) {
+	normalized, err := mailaddr.Normalize(address)
+	if err != nil {
+		return nil, err
+	}
+	if stripped := mailaddr.StripPlus(normalized, p.plusDelimiter); stripped != normalized {
+		return []string{normalized, stripped}, nil
+	}
+	return []string{normalized}, nil
+}
+
+// localLogin returns the local part of an address in one of the domains of
+// users without an address.
+func (p mailPolicy) localLogin(address string) (string, bool) {
+	domain := mailaddr.Domain(address)
+	for _, d := range p.domains {
+		if d == domain {
+			return strings.TrimSuffix(address, "@"+domain), true
+		}
+	}
+	return "", false
+}
+
+// ResolveLogin maps an address a user logs in with, such as
+// Alice+imap@Example.COM or an alias, to the login of the account. Logins
+// that are addresses themselves are found as typed or normalized; anything
+// else nobody owns is returned as it is.
+func (s *Service) ResolveLogin(ctx context.Context, login string) string {
+	logger := s.annotatedLogger(ctx)
+
+	if !strings.Contains(login, "@") {
+		return login
+	}
+	candidates, err := s.mail.candidates(login)
+	if err != nil {
+		return login
+	}
+	for _, address := range candidates {
+		user, err := s.db.GetByAddress(ctx, address)
+		if err == nil {
+			return user.Login
+		}
+		if !errors.Is(err, domainerrors.ErrNotFound) {
+			logger.Errorf("get user of address %s failed: %s", address, err.Error())
+			return login
+		}
+	}
+	for _, candidate := range []string{login, candidates[0]} {
+		user, err := s.db.Get(ctx, candidate)
+		if err == nil {
+			return user.Login
+		}
+		if !errors.Is(err, domainerrors.ErrNotFound) {
+			logger.Errorf("get user info for login %s failed: %s", candidate, err.Error())
+			return login
+		}
+	}
+	if local, ok := s.mail.localLogin(candidates[len(candidates)-1]); ok {
+		return local
+	}
+	return login
+}
+
+// setAddresses replaces the addresses of user with normalized ones that no
+// other user has. An empty address removes the primary address.
+func (s *Service) setAddresses(ctx context.Context, user *models.User, address *string, aliases *[]string) error {
+	if address != nil {
+		user.Address, user.Domain = "", ""
+		if *address != "" {
+			normalized, err := mailaddr.Normalize(*address)
+			if err != nil {
+				return err
+			}
+			user.Address, user.Domain = normalized, mailaddr.Domain(normalized)
+		}
+	}
+	if aliases != nil {
+		user.Aliases = nil
+		for _, alias := range *aliases {
+			normalized, err := mailaddr.Normalize(alias)
+			if err != nil {
+				return err
+			}
+			duplicate := normalized == user.Address
+			for _, a := range user.Aliases {
+				duplicate = duplicate || a == normalized
+			}
+			if !duplicate {
+				user.Aliases = append(user.Aliases, normalized)
+			}
+		}
+	}
+	for _, address := range user.Addresses() {
+		owner, err := s.db.GetByAddress(ctx, address)
+		if err == nil && owner.Login != user.Login {
+			return fmt.Errorf("address %s belongs to %s: %w", address, owner.Login, domainerrors.ErrAlreadyExists)
+		}
+		if err != nil && !errors.Is(err, domainerrors.ErrNotFound) {
+			return fmt.Errorf("get user of address %s failed", address)
+		}
+	}
+	return nil
+}
+
+// CanSendAs checks that the mail client logged in as login may use sender as
+// its envelope sender. It fails with ErrForbidden for addresses of others.
+func (s *Service) CanSendAs(ctx context.Context, login, sender string) error {
+	logger := s.annotatedLogger(ctx)
+
+	login = s.ResolveLogin(ctx, login)
+	user, err := s.db.Get(ctx, login)
+	if err != nil {
+		logger.Errorf("get user info for login %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("get user info for login %s failed", login), err)
+	}
+	if user.Disabled {
+		logger.Errorf("login %s is disabled", login)
+		return fmt.Errorf("sender %s of login %s rejected: %w", sender, login, domainerrors.ErrUserDisabled)
+	}
+	candidates, _ := s.mail.candidates(sender)
+	for _, address := range s.mail.addresses(user) {
+		for _, candidate := range candidates {
+			if candidate == address {
+				return nil
+			}
+		}
+	}
+	err = fmt.Errorf("sender %s is not an address of login %s: %w", sender, login, domainerrors.ErrForbidden)
+	logger.With("security_event", "sender_rejected").Errorf("%s", err.Error())
+	return err
+}
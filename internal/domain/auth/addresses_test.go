@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+func newAddressTestService(t *testing.T) *Service {
+	t.Helper()
+	s := newTestService(t)
+	s.mail = mailPolicy{domains: []string{"example.com", "example.org"}, plusDelimiter: "+"}
+	// Users files may have mail addresses as logins, also in the domains of
+	// users without an address and with capitals.
+	for _, login := range []string{"bob@example.net", "carl@example.com", "Dana@Example.NET"} {
+		if err := s.db.Create(context.Background(), &models.User{Login: login, Role: models.RoleUser}); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+	}
+	return s
+}
+
+func TestUpdateUserAddresses(t *testing.T) {
+	s := newAddressTestService(t)
+	ctx := context.Background()
+
+	address, aliases, name := "Alice@Bücher.Example", []string{"Info@Example.NET", "alice@xn--bcher-kva.example", "info@example.net"}, " Alice "
+	user, err := s.UpdateUser(ctx, operator, "test123", models.UserUpdate{Address: &address, Aliases: &aliases, DisplayName: &name})
+	if err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if user.Address != "alice@xn--bcher-kva.example" || user.Domain != "xn--bcher-kva.example" ||
+		len(user.Aliases) != 1 || user.Aliases[0] != "info@example.net" || user.DisplayName != "Alice" {
+		t.Fatalf("Expected normalized addresses, but was %+v", user)
+	}
+
+	if _, err := s.CreateUser(ctx, operator, "carol", "qwerty123", models.RoleUser); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	taken := []string{"INFO@example.net"}
+	if _, err := s.UpdateUser(ctx, operator, "carol", models.UserUpdate{Aliases: &taken}); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrAlreadyExists, err)
+	}
+	invalid := "carol"
+	if _, err := s.UpdateUser(ctx, operator, "carol", models.UserUpdate{Address: &invalid}); !errors.Is(err, domainerrors.ErrInvalidAddress) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidAddress, err)
+	}
+}
+
+func TestLoginWithAddress(t *testing.T) {
+	s := newAddressTestService(t)
+	ctx := context.Background()
+
+	address, aliases := "alice@bücher.example", []string{"info@example.net", "sales+eu@example.net"}
+	if _, err := s.UpdateUser(ctx, operator, "test123", models.UserUpdate{Address: &address, Aliases: &aliases}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+
+	cases := []struct {
+		login string
+		want  string
+	}{
+		{"test123", "test123"},
+		{"Alice@BÜCHER.example", "test123"},
+		{"alice+imap@xn--bcher-kva.example", "test123"},
+		{"INFO@example.net", "test123"},
+		{"sales+eu@example.net", "test123"},
+		{"test123@Example.ORG", "test123"},
+		{"Bob@Example.NET", "bob@example.net"},
+		{"carl@example.com", "carl@example.com"},
+		{"Carl@Example.com", "carl@example.com"},
+		{"Dana@Example.NET", "Dana@Example.NET"},
+		{"nobody@example.net", "nobody@example.net"},
+		{"NoBody@Example.NET", "NoBody@Example.NET"},
+		{"not an address@", "not an address@"},
+	}
+	for _, c := range cases {
+		t.Run(c.login, func(t *testing.T) {
+			if got := s.ResolveLogin(ctx, c.login); got != c.want {
+				t.Fatalf("Expected %s, but was %s", c.want, got)
+			}
+		})
+	}
+
+	if _, err := s.Login(ctx, "Info@Example.NET", "qwerty"); err != nil {
+		t.Fatalf("Expected login with an alias, but was %v", err)
+	}
+	if user, err := s.AuthenticatePlain(ctx, "alice+imap@bücher.example", "qwerty", models.ProtocolIMAP); err != nil || user.Login != "test123" {
+		t.Fatalf("Expected test123, but was %v, %v", user, err)
+	}
+}
+
+func TestCanSendAs(t *testing.T) {
+	s := newAddressTestService(t)
+	ctx := context.Background()
+	if _, err := s.CreateUser(ctx, operator, "carol", "qwerty123", models.RoleUser); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	address, aliases := "carol@example.net", []string{"sales@example.net"}
+	if _, err := s.UpdateUser(ctx, operator, "carol", models.UserUpdate{Address: &address, Aliases: &aliases}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+
+	cases := []struct {
+		login  string
+		sender string
+		err    error
+	}{
+		{"test123", "test123@example.com", nil},
+		{"test123", "TEST123+news@example.org", nil},
+		{"test123", "test123@example.net", domainerrors.ErrForbidden},
+		{"bob@example.net", "Bob@Example.net", nil},
+		{"bob@example.net", "bob@example.com", domainerrors.ErrForbidden},
+		{"carol", "Sales@example.net", nil},
+		{"carol@example.net", "carol+x@example.net", nil},
+		{"carol", "carol@example.com", domainerrors.ErrForbidden},
+		{"sales@example.net", "carol@example.net", nil},
+		{"carol", "not an address", domainerrors.ErrForbidden},
+		{"nobody", "nobody@example.com", domainerrors.ErrNotFound},
+	}
+	for _, c := range cases {
+		t.Run(c.login+" as "+c.sender, func(t *testing.T) {
+			err := s.CanSendAs(ctx, c.login, c.sender)
+			if (c.err == nil) != (err == nil) || (c.err != nil && !errors.Is(err, c.err)) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const generatedPasswordBytes = 15
+
+func validateRole(role string) error {
+	if role != models.RoleUser && role != models.RoleAdmin && role != models.RoleDomainAdmin {
+		return fmt.Errorf("%w: unknown role %q", domainerrors.ErrInvalidRole, role)
+	}
+	return nil
+}
+
+// ValidateRole validates accessToken like Validate and additionally requires
+// the role claim to be the user's current role and one of roles, so that a
+// demotion takes effect before the token expires.
+func (s *Service) ValidateRole(ctx context.Context, accessToken string, roles ...string) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.Validate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.parseToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	granted := false
+	for _, role := range roles {
+		granted = granted || user.Role == role
+	}
+	if claims.Role != user.Role || !granted {
+		wanted := strings.Join(roles, " or ")
+		logger.Errorf("login %s lacks role %s", user.Login, wanted)
+		return nil, fmt.Errorf("login %s lacks role %s: %w", user.Login, wanted, domainerrors.ErrForbidden)
+	}
+	return user, nil
+}
+
+// ListUsers returns a page of users and the number of users matching filter.
+// Domain administrators only see the users of their domain.
+func (s *Service) ListUsers(ctx context.Context, actor *models.User, filter models.UserFilter) ([]models.User, int, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if actor.Role != models.RoleAdmin {
+		filter.Domain = actor.Domain
+	}
+	if err := authorizeAdmin(actor, filter.Domain); err != nil {
+		logger.Errorf("list users rejected: %s", err.Error())
+		return nil, 0, err
+	}
+	users, err := s.db.List(ctx, filter)
+	if err != nil {
+		logger.Errorf("list users failed: %s", err.Error())
+		return nil, 0, fmt.Errorf("list users failed")
+	}
+	total, err := s.db.Count(ctx, filter)
+	if err != nil {
+		logger.Errorf("count users failed: %s", err.Error())
+		return nil, 0, fmt.Errorf("count users failed")
+	}
+	return users, total, nil
+}
+
+func (s *Service) GetUser(ctx context.Context, actor *models.User, login string) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.db.Get(ctx, login)
+	if err != nil {
+		logger.Errorf("get user %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("get user %s failed", login), err)
+	}
+	if err := authorizeUser(actor, user); err != nil {
+		logger.Errorf("get user %s rejected: %s", login, err.Error())
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateUser creates an account with the given role, applying the same
+// checks as Register. Users created by domain administrators get the
+// address login@<domain> of their domain.
+func (s *Service) CreateUser(ctx context.Context, actor *models.User, login, password, role string) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	domain := ""
+	if actor.Role != models.RoleAdmin {
+		domain = actor.Domain
+	}
+	err := authorizeAdmin(actor, domain)
+	if err == nil {
+		err = authorizeRole(actor, role)
+	}
+	if err != nil {
+		logger.Errorf("create user %s rejected: %s", login, err.Error())
+		return nil, err
+	}
+	return s.createUser(ctx, login, password, role, domain)
+}
+
+// UpdateUser changes the role, disabled state, addresses or display name of
+// login. Disabling signs the user out everywhere.
+func (s *Service) UpdateUser(ctx context.Context, actor *models.User, login string, update models.UserUpdate) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if update.Role != nil {
+		if err := validateRole(*update.Role); err != nil {
+			return nil, err
+		}
+	}
+	user, err := s.GetUser(ctx, actor, login)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUpdate(actor, update); err != nil {
+		logger.Errorf("update user %s rejected: %s", login, err.Error())
+		return nil, err
+	}
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if update.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*update.DisplayName)
+	}
+	if update.Address != nil || update.Aliases != nil {
+		if err := s.setAddresses(ctx, user, update.Address, update.Aliases); err != nil {
+			logger.Errorf("update addresses of user %s rejected: %s", login, err.Error())
+			return nil, err
+		}
+	}
+	if err := authorizeUser(actor, user); err != nil {
+		logger.Errorf("update user %s rejected: %s", login, err.Error())
+		return nil, err
+	}
+	if err := s.db.Update(ctx, user); err != nil {
+		logger.Errorf("update user %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("update user %s failed", login), err)
+	}
+	if user.Disabled {
+		if _, err := s.RevokeSessions(ctx, login); err != nil {
+			return nil, err
+		}
+	}
+	logger.Infof("user %s updated by %s: role %s, disabled %t", login, actor.Login, user.Role, user.Disabled)
+	return user, nil
+}
+
+// ResetPassword sets a new password for login and signs it out everywhere.
+// An empty password is replaced by a generated one, which is returned.
+func (s *Service) ResetPassword(ctx context.Context, actor *models.User, login, password string) (string, error) {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.GetUser(ctx, actor, login)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			logger.Errorf("generate password failed: %s", err.Error())
+			return "", fmt.Errorf("generate password failed")
+		}
+		password = generated
+	}
+	if err := s.domains.passwordPolicy(user.Domain, s.policy).check(login, password); err != nil {
+		logger.Errorf("password reset for login %s rejected: %s", login, err.Error())
+		return "", err
+	}
+	if err := s.setPassword(user, password); err != nil {
+		logger.Errorf("hash password for login %s failed: %s", login, err.Error())
+		return "", fmt.Errorf("hash password for login %s failed", login)
+	}
+	if err := s.db.Update(ctx, user); err != nil {
+		logger.Errorf("update user %s failed: %s", login, err.Error())
+		return "", storageError(fmt.Sprintf("update user %s failed", login), err)
+	}
+	if _, err := s.RevokeSessions(ctx, login); err != nil {
+		return "", err
+	}
+	logger.Infof("password of user %s reset by %s", login, actor.Login)
+	return password, nil
+}
+
+// DeleteUser removes login and signs it out everywhere.
+func (s *Service) DeleteUser(ctx context.Context, actor *models.User, login string) error {
+	logger := s.annotatedLogger(ctx)
+
+	if _, err := s.GetUser(ctx, actor, login); err != nil {
+		return err
+	}
+	if err := s.db.Delete(ctx, login); err != nil {
+		logger.Errorf("delete user %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("delete user %s failed", login), err)
+	}
+	if err := s.mfa.DeleteTOTP(ctx, login); err != nil && !errors.Is(err, domainerrors.ErrNotFound) {
+		logger.Errorf("delete totp of user %s failed: %s", login, err.Error())
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, login, nil); err != nil {
+		logger.Errorf("delete recovery codes of user %s failed: %s", login, err.Error())
+	}
+	s.deleteWebAuthnCredentials(ctx, login)
+	s.revokeAppPasswords(ctx, login)
+	if _, err := s.RevokeSessions(ctx, login); err != nil {
+		return err
+	}
+	logger.Infof("user %s deleted by %s", login, actor.Login)
+	return nil
+}
+
+// storageError keeps the storage errors callers can act upon and hides the
+// rest behind msg.
+func storageError(msg string, err error) error {
+	for _, known := range []error{domainerrors.ErrNotFound, domainerrors.ErrAlreadyExists, domainerrors.ErrReadOnly} {
+		if errors.Is(err, known) {
+			return fmt.Errorf("%s: %w", msg, known)
+		}
+	}
+	return fmt.Errorf(msg)
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, generatedPasswordBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(buf), nil
+}
+
+// HashPassword encodes password with the current hashing policy, for
+// storages edited by hand such as users files.
+func (s *Service) HashPassword(password string) (string, error) {
+	return s.passwords.hash(password)
+}
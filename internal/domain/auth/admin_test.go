@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// operator manages every user in tests.
+var operator = &models.User{Login: "operator", Role: models.RoleAdmin}
+
+func TestValidateRole(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.CreateUser(ctx, operator, "root", "correct horse", models.RoleAdmin); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	admin, _ := s.Login(ctx, "root", "correct horse")
+	user, _ := s.Login(ctx, "test123", "qwerty")
+
+	if _, err := s.ValidateRole(ctx, admin.AuthToken, models.RoleAdmin); err != nil {
+		t.Fatalf("Expected admin to pass, but was %v", err)
+	}
+	if _, err := s.ValidateRole(ctx, user.AuthToken, models.RoleAdmin); !errors.Is(err, domainerrors.ErrForbidden) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrForbidden, err)
+	}
+
+	// A demotion applies to tokens issued before it.
+	role := models.RoleUser
+	if _, err := s.UpdateUser(ctx, operator, "root", models.UserUpdate{Role: &role}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if _, err := s.ValidateRole(ctx, admin.AuthToken, models.RoleAdmin); !errors.Is(err, domainerrors.ErrForbidden) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrForbidden, err)
+	}
+}
+
+func TestDisableUser(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	tokens, _ := s.Login(ctx, "test123", "qwerty")
+	disabled := true
+	if _, err := s.UpdateUser(ctx, operator, "test123", models.UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if _, err := s.Validate(ctx, tokens.AuthToken); err == nil {
+		t.Fatalf("Expected tokens of disabled user to be rejected")
+	}
+	if _, err := s.Login(ctx, "test123", "qwerty"); !errors.Is(err, domainerrors.ErrUserDisabled) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrUserDisabled, err)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	password, err := s.ResetPassword(ctx, operator, "test123", "")
+	if err != nil {
+		t.Fatalf("reset failed: %s", err)
+	}
+	if _, err := s.Login(ctx, "test123", "qwerty"); err == nil {
+		t.Fatalf("Expected old password to be rejected")
+	}
+	if _, err := s.Login(ctx, "test123", password); err != nil {
+		t.Fatalf("Expected generated password to work, but was %v", err)
+	}
+	if _, err := s.ResetPassword(ctx, operator, "nobody", "correct horse"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+}
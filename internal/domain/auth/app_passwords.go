@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const appPasswordGroup = 4
+
+var appPasswordProtocols = []string{models.ProtocolIMAP, models.ProtocolSMTP, models.ProtocolPOP3}
+
+// generateAppPassword returns a password such as abcd efgh 2345 6789, which
+// is easy to type into a mail client.
+func generateAppPassword() (string, error) {
+	buf := make([]byte, randomCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	password := strings.ToLower(totpEncoding.EncodeToString(buf))
+	groups := make([]string, 0, len(password)/appPasswordGroup)
+	for i := 0; i < len(password); i += appPasswordGroup {
+		groups = append(groups, password[i:i+appPasswordGroup])
+	}
+	return strings.Join(groups, " "), nil
+}
+
+// hashAppPassword ignores case and spaces, which clients and users keep or
+// drop when pasting a password.
+func hashAppPassword(password string) string {
+	normalized := strings.ReplaceAll(strings.ToLower(password), " ", "")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// appPasswordScopes checks scopes against the known protocols and drops
+// duplicates.
+func appPasswordScopes(scopes []string) ([]string, error) {
+	var checked []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(scope)
+		known := false
+		for _, protocol := range appPasswordProtocols {
+			known = known || scope == protocol
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %q, expected one of %s", domainerrors.ErrInvalidScope, scope, strings.Join(appPasswordProtocols, ", "))
+		}
+		duplicate := false
+		for _, c := range checked {
+			duplicate = duplicate || c == scope
+		}
+		if !duplicate {
+			checked = append(checked, scope)
+		}
+	}
+	if len(checked) == 0 {
+		return nil, fmt.Errorf("%w: no scopes", domainerrors.ErrInvalidScope)
+	}
+	return checked, nil
+}
+
+// CreateAppPassword generates a password for a mail client of login that
+// works for scopes only. The password is returned this once; only its hash
+// is stored.
+func (s *Service) CreateAppPassword(ctx context.Context, login, name string, scopes []string) (*models.AppPassword, string, error) {
+	logger := s.annotatedLogger(ctx)
+
+	scopes, err := appPasswordScopes(scopes)
+	if err != nil {
+		logger.Errorf("app password for login %s rejected: %s", login, err.Error())
+		return nil, "", err
+	}
+	password, err := generateAppPassword()
+	if err != nil {
+		logger.Errorf("generate app password failed: %s", err.Error())
+		return nil, "", fmt.Errorf("generate app password failed")
+	}
+	appPassword := &models.AppPassword{
+		ID:        uuid.NewString(),
+		Login:     login,
+		Name:      name,
+		Hash:      hashAppPassword(password),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+	if err := s.apps.CreateAppPassword(ctx, appPassword); err != nil {
+		logger.Errorf("store app password of login %s failed: %s", login, err.Error())
+		return nil, "", storageError(fmt.Sprintf("store app password of login %s failed", login), err)
+	}
+	logger.With("security_event", "app_password_created").Infof("app password %q of login %s created for %s", name, login, strings.Join(scopes, ", "))
+	return appPassword, password, nil
+}
+
+func (s *Service) AppPasswords(ctx context.Context, login string) ([]models.AppPassword, error) {
+	logger := s.annotatedLogger(ctx)
+
+	passwords, err := s.apps.ListAppPasswords(ctx, login)
+	if err != nil {
+		logger.Errorf("list app passwords of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("list app passwords of login %s failed", login)
+	}
+	return passwords, nil
+}
+
+func (s *Service) RevokeAppPassword(ctx context.Context, login, id string) error {
+	logger := s.annotatedLogger(ctx)
+
+	if err := s.apps.DeleteAppPassword(ctx, login, id); err != nil {
+		logger.Errorf("revoke app password %s of login %s failed: %s", id, login, err.Error())
+		return storageError(fmt.Sprintf("revoke app password %s of login %s failed", id, login), err)
+	}
+	logger.With("security_event", "app_password_revoked").Infof("app password %s of login %s revoked", id, login)
+	return nil
+}
+
+// revokeAppPasswords removes every app password of a deleted user.
+func (s *Service) revokeAppPasswords(ctx context.Context, login string) {
+	logger := s.annotatedLogger(ctx)
+
+	passwords, err := s.apps.ListAppPasswords(ctx, login)
+	if err != nil {
+		logger.Errorf("list app passwords of user %s failed: %s", login, err.Error())
+		return
+	}
+	for _, password := range passwords {
+		if err := s.apps.DeleteAppPassword(ctx, login, password.ID); err != nil {
+			logger.Errorf("delete app password of user %s failed: %s", login, err.Error())
+		}
+	}
+}
+
+// AuthenticatePlain checks a login and password sent by a mail client over
+// protocol, such as with IMAP LOGIN or SASL PLAIN. App passwords scoped to
+// protocol are accepted; the account password only while 2FA is off, as it
+// would bypass the second factor otherwise. Failures count towards the
+// lockout like failed logins.
+func (s *Service) AuthenticatePlain(ctx context.Context, login, password, protocol string) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	login = s.ResolveLogin(ctx, login)
+	if err := s.checkLockout(ctx, login); err != nil {
+		logger.Errorf("%s authentication of login %s rejected: %s", protocol, login, err.Error())
+		return nil, fmt.Errorf("%s authentication of login %s rejected: %w", protocol, login, err)
+	}
+	user, err := s.db.Get(ctx, login)
+	if err != nil {
+		s.recordLoginFailure(ctx, login)
+		logger.Errorf("get user info for login %s failed", login)
+		return nil, fmt.Errorf("get user info for login %s failed", login)
+	}
+
+	ok, err := s.useAppPassword(ctx, login, password, protocol)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		ok, err = s.checkPlainPassword(ctx, user, password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		s.recordLoginFailure(ctx, login)
+		logger.Errorf("invalid %s password for login %s", protocol, login)
+		return nil, fmt.Errorf("invalid %s password for login %s", protocol, login)
+	}
+	s.resetLoginFailures(ctx, login)
+	if user.Disabled {
+		logger.Errorf("login %s is disabled", login)
+		return nil, fmt.Errorf("%s authentication of login %s rejected: %w", protocol, login, domainerrors.ErrUserDisabled)
+	}
+	return user, nil
+}
+
+// useAppPassword reports whether password is an app password of login and
+// records its use. A match outside its scopes is refused without counting
+// as a failure: the password is right, the client is not.
+func (s *Service) useAppPassword(ctx context.Context, login, password, protocol string) (bool, error) {
+	logger := s.annotatedLogger(ctx)
+
+	passwords, err := s.apps.ListAppPasswords(ctx, login)
+	if err != nil {
+		logger.Errorf("list app passwords of login %s failed: %s", login, err.Error())
+		return false, fmt.Errorf("list app passwords of login %s failed", login)
+	}
+	hash := hashAppPassword(password)
+	for _, appPassword := range passwords {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(appPassword.Hash)) != 1 {
+			continue
+		}
+		if !appPassword.HasScope(protocol) {
+			logger.Errorf("app password %q of login %s is not valid for %s", appPassword.Name, login, protocol)
+			return false, fmt.Errorf("app password of login %s is not valid for %s: %w", login, protocol, domainerrors.ErrForbidden)
+		}
+		err := s.apps.UseAppPassword(ctx, appPassword.ID, time.Now())
+		if errors.Is(err, domainerrors.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			logger.Errorf("record use of app password of login %s failed: %s", login, err.Error())
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// checkPlainPassword verifies the account password for clients without 2FA.
+func (s *Service) checkPlainPassword(ctx context.Context, user *models.User, password string) (bool, error) {
+	logger := s.annotatedLogger(ctx)
+
+	enabled, err := s.mfaEnabled(ctx, user.Login)
+	if err != nil {
+		logger.Errorf("get mfa of login %s failed: %s", user.Login, err.Error())
+		return false, fmt.Errorf("get mfa of login %s failed", user.Login)
+	}
+	if enabled {
+		return false, nil
+	}
+	ok, err := s.passwords.verify(password, user.PasswordHash)
+	if err != nil {
+		logger.Errorf("password verification for login %s failed: %s", user.Login, err.Error())
+		return false, nil
+	}
+	if ok && s.needsPasswordUpgrade(user) {
+		s.upgradePasswordHash(ctx, user, password)
+	}
+	return ok, nil
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+func TestAuthenticatePlain(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if _, _, err := s.CreateAppPassword(ctx, "test123", "bad", []string{"ftp"}); !errors.Is(err, domainerrors.ErrInvalidScope) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidScope, err)
+	}
+	appPassword, password, err := s.CreateAppPassword(ctx, "test123", "thunderbird", []string{"IMAP", "smtp", "imap"})
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if len(appPassword.Scopes) != 2 || appPassword.Hash == password {
+		t.Fatalf("Expected 2 scopes and a hashed password, but was %+v", appPassword)
+	}
+
+	cases := []struct {
+		name     string
+		password string
+		protocol string
+		wantErr  bool
+	}{
+		{"app password", password, models.ProtocolIMAP, false},
+		{"app password without spaces", strings.ReplaceAll(strings.ToUpper(password), " ", ""), models.ProtocolSMTP, false},
+		{"app password out of scope", password, models.ProtocolPOP3, true},
+		{"account password without 2fa", "qwerty", models.ProtocolPOP3, false},
+		{"wrong password", "qwertz", models.ProtocolIMAP, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			user, err := s.AuthenticatePlain(ctx, "test123", c.password, c.protocol)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Expected error %t, but was %v", c.wantErr, err)
+			}
+			if err == nil && user.Login != "test123" {
+				t.Fatalf("Expected test123, but was %s", user.Login)
+			}
+		})
+	}
+	passwords, _ := s.AppPasswords(ctx, "test123")
+	if len(passwords) != 1 || passwords[0].LastUsedAt.IsZero() {
+		t.Fatalf("Expected a used app password, but was %+v", passwords)
+	}
+
+	// With 2FA on only app passwords work.
+	enrollment, _ := s.EnrollTOTP(ctx, "test123")
+	if _, err := s.ConfirmTOTP(ctx, "test123", currentTOTPCode(t, enrollment.Secret)); err != nil {
+		t.Fatalf("confirm failed: %s", err)
+	}
+	if _, err := s.AuthenticatePlain(ctx, "test123", "qwerty", models.ProtocolIMAP); err == nil {
+		t.Fatalf("Expected account password to be refused with 2fa")
+	}
+	if _, err := s.AuthenticatePlain(ctx, "test123", password, models.ProtocolIMAP); err != nil {
+		t.Fatalf("Expected app password to work with 2fa, but was %v", err)
+	}
+
+	if err := s.RevokeAppPassword(ctx, "test123", appPassword.ID); err != nil {
+		t.Fatalf("revoke failed: %s", err)
+	}
+	if _, err := s.AuthenticatePlain(ctx, "test123", password, models.ProtocolIMAP); err == nil {
+		t.Fatalf("Expected revoked app password to be refused")
+	}
+}
@@ -2,14 +2,16 @@ package auth
 
 import (
 	"context"
-	"crypto/sha1"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
 	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
@@ -18,27 +20,133 @@ import (
 const (
 	authTokenTTL             = 1 * time.Minute
 	refreshTokenTTL          = 1 * time.Hour
+	tokenCleanupPeriod       = 1 * time.Hour
 	loginExtractionFailed    = "extracting login from token failed"
 	getUserInfoFailed        = "get user info for login failed"
 	invalidSignMethod        = "invalid signing method"
+	unknownSigningKey        = "unknown signing key"
 	tokenParsingFailed       = "token parsing failed"
 	tokenClaimsParsingFailed = "token claims parsing failed"
 )
 
 type tokenClaims struct {
 	jwt.StandardClaims
-	Login string `json:"login"`
+	Login   string `json:"login"`
+	Role    string `json:"role,omitempty"`
+	Session string `json:"sid,omitempty"`
+	// Domain is the mail domain of the user, so that services serving
+	// several domains can tell them apart without a lookup.
+	Domain string `json:"domain,omitempty"`
+	// Purpose marks tokens that are not access or refresh tokens, such as
+	// MFA challenges, so that they are never accepted as one.
+	Purpose string `json:"pur,omitempty"`
 }
 
 type Service struct {
-	db     ports.UserStorage
-	logger *zap.SugaredLogger
+	db        ports.UserStorage
+	tokens    ports.TokenStorage
+	revoked   ports.RevocationStorage
+	sessions  ports.SessionStorage
+	attempts  ports.LoginAttemptStorage
+	mfa       ports.MFAStorage
+	webauthn  ports.WebAuthnStorage
+	apps      ports.AppPasswordStorage
+	passwords *passwordHashers
+	policy    passwordPolicy
+	lockout   lockoutPolicy
+	totp      totpPolicy
+	scram     scramPolicy
+	rp        relyingParty
+	mail      mailPolicy
+	domains   domainPolicies
+	keys      *KeyRing
+	logger    *zap.SugaredLogger
 }
 
-func New(db ports.UserStorage, logger *zap.SugaredLogger) *Service {
+func New(
+	db ports.UserStorage,
+	tokens ports.TokenStorage,
+	revoked ports.RevocationStorage,
+	sessions ports.SessionStorage,
+	attempts ports.LoginAttemptStorage,
+	mfa ports.MFAStorage,
+	webauthn ports.WebAuthnStorage,
+	apps ports.AppPasswordStorage,
+	logger *zap.SugaredLogger,
+) *Service {
+	passwords, err := passwordHashersFromConfig(config.GetConfig(logger))
+	if err != nil {
+		logger.Errorf("%s, falling back to %s", err.Error(), argon2idID)
+		passwords = newPasswordHashers(NewArgon2idHasher(64*1024, 3, 2))
+	}
+	keys, err := KeyRingFromConfig(config.GetConfig(logger), logger)
+	if err != nil {
+		logger.Fatalf("signing keys loading failed: %s", err.Error())
+	}
 	return &Service{
-		db:     db,
-		logger: logger,
+		db:        db,
+		tokens:    tokens,
+		revoked:   revoked,
+		sessions:  sessions,
+		attempts:  attempts,
+		mfa:       mfa,
+		webauthn:  webauthn,
+		apps:      apps,
+		passwords: passwords,
+		policy:    passwordPolicyFromConfig(config.GetConfig(logger)),
+		lockout:   lockoutPolicyFromConfig(config.GetConfig(logger)),
+		totp:      totpPolicyFromConfig(config.GetConfig(logger)),
+		scram:     scramPolicyFromConfig(config.GetConfig(logger)),
+		rp:        relyingPartyFromConfig(config.GetConfig(logger)),
+		mail:      mailPolicyFromConfig(config.GetConfig(logger)),
+		domains:   domainPoliciesFromConfig(config.GetConfig(logger)),
+		keys:      keys,
+		logger:    logger,
+	}
+}
+
+// Run performs background maintenance, such as signing key rotation and
+// expired token cleanup, until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	go s.keys.Run(ctx, s.logger)
+
+	ticker := time.NewTicker(tokenCleanupPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.deleteExpiredTokens(ctx)
+	}
+}
+
+func (s *Service) deleteExpiredTokens(ctx context.Context) {
+	now := time.Now()
+	deleted, err := s.tokens.DeleteExpiredRefreshTokens(ctx, now)
+	if err != nil {
+		s.logger.Errorf("expired refresh tokens cleanup failed: %s", err.Error())
+	} else {
+		s.logger.Infof("%d expired refresh tokens deleted", deleted)
+	}
+	deleted, err = s.revoked.DeleteExpiredRevocations(ctx, now)
+	if err != nil {
+		s.logger.Errorf("expired revocations cleanup failed: %s", err.Error())
+	} else {
+		s.logger.Infof("%d expired revocations deleted", deleted)
+	}
+	deleted, err = s.sessions.DeleteExpiredSessions(ctx, now)
+	if err != nil {
+		s.logger.Errorf("expired sessions cleanup failed: %s", err.Error())
+	} else {
+		s.logger.Infof("%d expired sessions deleted", deleted)
+	}
+	deleted, err = s.attempts.DeleteLoginFailuresBefore(ctx, now.Add(-s.lockout.resetAfter))
+	if err != nil {
+		s.logger.Errorf("stale login failures cleanup failed: %s", err.Error())
+	} else {
+		s.logger.Infof("%d stale login failure counters deleted", deleted)
 	}
 }
 
@@ -75,24 +183,41 @@ func (s *Service) Validate(ctx context.Context, accessToken string) (*models.Use
 		logger.Errorf("access token expired")
 		return user, fmt.Errorf("access token expired")
 	}
-	login := claims.Login
-	user, err = s.db.Get(ctx, login)
+	if err := s.checkNotRevoked(ctx, claims); err != nil {
+		logger.Errorf("access token rejected: %s", err.Error())
+		return user, fmt.Errorf("access token rejected: %w", err)
+	}
+	user, err = s.getUser(ctx, claims)
 	if err != nil {
-		logger.Errorf(getUserInfoFailed)
-		return user, fmt.Errorf(getUserInfoFailed)
+		return nil, err
+	}
+	if err := checkDomain(claims, user); err != nil {
+		logger.Errorf("access token rejected: %s", err.Error())
+		return nil, fmt.Errorf("access token rejected: %w", err)
 	}
 	return user, nil
 }
 
 func (s *Service) parseToken(ctx context.Context, accessToken string) (*tokenClaims, error) {
+	return s.parsePurposeToken(ctx, accessToken, "")
+}
+
+// parsePurposeToken is parseToken for tokens issued for purpose.
+func (s *Service) parsePurposeToken(ctx context.Context, accessToken, purpose string) (*tokenClaims, error) {
 	logger := s.annotatedLogger(ctx)
 
 	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys.verification(kid)
+		if !ok {
+			logger.Errorf("%s: %s", unknownSigningKey, kid)
+			return nil, fmt.Errorf("%s: %s", unknownSigningKey, kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
 			logger.Errorf(invalidSignMethod)
 			return nil, fmt.Errorf(invalidSignMethod)
 		}
-		return []byte(config.GetConfig(logger).Auth.Secret), nil
+		return key.public, nil
 	})
 	if err != nil {
 		vErr, _ := err.(*jwt.ValidationError)
@@ -107,6 +232,10 @@ func (s *Service) parseToken(ctx context.Context, accessToken string) (*tokenCla
 		logger.Errorf(tokenClaimsParsingFailed)
 		return &tokenClaims{}, fmt.Errorf(tokenClaimsParsingFailed)
 	}
+	if claims.Purpose != purpose {
+		logger.Errorf("token issued for %q used for %q", claims.Purpose, purpose)
+		return &tokenClaims{}, fmt.Errorf("token issued for another purpose: %w", domainerrors.ErrTokenInvalid)
+	}
 	return claims, nil
 }
 
@@ -118,26 +247,79 @@ func (s *Service) tokenExpired(claims *tokenClaims) bool {
 func (s *Service) Login(ctx context.Context, login, password string) (models.TokenPair, error) {
 	logger := s.annotatedLogger(ctx)
 
+	login = s.ResolveLogin(ctx, login)
+	if err := s.checkLockout(ctx, login); err != nil {
+		logger.Errorf("login %s rejected: %s", login, err.Error())
+		return models.TokenPair{}, fmt.Errorf("login %s rejected: %w", login, err)
+	}
 	userModel, err := s.db.Get(ctx, login)
 	if err != nil {
+		s.recordLoginFailure(ctx, login)
 		logger.Errorf("get user info for login %s failed", login)
 		return models.TokenPair{}, fmt.Errorf("get user info for login %s failed", login)
 	}
 
-	passwordHash := s.generatePasswordHash(ctx, password)
-	if userModel.PasswordHash != passwordHash {
+	ok, err := s.passwords.verify(password, userModel.PasswordHash)
+	if err != nil {
+		s.recordLoginFailure(ctx, login)
+		logger.Errorf("password verification for login %s failed: %s", login, err.Error())
+		return models.TokenPair{}, fmt.Errorf("invalid password for login %s", login)
+	}
+	if !ok {
+		s.recordLoginFailure(ctx, login)
 		logger.Errorf("invalid password for login %s", login)
 		return models.TokenPair{}, fmt.Errorf("invalid password for login %s", login)
 	}
+	s.resetLoginFailures(ctx, login)
+	if userModel.Disabled {
+		logger.Errorf("login %s is disabled", login)
+		return models.TokenPair{}, fmt.Errorf("login %s rejected: %w", login, domainerrors.ErrUserDisabled)
+	}
+	if s.needsPasswordUpgrade(userModel) {
+		s.upgradePasswordHash(ctx, userModel, password)
+	}
+	if err := s.requireMFA(ctx, userModel); err != nil {
+		return models.TokenPair{}, err
+	}
+	return s.issueTokens(ctx, userModel)
+}
+
+// issueTokens starts a session for a fully authenticated user.
+func (s *Service) issueTokens(ctx context.Context, userModel *models.User) (models.TokenPair, error) {
+	logger := s.annotatedLogger(ctx)
+	login := userModel.Login
 
-	tokens, err := s.generateAuthTokens(ctx, login)
+	session := s.newSession(ctx, login)
+	tokens, err := s.generateAuthTokens(ctx, userModel, session)
 	if err != nil {
 		logger.Errorf("generate tokens for login %s failed", login)
 		return models.TokenPair{}, fmt.Errorf("generate tokens for login %s failed", login)
 	}
+	if err := s.sessions.CreateSession(ctx, session); err != nil {
+		logger.Errorf("create session for login %s failed: %s", login, err.Error())
+		return models.TokenPair{}, fmt.Errorf("create session for login %s failed", login)
+	}
 	return *tokens, nil
 }
 
+// upgradePasswordHash rehashes a verified password with the current hashing
+// policy and derives its SCRAM keys. Failures are only logged: the login
+// itself has already succeeded.
+func (s *Service) upgradePasswordHash(ctx context.Context, user *models.User, password string) {
+	logger := s.annotatedLogger(ctx)
+
+	upgraded := *user
+	if err := s.setPassword(&upgraded, password); err != nil {
+		logger.Errorf("rehash password for login %s failed: %s", user.Login, err.Error())
+		return
+	}
+	if err := s.db.Update(ctx, &upgraded); err != nil {
+		logger.Errorf("store upgraded password hash for login %s failed: %s", user.Login, err.Error())
+		return
+	}
+	logger.Infof("password hash for login %s upgraded", user.Login)
+}
+
 func (s *Service) ValidateAndRefresh(ctx context.Context, tokens *models.TokenPair) (*models.TokenPair, string, error) {
 	logger := s.annotatedLogger(ctx)
 
@@ -148,8 +330,7 @@ func (s *Service) ValidateAndRefresh(ctx context.Context, tokens *models.TokenPa
 	}
 	user, err := s.getUser(ctx, accessClaims)
 	if err != nil {
-		logger.Errorf(getUserInfoFailed)
-		return &models.TokenPair{}, "", fmt.Errorf(getUserInfoFailed)
+		return &models.TokenPair{}, "", err
 	}
 	refreshClaims, err := s.parseToken(ctx, tokens.RefreshToken)
 	if err != nil {
@@ -161,22 +342,144 @@ func (s *Service) ValidateAndRefresh(ctx context.Context, tokens *models.TokenPa
 		logger.Errorf("access and refresh tokens have different signers")
 		return &models.TokenPair{}, "", fmt.Errorf("access and refresh tokens have different signers")
 	}
+	for _, claims := range []*tokenClaims{accessClaims, refreshClaims} {
+		if err := checkDomain(claims, user); err != nil {
+			logger.Errorf("token rejected: %s", err.Error())
+			return &models.TokenPair{}, "", fmt.Errorf("token rejected: %w", err)
+		}
+	}
 	if s.tokenExpired(refreshClaims) {
 		logger.Errorf("refresh token expired")
 		return &models.TokenPair{}, "", fmt.Errorf("refresh token expired")
 	}
+	for _, claims := range []*tokenClaims{accessClaims, refreshClaims} {
+		if err := s.checkNotRevoked(ctx, claims); err != nil {
+			logger.Errorf("token rejected: %s", err.Error())
+			return &models.TokenPair{}, "", fmt.Errorf("token rejected: %w", err)
+		}
+	}
 
 	if s.tokenExpired(accessClaims) {
-		newTokens, err := s.generateAuthTokens(ctx, user.Login)
+		if err := s.checkRefreshToken(ctx, refreshClaims, true); err != nil {
+			logger.Errorf("refresh token rejected: %s", err.Error())
+			return &models.TokenPair{}, "", fmt.Errorf("refresh token rejected: %w", err)
+		}
+		session, err := s.sessions.GetSession(ctx, refreshClaims.Session)
+		if err != nil {
+			logger.Errorf("session %s lookup failed: %s", refreshClaims.Session, err.Error())
+			return &models.TokenPair{}, "", fmt.Errorf("session lookup failed: %w", err)
+		}
+		newTokens, err := s.generateAuthTokens(ctx, user, session)
 		if err != nil {
 			logger.Errorf("failed to generate auth tokens")
 			return &models.TokenPair{}, "", fmt.Errorf("failed to generate auth tokens")
 		}
+		s.touchSession(ctx, session)
+		if err := s.sessions.UpdateSession(ctx, session); err != nil {
+			logger.Errorf("update session %s failed: %s", session.ID, err.Error())
+			return &models.TokenPair{}, "", fmt.Errorf("update session failed: %w", err)
+		}
 		return newTokens, user.Login, nil
 	}
+	if err := s.checkRefreshToken(ctx, refreshClaims, false); err != nil {
+		logger.Errorf("refresh token rejected: %s", err.Error())
+		return &models.TokenPair{}, "", fmt.Errorf("refresh token rejected: %w", err)
+	}
 	return tokens, user.Login, nil
 }
 
+// checkNotRevoked rejects tokens whose jti is on the revocation list.
+func (s *Service) checkNotRevoked(ctx context.Context, claims *tokenClaims) error {
+	revoked, err := s.revoked.IsRevoked(ctx, claims.Id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return domainerrors.ErrTokenRevoked
+	}
+	return nil
+}
+
+// Logout revokes both tokens of a session. Expired tokens are still accepted
+// here so that a client holding a stale pair can end its session; either
+// token alone is enough.
+func (s *Service) Logout(ctx context.Context, tokens *models.TokenPair) error {
+	logger := s.annotatedLogger(ctx)
+
+	revoked := 0
+	for _, token := range []string{tokens.AuthToken, tokens.RefreshToken} {
+		if token == "" {
+			continue
+		}
+		claims, err := s.parseToken(ctx, token)
+		if err != nil {
+			logger.Errorf("logout token ignored: %s", err.Error())
+			continue
+		}
+		if err := s.revokeToken(ctx, claims); err != nil {
+			logger.Errorf("revoke token of login %s failed: %s", claims.Login, err.Error())
+			return fmt.Errorf("revoke token failed")
+		}
+		if err := s.endSessionByID(ctx, claims.Session); err != nil {
+			logger.Errorf("end session %s failed: %s", claims.Session, err.Error())
+			return fmt.Errorf("end session failed")
+		}
+		revoked++
+	}
+	if revoked == 0 {
+		logger.Errorf("no valid token to log out")
+		return fmt.Errorf("no valid token to log out: %w", domainerrors.ErrTokenInvalid)
+	}
+	return nil
+}
+
+func (s *Service) revokeToken(ctx context.Context, claims *tokenClaims) error {
+	return s.revoked.Revoke(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// checkRefreshToken verifies that the refresh token is the current member of
+// its family, using it up when use is set. Presenting a token that was
+// already rotated means it has leaked: the whole family is revoked so
+// neither the thief nor the legitimate client can refresh any more.
+func (s *Service) checkRefreshToken(ctx context.Context, claims *tokenClaims, use bool) error {
+	logger := s.annotatedLogger(ctx)
+
+	var (
+		token *models.RefreshToken
+		err   error
+	)
+	if use {
+		token, err = s.tokens.UseRefreshToken(ctx, claims.Id)
+	} else {
+		token, err = s.tokens.GetRefreshToken(ctx, claims.Id)
+		switch {
+		case err != nil:
+		case token.Revoked:
+			err = domainerrors.ErrTokenRevoked
+		case token.Used:
+			err = domainerrors.ErrTokenReused
+		}
+	}
+	if errors.Is(err, domainerrors.ErrTokenReused) {
+		if endErr := s.endSessionByID(ctx, token.Family); endErr != nil {
+			logger.Errorf("end session %s failed: %s", token.Family, endErr.Error())
+		}
+		logger.With(
+			"security_event", "refresh_token_reuse",
+			"login", token.Login,
+			"family", token.Family,
+		).Errorf("reuse of rotated refresh token detected, token family revoked")
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if token.Login != claims.Login || token.Family != claims.Session {
+		return domainerrors.ErrTokenInvalid
+	}
+	return nil
+}
+
 func (s *Service) getUser(ctx context.Context, claims *tokenClaims) (*models.User, error) {
 	logger := s.annotatedLogger(ctx)
 
@@ -185,46 +488,78 @@ func (s *Service) getUser(ctx context.Context, claims *tokenClaims) (*models.Use
 		logger.Errorf(getUserInfoFailed)
 		return user, fmt.Errorf(getUserInfoFailed)
 	}
+	if user.Disabled {
+		logger.Errorf("login %s is disabled", user.Login)
+		return nil, fmt.Errorf("login %s rejected: %w", user.Login, domainerrors.ErrUserDisabled)
+	}
 
 	return user, nil
 }
 
-func (s *Service) generateAuthTokens(ctx context.Context, login string) (*models.TokenPair, error) {
+// checkDomain rejects tokens issued while the user belonged to another
+// domain, as their claims no longer hold.
+func checkDomain(claims *tokenClaims, user *models.User) error {
+	if claims.Domain != user.Domain {
+		return fmt.Errorf("token of login %s issued for domain %q: %w", user.Login, claims.Domain, domainerrors.ErrTokenInvalid)
+	}
+	return nil
+}
+
+// generateAuthTokens issues a token pair for session carrying the user's
+// role and domain, with the lifetimes set for the domain. The refresh token
+// joins the session's family as its only usable member and the session
+// records the ids of both tokens; the caller persists the session.
+func (s *Service) generateAuthTokens(ctx context.Context, user *models.User, session *models.Session) (*models.TokenPair, error) {
 	logger := s.annotatedLogger(ctx)
+	login := session.Login
 
-	authToken, err := s.generateToken(ctx, login, authTokenTTL)
+	accessClaims := &tokenClaims{Login: login, Role: user.Role, Session: session.ID, Domain: user.Domain}
+	authToken, err := s.generateToken(ctx, accessClaims, s.domains.accessTokenTTL(user.Domain))
 	if err != nil {
 		logger.Errorf("generate auth token for login %s failed", login)
 		return &models.TokenPair{}, fmt.Errorf("generate auth token for login %s failed", login)
 	}
-	refreshToken, err := s.generateToken(ctx, login, refreshTokenTTL)
+	refreshClaims := &tokenClaims{Login: login, Session: session.ID, Domain: user.Domain}
+	refreshToken, err := s.generateToken(ctx, refreshClaims, s.domains.refreshTokenTTL(user.Domain))
 	if err != nil {
 		logger.Errorf("generate refresh token for login %s failed", login)
 		return &models.TokenPair{}, fmt.Errorf("generate refresh token for login %s failed", login)
 	}
+	err = s.tokens.CreateRefreshToken(ctx, &models.RefreshToken{
+		ID:        refreshClaims.Id,
+		Family:    session.ID,
+		Login:     login,
+		ExpiresAt: time.Unix(refreshClaims.ExpiresAt, 0),
+	})
+	if err != nil {
+		logger.Errorf("store refresh token for login %s failed: %s", login, err.Error())
+		return &models.TokenPair{}, fmt.Errorf("store refresh token for login %s failed", login)
+	}
+	session.AccessTokenID = accessClaims.Id
+	session.RefreshTokenID = refreshClaims.Id
+	session.ExpiresAt = time.Unix(refreshClaims.ExpiresAt, 0)
 	return &models.TokenPair{
 		AuthToken:    authToken,
 		RefreshToken: refreshToken,
 	}, nil
 }
 
-func (s *Service) generatePasswordHash(ctx context.Context, password string) string {
-	logger := s.annotatedLogger(ctx)
-
-	hash := sha1.New()
-	hash.Write([]byte(password))
-	return fmt.Sprintf("%x", hash.Sum([]byte(config.GetConfig(logger).Auth.Salt)))
+// generateToken fills in the token id and lifetime of claims and signs them.
+func (s *Service) generateToken(ctx context.Context, claims *tokenClaims, tokenTTL time.Duration) (string, error) {
+	now := time.Now()
+	claims.Id = uuid.NewString()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(tokenTTL).Unix()
+
+	key := s.keys.signing()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
 }
 
-func (s *Service) generateToken(ctx context.Context, login string, tokenTTL time.Duration) (string, error) {
-	logger := s.annotatedLogger(ctx)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
-			IssuedAt:  time.Now().Unix(),
-		},
-		login,
-	})
-	return token.SignedString([]byte(config.GetConfig(logger).Auth.Secret))
+// JWKS returns the public keys downstream services use to verify tokens,
+// including recently replaced ones. Symmetric keys are never published, so
+// the set is empty with HS256.
+func (s *Service) JWKS(ctx context.Context) models.JWKSet {
+	return s.keys.jwks()
 }
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/memory"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/sasl"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	hasher := NewArgon2idHasher(1024, 1, 1)
+	hash, _ := hasher.Hash("qwerty")
+	key, _ := newSigningKey("", "HS256", []byte("secret"))
+	logger := zap.NewNop().Sugar()
+	storage := memory.New(logger).Seed(models.User{Login: "test123", PasswordHash: hash})
+	return &Service{
+		db:        storage,
+		tokens:    storage,
+		revoked:   storage,
+		sessions:  storage,
+		attempts:  storage,
+		mfa:       storage,
+		webauthn:  storage,
+		apps:      storage,
+		passwords: newPasswordHashers(hasher),
+		policy:    passwordPolicy{minLength: 8, maxLength: 128},
+		lockout:   lockoutPolicy{loginThreshold: 3, ipThreshold: 10, baseDelay: time.Minute, maxDelay: time.Hour, resetAfter: time.Hour},
+		totp:      totpPolicy{issuer: "test", skew: 1},
+		scram:     scramPolicy{iterations: sasl.MinSCRAMIterations, decoyKey: []byte("decoy")},
+		rp:        relyingParty{id: "mail.example.com", name: "Mail", origins: []string{"https://mail.example.com"}, attestation: "none", timeout: time.Minute},
+		keys:      newStaticKeyRing(key),
+		logger:    logger,
+	}
+}
+
+// withClock shifts the time used for token expiry checks.
+func withClock(t *testing.T, shift time.Duration) {
+	t.Helper()
+	jwt.TimeFunc = func() time.Time { return time.Now().Add(shift) }
+	t.Cleanup(func() { jwt.TimeFunc = time.Now })
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	tokens, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	same, login, err := s.ValidateAndRefresh(ctx, &tokens)
+	if err != nil || login != "test123" || *same != tokens {
+		t.Fatalf("Expected valid access token to be returned as is, but was %v", err)
+	}
+
+	withClock(t, authTokenTTL+time.Second)
+	rotated, _, err := s.ValidateAndRefresh(ctx, &tokens)
+	if err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("Expected a new refresh token")
+	}
+
+	// The rotated token is presented again, e.g. by a thief.
+	_, _, err = s.ValidateAndRefresh(ctx, &tokens)
+	if !errors.Is(err, domainerrors.ErrTokenReused) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenReused, err)
+	}
+	// The whole family is revoked, including the legitimate successor.
+	_, _, err = s.ValidateAndRefresh(ctx, rotated)
+	if !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenRevoked, err)
+	}
+
+	// Other logins start their own family and are unaffected.
+	other, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	if _, _, err = s.ValidateAndRefresh(ctx, &other); err != nil {
+		t.Fatalf("Expected new family to refresh, but was %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	tokens, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	other, _ := s.Login(ctx, "test123", "qwerty")
+
+	if err := s.Logout(ctx, &tokens); err != nil {
+		t.Fatalf("logout failed: %s", err)
+	}
+	if _, err := s.Validate(ctx, tokens.AuthToken); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenRevoked, err)
+	}
+	if _, _, err := s.ValidateAndRefresh(ctx, &tokens); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenRevoked, err)
+	}
+	withClock(t, authTokenTTL+time.Second)
+	if _, _, err := s.ValidateAndRefresh(ctx, &tokens); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected refresh after logout to fail, but was %v", err)
+	}
+
+	if _, _, err := s.ValidateAndRefresh(ctx, &other); err != nil {
+		t.Fatalf("Expected other session to stay valid, but was %v", err)
+	}
+	if err := s.Logout(ctx, &models.TokenPair{AuthToken: "garbage"}); err == nil {
+		t.Fatalf("Expected logout without valid tokens to fail")
+	}
+}
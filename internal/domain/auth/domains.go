@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/mailaddr"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// domainPolicy holds the settings of the users of one mail domain. Zero
+// values mean the service-wide setting applies.
+type domainPolicy struct {
+	password        passwordPolicy
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	// mfaMethods lists the second factors users may enroll; nil allows all.
+	mfaMethods []string
+}
+
+// domainPolicies maps normalized domain names to their settings.
+type domainPolicies map[string]domainPolicy
+
+func domainPoliciesFromConfig(cfg *config.Config) domainPolicies {
+	policies := domainPolicies{}
+	for _, c := range cfg.Auth.Domains {
+		normalized, err := mailaddr.Normalize("postmaster@" + c.Name)
+		if err != nil {
+			continue
+		}
+		policies[mailaddr.Domain(normalized)] = domainPolicy{
+			password: passwordPolicy{
+				minLength: c.PasswordPolicy.MinLength,
+				maxLength: c.PasswordPolicy.MaxLength,
+			},
+			accessTokenTTL:  c.AccessTokenTTL,
+			refreshTokenTTL: c.RefreshTokenTTL,
+			mfaMethods:      c.MFAMethods,
+		}
+	}
+	return policies
+}
+
+// passwordPolicy returns the password policy of domain, falling back to
+// global for unset limits.
+func (p domainPolicies) passwordPolicy(domain string, global passwordPolicy) passwordPolicy {
+	policy := global
+	if d, ok := p[domain]; ok {
+		if d.password.minLength > 0 {
+			policy.minLength = d.password.minLength
+		}
+		if d.password.maxLength > 0 {
+			policy.maxLength = d.password.maxLength
+		}
+	}
+	return policy
+}
+
+func (p domainPolicies) accessTokenTTL(domain string) time.Duration {
+	if d, ok := p[domain]; ok && d.accessTokenTTL > 0 {
+		return d.accessTokenTTL
+	}
+	return authTokenTTL
+}
+
+func (p domainPolicies) refreshTokenTTL(domain string) time.Duration {
+	if d, ok := p[domain]; ok && d.refreshTokenTTL > 0 {
+		return d.refreshTokenTTL
+	}
+	return refreshTokenTTL
+}
+
+// longestAccessTokenTTL bounds the lifetime of any access token, for
+// revocations of tokens whose domain is unknown.
+func (p domainPolicies) longestAccessTokenTTL() time.Duration {
+	longest := authTokenTTL
+	for _, d := range p {
+		if d.accessTokenTTL > longest {
+			longest = d.accessTokenTTL
+		}
+	}
+	return longest
+}
+
+// allowMFA fails with ErrForbidden if the users of domain may not enroll
+// method.
+func (p domainPolicies) allowMFA(domain, method string) error {
+	d, ok := p[domain]
+	if !ok || d.mfaMethods == nil {
+		return nil
+	}
+	for _, m := range d.mfaMethods {
+		if m == method {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is disabled in domain %s: %w", method, domain, domainerrors.ErrForbidden)
+}
+
+// allowMFA fails with ErrForbidden if the domain of login has method
+// disabled.
+func (s *Service) allowMFA(ctx context.Context, login, method string) error {
+	logger := s.annotatedLogger(ctx)
+
+	user, err := s.db.Get(ctx, login)
+	if err != nil {
+		logger.Errorf("get user info for login %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("get user info for login %s failed", login), err)
+	}
+	if err := s.domains.allowMFA(user.Domain, method); err != nil {
+		logger.Errorf("%s enrollment of login %s rejected: %s", method, login, err.Error())
+		return err
+	}
+	return nil
+}
+
+// authorizeAdmin fails with ErrForbidden unless actor may manage the users
+// of domain: administrators manage everyone, domain administrators the
+// users of their own domain.
+func authorizeAdmin(actor *models.User, domain string) error {
+	switch {
+	case actor.Role == models.RoleAdmin:
+		return nil
+	case actor.Role == models.RoleDomainAdmin && actor.Domain != "" && actor.Domain == domain:
+		return nil
+	}
+	return fmt.Errorf("login %s may not manage users of domain %q: %w", actor.Login, domain, domainerrors.ErrForbidden)
+}
+
+// authorizeUser is authorizeAdmin for an existing user: domain administrators
+// manage neither administrators, other domain administrators included, nor
+// users with addresses outside their domain.
+func authorizeUser(actor, user *models.User) error {
+	if actor.Role == models.RoleAdmin {
+		return nil
+	}
+	if err := authorizeAdmin(actor, user.Domain); err != nil {
+		return err
+	}
+	if user.Role != models.RoleUser {
+		return fmt.Errorf("login %s may not manage %s %s: %w", actor.Login, user.Role, user.Login, domainerrors.ErrForbidden)
+	}
+	return authorizeAddresses(actor, user.Addresses())
+}
+
+// authorizeRole fails with ErrForbidden unless actor may grant role: domain
+// administrators only make users.
+func authorizeRole(actor *models.User, role string) error {
+	if actor.Role == models.RoleAdmin || role == models.RoleUser {
+		return nil
+	}
+	return fmt.Errorf("login %s may not grant role %s: %w", actor.Login, role, domainerrors.ErrForbidden)
+}
+
+// authorizeAddresses fails with ErrForbidden if one of addresses is outside
+// the domain of a domain administrator. Checking them before their owners
+// are looked up keeps addresses of other domains from being probed. Invalid
+// addresses are left to the caller.
+func authorizeAddresses(actor *models.User, addresses []string) error {
+	if actor.Role == models.RoleAdmin {
+		return nil
+	}
+	for _, address := range addresses {
+		normalized, err := mailaddr.Normalize(address)
+		if err == nil && mailaddr.Domain(normalized) != actor.Domain {
+			return fmt.Errorf("login %s may not manage address %s: %w", actor.Login, normalized, domainerrors.ErrForbidden)
+		}
+	}
+	return nil
+}
+
+// authorizeUpdate checks the role and addresses update would give a user
+// actor may manage, before anything is looked up.
+func authorizeUpdate(actor *models.User, update models.UserUpdate) error {
+	if update.Role != nil {
+		if err := authorizeRole(actor, *update.Role); err != nil {
+			return err
+		}
+	}
+	var addresses []string
+	if update.Address != nil && *update.Address != "" {
+		addresses = append(addresses, *update.Address)
+	}
+	if update.Aliases != nil {
+		addresses = append(addresses, *update.Aliases...)
+	}
+	return authorizeAddresses(actor, addresses)
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// moveToDomain gives login the address login@domain.
+func moveToDomain(t *testing.T, s *Service, login, domain string) *models.User {
+	t.Helper()
+	address := login + "@" + domain
+	user, err := s.UpdateUser(context.Background(), operator, login, models.UserUpdate{Address: &address})
+	if err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	return user
+}
+
+func TestDomainAdmin(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.CreateUser(ctx, operator, "postmaster", "correct horse", models.RoleDomainAdmin); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	actor := moveToDomain(t, s, "postmaster", "example.com")
+
+	carol, err := s.CreateUser(ctx, actor, "carol", "correct horse", models.RoleUser)
+	if err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	if carol.Address != "carol@example.com" || carol.Domain != "example.com" {
+		t.Fatalf("Expected carol@example.com, but was %+v", carol)
+	}
+	for _, role := range []string{models.RoleAdmin, models.RoleDomainAdmin} {
+		if _, err := s.CreateUser(ctx, actor, "root", "correct horse", role); !errors.Is(err, domainerrors.ErrForbidden) {
+			t.Fatalf("%s: Expected %v, but was %v", role, domainerrors.ErrForbidden, err)
+		}
+	}
+
+	users, total, err := s.ListUsers(ctx, actor, models.UserFilter{Domain: "example.org"})
+	if err != nil || total != 2 || !sameUsers(users, "carol", "postmaster") {
+		t.Fatalf("Expected carol and postmaster, but was %v, %d, %v", users, total, err)
+	}
+
+	// Peers and users of other domains are out of reach, and so are the
+	// owners of their addresses.
+	if _, err := s.CreateUser(ctx, operator, "hostmaster", "correct horse", models.RoleDomainAdmin); err != nil {
+		t.Fatalf("create failed: %s", err)
+	}
+	moveToDomain(t, s, "hostmaster", "example.com")
+	moveToDomain(t, s, "test123", "example.org")
+
+	cases := []struct {
+		name   string
+		login  string
+		update models.UserUpdate
+	}{
+		{name: "user of another domain", login: "test123", update: models.UserUpdate{}},
+		{name: "peer", login: "hostmaster", update: models.UserUpdate{}},
+		{name: "address elsewhere", login: "carol", update: models.UserUpdate{Address: stringPtr("carol@example.org")}},
+		{name: "address removed", login: "carol", update: models.UserUpdate{Address: stringPtr("")}},
+		{name: "alias elsewhere", login: "carol", update: models.UserUpdate{Aliases: &[]string{"carol@example.org"}}},
+		{name: "taken alias elsewhere", login: "carol", update: models.UserUpdate{Aliases: &[]string{"Test123@Example.org"}}},
+		{name: "admin granted", login: "carol", update: models.UserUpdate{Role: stringPtr(models.RoleAdmin)}},
+		{name: "domain admin granted", login: "carol", update: models.UserUpdate{Role: stringPtr(models.RoleDomainAdmin)}},
+	}
+	for _, c := range cases {
+		if _, err := s.UpdateUser(ctx, actor, c.login, c.update); !errors.Is(err, domainerrors.ErrForbidden) {
+			t.Fatalf("%s: Expected %v, but was %v", c.name, domainerrors.ErrForbidden, err)
+		}
+	}
+	for _, login := range []string{"test123", "hostmaster"} {
+		if _, err := s.ResetPassword(ctx, actor, login, ""); !errors.Is(err, domainerrors.ErrForbidden) {
+			t.Fatalf("%s: Expected %v, but was %v", login, domainerrors.ErrForbidden, err)
+		}
+		if err := s.UnlockLogin(ctx, actor, login); !errors.Is(err, domainerrors.ErrForbidden) {
+			t.Fatalf("%s: Expected %v, but was %v", login, domainerrors.ErrForbidden, err)
+		}
+		if err := s.DeleteUser(ctx, actor, login); !errors.Is(err, domainerrors.ErrForbidden) {
+			t.Fatalf("%s: Expected %v, but was %v", login, domainerrors.ErrForbidden, err)
+		}
+	}
+
+	disabled := true
+	if _, err := s.UpdateUser(ctx, actor, "carol", models.UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if err := s.DeleteUser(ctx, actor, "carol"); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+
+	// Without a domain a domain administrator manages nobody.
+	if _, _, err := s.ListUsers(ctx, &models.User{Login: "nobody", Role: models.RoleDomainAdmin}, models.UserFilter{}); !errors.Is(err, domainerrors.ErrForbidden) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrForbidden, err)
+	}
+}
+
+func TestDomainClaim(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	moveToDomain(t, s, "test123", "example.com")
+	tokens, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	claims, err := s.parseToken(ctx, tokens.AuthToken)
+	if err != nil || claims.Domain != "example.com" {
+		t.Fatalf("Expected domain example.com, but was %v, %v", claims, err)
+	}
+
+	// Tokens issued before a move to another domain are rejected.
+	moveToDomain(t, s, "test123", "example.org")
+	if _, err := s.Validate(ctx, tokens.AuthToken); !errors.Is(err, domainerrors.ErrTokenInvalid) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenInvalid, err)
+	}
+	if _, _, err := s.ValidateAndRefresh(ctx, &tokens); !errors.Is(err, domainerrors.ErrTokenInvalid) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenInvalid, err)
+	}
+}
+
+func TestDomainSettings(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	s.domains = domainPolicies{"example.com": {
+		password:        passwordPolicy{minLength: 12},
+		accessTokenTTL:  10 * time.Minute,
+		refreshTokenTTL: 2 * time.Hour,
+		mfaMethods:      []string{models.MFAMethodWebAuthn},
+	}}
+
+	if _, err := s.EnrollTOTP(ctx, "test123"); err != nil {
+		t.Fatalf("Expected totp outside of example.com, but was %v", err)
+	}
+	moveToDomain(t, s, "test123", "example.com")
+
+	tokens, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	for token, ttl := range map[string]time.Duration{tokens.AuthToken: 10 * time.Minute, tokens.RefreshToken: 2 * time.Hour} {
+		claims, err := s.parseToken(ctx, token)
+		if err != nil || time.Duration(claims.ExpiresAt-claims.IssuedAt)*time.Second != ttl {
+			t.Fatalf("Expected lifetime %s, but was %v, %v", ttl, claims, err)
+		}
+	}
+
+	if _, err := s.ResetPassword(ctx, operator, "test123", "short pass"); !errors.Is(err, domainerrors.ErrWeakPassword) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrWeakPassword, err)
+	}
+	if _, err := s.ResetPassword(ctx, operator, "test123", "long enough pass"); err != nil {
+		t.Fatalf("reset failed: %s", err)
+	}
+
+	if _, err := s.EnrollTOTP(ctx, "test123"); !errors.Is(err, domainerrors.ErrForbidden) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrForbidden, err)
+	}
+	if _, err := s.BeginWebAuthnRegistration(ctx, "test123"); err != nil {
+		t.Fatalf("Expected webauthn to be enabled, but was %v", err)
+	}
+}
+
+func sameUsers(users []models.User, logins ...string) bool {
+	if len(users) != len(logins) {
+		return false
+	}
+	for i := range users {
+		if users[i].Login != logins[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
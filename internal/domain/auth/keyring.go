@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const (
+	keyFileExt          = ".pem"
+	keyRingCheckPeriod  = 1 * time.Minute
+	rotationUnsupported = "key rotation requires signing.keys_dir and an asymmetric algorithm"
+)
+
+type ringKey struct {
+	*signingKey
+	created time.Time
+}
+
+// KeyRing holds the active signing key and the verify-only keys it replaced.
+// When backed by a directory every key lives in its own
+// <created unix time>_<kid>.pem file; the newest one signs, older ones only
+// verify until their successor is older than the retention period, which
+// must exceed the refresh token TTL. Replicas sharing the directory converge
+// on the same active key on their next reload.
+type KeyRing struct {
+	mu               sync.RWMutex
+	algorithm        string
+	dir              string
+	rotationInterval time.Duration
+	retention        time.Duration
+	keys             []*ringKey // newest first
+}
+
+// newStaticKeyRing wraps a single key that is never rotated.
+func newStaticKeyRing(key *signingKey) *KeyRing {
+	return &KeyRing{
+		algorithm: key.method.Alg(),
+		keys:      []*ringKey{{signingKey: key, created: time.Now()}},
+	}
+}
+
+// NewKeyRing loads the key ring stored in dir, generating the first key if
+// the directory holds none.
+func NewKeyRing(algorithm, dir string, rotationInterval, retention time.Duration) (*KeyRing, error) {
+	if _, err := signingMethod(algorithm); err != nil || algorithm == "HS256" {
+		return nil, fmt.Errorf(rotationUnsupported)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create key directory %s failed: %w", dir, err)
+	}
+	r := &KeyRing{
+		algorithm:        algorithm,
+		dir:              dir,
+		rotationInterval: rotationInterval,
+		retention:        retention,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	if len(r.keys) == 0 {
+		if _, err := r.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// KeyRingFromConfig builds the key ring described by the signing section.
+// Without keys_dir the ring holds the single key of signingKeyFromConfig.
+func KeyRingFromConfig(cfg *config.Config, logger *zap.SugaredLogger) (*KeyRing, error) {
+	c := cfg.Auth.Signing
+	if c.KeysDir != "" {
+		return NewKeyRing(c.Algorithm, c.KeysDir, c.RotationInterval, c.Retention)
+	}
+	key, generated, err := signingKeyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if generated {
+		logger.Warnf("no private key file configured, using generated %s key %s", key.method.Alg(), key.id)
+	}
+	return newStaticKeyRing(key), nil
+}
+
+func (r *KeyRing) rotatable() bool {
+	return r.dir != ""
+}
+
+// Reload rereads the key directory, picking up keys rotated by other
+// replicas and dropping deleted ones.
+func (r *KeyRing) Reload() error {
+	if !r.rotatable() {
+		return nil
+	}
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("read key directory %s failed: %w", r.dir, err)
+	}
+	var keys []*ringKey
+	for _, entry := range entries {
+		created, kid, ok := parseKeyFileName(entry.Name())
+		if entry.IsDir() || !ok {
+			continue
+		}
+		key, err := loadSigningKey(kid, r.algorithm, filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, &ringKey{signingKey: key, created: created})
+	}
+	if len(keys) == 0 {
+		// Nothing to switch to; NewKeyRing generates the first key.
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].created.After(keys[j].created)
+	})
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new active key. The previous keys stay available for
+// verification.
+func (r *KeyRing) Rotate() (string, error) {
+	if !r.rotatable() {
+		return "", fmt.Errorf(rotationUnsupported)
+	}
+	key, err := generateSigningKey(r.algorithm)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return "", fmt.Errorf("marshal private key failed: %w", err)
+	}
+	created := time.Now()
+	name := filepath.Join(r.dir, keyFileName(created, key.id))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return "", fmt.Errorf("write key file failed: %w", err)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return "", fmt.Errorf("write key file failed: %w", err)
+	}
+
+	r.mu.Lock()
+	r.keys = append([]*ringKey{{signingKey: key, created: created}}, r.keys...)
+	r.mu.Unlock()
+	return key.id, nil
+}
+
+// prune deletes keys whose successor was created more than the retention
+// period ago: no token they signed can still be valid.
+func (r *KeyRing) prune() ([]string, error) {
+	if !r.rotatable() {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var pruned []string
+	for i := 1; i < len(r.keys); i++ {
+		if time.Since(r.keys[i-1].created) <= r.retention {
+			continue
+		}
+		for _, key := range r.keys[i:] {
+			if err := os.Remove(filepath.Join(r.dir, keyFileName(key.created, key.id))); err != nil && !os.IsNotExist(err) {
+				return pruned, fmt.Errorf("remove key %s failed: %w", key.id, err)
+			}
+			pruned = append(pruned, key.id)
+		}
+		r.keys = r.keys[:i]
+		break
+	}
+	return pruned, nil
+}
+
+// Run reloads, rotates and prunes the ring until ctx is done.
+func (r *KeyRing) Run(ctx context.Context, logger *zap.SugaredLogger) {
+	if !r.rotatable() {
+		return
+	}
+	ticker := time.NewTicker(keyRingCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Reload(); err != nil {
+			logger.Errorf("signing keys reload failed: %s", err.Error())
+			continue
+		}
+		if r.rotationInterval > 0 && time.Since(r.active().created) >= r.rotationInterval {
+			kid, err := r.Rotate()
+			if err != nil {
+				logger.Errorf("signing key rotation failed: %s", err.Error())
+			} else {
+				logger.Infof("signing key rotated, new key %s", kid)
+			}
+		}
+		pruned, err := r.prune()
+		if err != nil {
+			logger.Errorf("signing keys pruning failed: %s", err.Error())
+		}
+		for _, kid := range pruned {
+			logger.Infof("signing key %s retired", kid)
+		}
+	}
+}
+
+func (r *KeyRing) active() *ringKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys[0]
+}
+
+// signing returns the key new tokens are signed with.
+func (r *KeyRing) signing() *signingKey {
+	return r.active().signingKey
+}
+
+// verification returns the key with the given kid. Tokens issued before key
+// ids were introduced carry none and are accepted only by an HS256 key.
+func (r *KeyRing) verification(kid string) (*signingKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.id == kid || kid == "" && key.method.Alg() == "HS256" {
+			return key.signingKey, true
+		}
+	}
+	return nil, false
+}
+
+func (r *KeyRing) jwks() models.JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := models.JWKSet{Keys: []models.JWK{}}
+	for _, key := range r.keys {
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func keyFileName(created time.Time, kid string) string {
+	return fmt.Sprintf("%d_%s%s", created.UnixNano(), kid, keyFileExt)
+}
+
+func parseKeyFileName(name string) (time.Time, string, bool) {
+	if !strings.HasSuffix(name, keyFileExt) {
+		return time.Time{}, "", false
+	}
+	created, kid, ok := strings.Cut(strings.TrimSuffix(name, keyFileExt), "_")
+	if !ok || kid == "" {
+		return time.Time{}, "", false
+	}
+	nanos, err := strconv.ParseInt(created, 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(0, nanos), kid, true
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyRingRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	ring, err := NewKeyRing("ES256", dir, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("key ring creation failed: %s", err)
+	}
+	first := ring.signing().id
+
+	second, err := ring.Rotate()
+	if err != nil {
+		t.Fatalf("rotation failed: %s", err)
+	}
+	if ring.signing().id != second || second == first {
+		t.Fatalf("Expected %s to be the active key, but was %s", second, ring.signing().id)
+	}
+	if _, ok := ring.verification(first); !ok {
+		t.Fatalf("Expected replaced key %s to still verify", first)
+	}
+	if _, ok := ring.verification(""); ok {
+		t.Fatalf("Expected tokens without kid to be rejected")
+	}
+	if n := len(ring.jwks().Keys); n != 2 {
+		t.Fatalf("Expected 2 published keys, but was %d", n)
+	}
+
+	// Another replica sharing the directory sees the same active key.
+	replica, err := NewKeyRing("ES256", dir, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("key ring loading failed: %s", err)
+	}
+	if replica.signing().id != second {
+		t.Fatalf("Expected replica to sign with %s, but was %s", second, replica.signing().id)
+	}
+
+	ring.retention = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	pruned, err := ring.prune()
+	if err != nil {
+		t.Fatalf("pruning failed: %s", err)
+	}
+	if len(pruned) != 1 || pruned[0] != first {
+		t.Fatalf("Expected %s to be pruned, but was %v", first, pruned)
+	}
+	if _, ok := ring.verification(first); ok {
+		t.Fatalf("Expected pruned key %s not to verify", first)
+	}
+	if err := replica.Reload(); err != nil {
+		t.Fatalf("reload failed: %s", err)
+	}
+	if _, ok := replica.verification(first); ok {
+		t.Fatalf("Expected replica to drop pruned key %s", first)
+	}
+}
+
+func TestStaticKeyRing(t *testing.T) {
+	key, _ := newSigningKey("", "HS256", []byte("secret"))
+	ring := newStaticKeyRing(key)
+
+	if _, err := ring.Rotate(); err == nil {
+		t.Fatalf("Expected static key ring rotation to fail")
+	}
+	if _, ok := ring.verification(""); !ok {
+		t.Fatalf("Expected HS256 ring to accept tokens without kid")
+	}
+	if n := len(ring.jwks().Keys); n != 0 {
+		t.Fatalf("Expected no published keys, but was %d", n)
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const (
+	unsupportedAlgorithm = "unsupported signing algorithm"
+	keyAlgorithmMismatch = "key does not match signing algorithm"
+	hmacKeyID            = "hs256"
+)
+
+// signingKey is a key used to sign or verify tokens. For asymmetric methods
+// private may be nil when the key is only used for verification.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case "HS256", "RS256", "ES256", "EdDSA":
+		return jwt.GetSigningMethod(algorithm), nil
+	}
+	return nil, fmt.Errorf("%s: %s", unsupportedAlgorithm, algorithm)
+}
+
+// newSigningKey wraps a private key (or HMAC secret) for algorithm. When id
+// is empty it is derived from the RFC 7638 thumbprint of the public key.
+func newSigningKey(id, algorithm string, private interface{}) (*signingKey, error) {
+	method, err := signingMethod(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	k := &signingKey{id: id, method: method, private: private}
+
+	switch key := private.(type) {
+	case []byte:
+		if algorithm != "HS256" {
+			return nil, fmt.Errorf(keyAlgorithmMismatch)
+		}
+		k.public = key
+		if k.id == "" {
+			k.id = hmacKeyID
+		}
+		return k, nil
+	case *rsa.PrivateKey:
+		if algorithm != "RS256" {
+			return nil, fmt.Errorf(keyAlgorithmMismatch)
+		}
+		k.public = &key.PublicKey
+	case *ecdsa.PrivateKey:
+		if algorithm != "ES256" || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf(keyAlgorithmMismatch)
+		}
+		k.public = &key.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != "EdDSA" {
+			return nil, fmt.Errorf(keyAlgorithmMismatch)
+		}
+		k.public = key.Public()
+	default:
+		return nil, fmt.Errorf(keyAlgorithmMismatch)
+	}
+
+	if k.id == "" {
+		k.id, err = k.thumbprint()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// generateSigningKey creates a fresh private key for algorithm.
+func generateSigningKey(algorithm string) (*signingKey, error) {
+	var (
+		private interface{}
+		err     error
+	)
+	switch algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%s: %s", unsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key generation failed: %w", err)
+	}
+	return newSigningKey("", algorithm, private)
+}
+
+// loadSigningKey reads a PEM encoded private key for algorithm from path.
+func loadSigningKey(id, algorithm, path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file %s failed: %w", path, err)
+	}
+	var private interface{}
+	switch algorithm {
+	case "RS256":
+		private, err = jwt.ParseRSAPrivateKeyFromPEM(data)
+	case "ES256":
+		private, err = jwt.ParseECPrivateKeyFromPEM(data)
+	case "EdDSA":
+		private, err = jwt.ParseEdPrivateKeyFromPEM(data)
+	default:
+		return nil, fmt.Errorf("%s: %s", unsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse key file %s failed: %w", path, err)
+	}
+	return newSigningKey(id, algorithm, private)
+}
+
+// jwk returns the public part of the key. HMAC keys are never published.
+func (k *signingKey) jwk() (models.JWK, bool) {
+	jwk := models.JWK{
+		Kid: k.id,
+		Use: "sig",
+		Alg: k.method.Alg(),
+	}
+	switch key := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64url(key.N.Bytes())
+		jwk.E = b64url(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = key.Curve.Params().Name
+		jwk.X = b64url(key.X.FillBytes(make([]byte, size)))
+		jwk.Y = b64url(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64url(key)
+	default:
+		return models.JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of the public key.
+func (k *signingKey) thumbprint() (string, error) {
+	jwk, ok := k.jwk()
+	if !ok {
+		return "", fmt.Errorf("thumbprint of symmetric key requested")
+	}
+	// Required members only, in lexicographic order.
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return b64url(sum[:]), nil
+}
+
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signingKeyFromConfig loads the key described by the signing section. HS256
+// keeps using the shared auth secret. An asymmetric algorithm without a key
+// file gets a freshly generated key, which does not survive a restart.
+func signingKeyFromConfig(cfg *config.Config) (key *signingKey, generated bool, err error) {
+	c := cfg.Auth.Signing
+	algorithm := c.Algorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	if algorithm == "HS256" {
+		key, err = newSigningKey(c.KeyID, algorithm, []byte(cfg.Auth.Secret))
+		return key, false, err
+	}
+	if c.PrivateKeyFile == "" {
+		key, err = generateSigningKey(algorithm)
+		return key, true, err
+	}
+	key, err = loadSigningKey(c.KeyID, algorithm, c.PrivateKeyFile)
+	return key, false, err
+}
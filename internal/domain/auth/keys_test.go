@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func TestSigningKeys(t *testing.T) {
+	cases := []struct {
+		algorithm string
+		kty       string
+	}{
+		{algorithm: "RS256", kty: "RSA"},
+		{algorithm: "ES256", kty: "EC"},
+		{algorithm: "EdDSA", kty: "OKP"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.algorithm, func(t *testing.T) {
+			key, err := generateSigningKey(c.algorithm)
+			if err != nil {
+				t.Fatalf("key generation failed: %s", err)
+			}
+			jwk, ok := key.jwk()
+			if !ok || jwk.Kty != c.kty || jwk.Alg != c.algorithm || jwk.Kid != key.id {
+				t.Fatalf("Unexpected JWK %+v", jwk)
+			}
+
+			token := jwt.NewWithClaims(key.method, jwt.StandardClaims{Subject: "test123"})
+			token.Header["kid"] = key.id
+			signed, err := token.SignedString(key.private)
+			if err != nil {
+				t.Fatalf("signing failed: %s", err)
+			}
+			parsed, err := jwt.ParseWithClaims(signed, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+				return key.public, nil
+			})
+			if err != nil || !parsed.Valid || parsed.Header["kid"] != key.id {
+				t.Fatalf("verification failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestSigningKeyHMACNotPublished(t *testing.T) {
+	key, err := newSigningKey("", "HS256", []byte("secret"))
+	if err != nil {
+		t.Fatalf("key creation failed: %s", err)
+	}
+	if key.id != hmacKeyID {
+		t.Fatalf("Expected kid %s, but was %s", hmacKeyID, key.id)
+	}
+	if _, ok := key.jwk(); ok {
+		t.Fatalf("Expected HMAC key not to be published")
+	}
+	if _, err := newSigningKey("", "RS256", []byte("secret")); err == nil {
+		t.Fatalf("Expected error for mismatching key and algorithm")
+	}
+}
+
+// RFC 7638, section 3.1.
+func TestSigningKeyThumbprint(t *testing.T) {
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	key := &signingKey{
+		method: jwt.SigningMethodRS256,
+		public: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537},
+	}
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		t.Fatalf("thumbprint failed: %s", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("Unexpected thumbprint %s", thumbprint)
+	}
+}
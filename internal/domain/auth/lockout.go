@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+// lockoutPolicy slows down password guessing. Once a login or a client
+// address has failed threshold times, every further attempt has to wait
+// baseDelay, doubled with each failure up to maxDelay, after the last one.
+type lockoutPolicy struct {
+	loginThreshold int
+	ipThreshold    int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	resetAfter     time.Duration
+}
+
+func lockoutPolicyFromConfig(cfg *config.Config) lockoutPolicy {
+	c := cfg.Auth.Lockout
+	return lockoutPolicy{
+		loginThreshold: c.LoginThreshold,
+		ipThreshold:    c.IPThreshold,
+		baseDelay:      c.BaseDelay,
+		maxDelay:       c.MaxDelay,
+		resetAfter:     c.ResetAfter,
+	}
+}
+
+// delay returns how long to wait after the last of count failures.
+func (p lockoutPolicy) delay(count, threshold int) time.Duration {
+	if threshold <= 0 || count < threshold {
+		return 0
+	}
+	if shift := count - threshold; shift < 32 {
+		if delay := p.baseDelay << shift; delay < p.maxDelay {
+			return delay
+		}
+	}
+	return p.maxDelay
+}
+
+type lockoutKey struct {
+	key       string
+	threshold int
+}
+
+// lockoutKeys returns the counters of login and of the client address. The
+// address is the connection peer, or the client a trusted proxy reports, as
+// set by the adapters.
+func (s *Service) lockoutKeys(ctx context.Context, login string) []lockoutKey {
+	keys := []lockoutKey{{key: "login:" + login, threshold: s.lockout.loginThreshold}}
+	if ip, _ := ctx.Value(utils.CtxKeyRemoteIPGet()).(string); ip != "" {
+		keys = append(keys, lockoutKey{key: "ip:" + clientNetwork(ip), threshold: s.lockout.ipThreshold})
+	}
+	return keys
+}
+
+// clientNetwork returns the canonical form of ip. IPv6 clients are counted
+// per /64, which a single host usually gets whole and can rotate through.
+func clientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return ip
+	case parsed.To4() != nil:
+		return parsed.To4().String()
+	}
+	network := net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}
+	return network.String()
+}
+
+// checkLockout returns a RetryAfterError while login or the client address
+// has to wait before the next attempt.
+func (s *Service) checkLockout(ctx context.Context, login string) error {
+	var wait time.Duration
+	for _, k := range s.lockoutKeys(ctx, login) {
+		if k.threshold <= 0 {
+			continue
+		}
+		failures, err := s.attempts.GetLoginFailures(ctx, k.key)
+		if errors.Is(err, domainerrors.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get login failures failed: %w", err)
+		}
+		until := failures.LastFailureAt.Add(s.lockout.delay(failures.Count, k.threshold))
+		if left := time.Until(until); left > wait {
+			wait = left
+		}
+	}
+	if wait > 0 {
+		return &domainerrors.RetryAfterError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed attempt against login and the client
+// address. Errors are only logged so that they do not hide the failure.
+func (s *Service) recordLoginFailure(ctx context.Context, login string) {
+	logger := s.annotatedLogger(ctx)
+
+	for _, k := range s.lockoutKeys(ctx, login) {
+		if k.threshold <= 0 {
+			continue
+		}
+		failures, err := s.attempts.RecordLoginFailure(ctx, k.key, time.Now(), s.lockout.resetAfter)
+		if err != nil {
+			logger.Errorf("record login failure for %s failed: %s", k.key, err.Error())
+			continue
+		}
+		if failures.Count == k.threshold {
+			logger.With(
+				"security_event", "login_lockout",
+				"key", k.key,
+			).Warnf("%s reached %d failed logins, delaying further attempts", k.key, failures.Count)
+		}
+	}
+}
+
+// resetLoginFailures forgets the failures of login after a successful login.
+// Client address counters are kept: one valid account must not let an
+// address keep guessing others.
+func (s *Service) resetLoginFailures(ctx context.Context, login string) {
+	if err := s.attempts.ResetLoginFailures(ctx, "login:"+login); err != nil {
+		s.annotatedLogger(ctx).Errorf("reset login failures of %s failed: %s", login, err.Error())
+	}
+}
+
+// UnlockLogin lifts a lockout of login before it expires. Domain
+// administrators only unlock existing users of their domain.
+func (s *Service) UnlockLogin(ctx context.Context, actor *models.User, login string) error {
+	logger := s.annotatedLogger(ctx)
+
+	if actor.Role != models.RoleAdmin {
+		if _, err := s.GetUser(ctx, actor, login); err != nil {
+			return err
+		}
+	}
+	if err := s.attempts.ResetLoginFailures(ctx, "login:"+login); err != nil {
+		logger.Errorf("reset login failures of %s failed: %s", login, err.Error())
+		return fmt.Errorf("unlock login %s failed", login)
+	}
+	logger.Infof("login %s unlocked", login)
+	return nil
+}
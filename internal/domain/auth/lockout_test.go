@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+func TestLockoutDelay(t *testing.T) {
+	p := lockoutPolicy{baseDelay: time.Second, maxDelay: time.Minute}
+	cases := []struct {
+		count     int
+		threshold int
+		delay     time.Duration
+	}{
+		{count: 2, threshold: 3, delay: 0},
+		{count: 3, threshold: 3, delay: time.Second},
+		{count: 5, threshold: 3, delay: 4 * time.Second},
+		{count: 10, threshold: 3, delay: time.Minute},
+		{count: 100, threshold: 3, delay: time.Minute},
+		{count: 100, threshold: 0, delay: 0},
+	}
+	for _, c := range cases {
+		if delay := p.delay(c.count, c.threshold); delay != c.delay {
+			t.Fatalf("Expected %s after %d of %d failures, but was %s", c.delay, c.count, c.threshold, delay)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.WithValue(context.Background(), utils.CtxKeyRemoteIPGet(), "10.0.0.1")
+
+	for i := 0; i < s.lockout.loginThreshold; i++ {
+		if _, err := s.Login(ctx, "test123", "wrong"); err == nil || errors.Is(err, domainerrors.ErrTooManyLogins) {
+			t.Fatalf("Expected invalid password, but was %v", err)
+		}
+	}
+	_, err := s.Login(ctx, "test123", "qwerty")
+	var retry *domainerrors.RetryAfterError
+	if !errors.As(err, &retry) || retry.RetryAfter <= 0 || retry.RetryAfter > s.lockout.baseDelay {
+		t.Fatalf("Expected lockout with retry delay, but was %v", err)
+	}
+
+	if err := s.UnlockLogin(ctx, operator, "test123"); err != nil {
+		t.Fatalf("unlock failed: %s", err)
+	}
+	if _, err := s.Login(ctx, "test123", "qwerty"); err != nil {
+		t.Fatalf("Expected login after unlock, but was %v", err)
+	}
+}
+
+func TestAddressLockout(t *testing.T) {
+	s := newTestService(t)
+
+	// Addresses of one IPv6 /64 share a counter.
+	for i := 0; i < s.lockout.ipThreshold; i++ {
+		ctx := context.WithValue(context.Background(), utils.CtxKeyRemoteIPGet(), fmt.Sprintf("2001:db8::%x", i+1))
+		if _, err := s.Login(ctx, fmt.Sprintf("guess%d", i), "wrong"); err == nil {
+			t.Fatalf("Expected invalid login")
+		}
+	}
+	ctx := context.WithValue(context.Background(), utils.CtxKeyRemoteIPGet(), "2001:db8::ffff")
+	var retry *domainerrors.RetryAfterError
+	if _, err := s.Login(ctx, "test123", "qwerty"); !errors.As(err, &retry) {
+		t.Fatalf("Expected lockout of the network, but was %v", err)
+	}
+	ctx = context.WithValue(context.Background(), utils.CtxKeyRemoteIPGet(), "2001:db8:0:1::1")
+	if _, err := s.Login(ctx, "test123", "qwerty"); err != nil {
+		t.Fatalf("Expected login from another network, but was %v", err)
+	}
+}
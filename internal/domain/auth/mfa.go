@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const (
+	mfaChallengeTTL     = 5 * time.Minute
+	purposeMFAChallenge = "mfa"
+	qrCodeSize          = 256
+)
+
+// requireMFA returns a MFARequiredError with a challenge token if user has
+// confirmed a TOTP secret. The challenge only proves the password and is
+// exchanged for tokens by LoginMFA.
+func (s *Service) requireMFA(ctx context.Context, user *models.User) error {
+	logger := s.annotatedLogger(ctx)
+
+	enabled, err := s.mfaEnabled(ctx, user.Login)
+	if err != nil {
+		logger.Errorf("get mfa of login %s failed: %s", user.Login, err.Error())
+		return fmt.Errorf("get mfa of login %s failed", user.Login)
+	}
+	if !enabled {
+		return nil
+	}
+	token, err := s.generateToken(ctx, &tokenClaims{Login: user.Login, Purpose: purposeMFAChallenge}, mfaChallengeTTL)
+	if err != nil {
+		logger.Errorf("generate mfa challenge for login %s failed: %s", user.Login, err.Error())
+		return fmt.Errorf("generate mfa challenge for login %s failed", user.Login)
+	}
+	return &domainerrors.MFARequiredError{ChallengeToken: token}
+}
+
+func (s *Service) mfaEnabled(ctx context.Context, login string) (bool, error) {
+	totp, err := s.mfa.GetTOTP(ctx, login)
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return totp.Confirmed, nil
+}
+
+// LoginMFA completes a login that returned a MFARequiredError with a TOTP
+// code or, if the authenticator is lost, a recovery code. Wrong codes
+// count as failed logins, so guessing is throttled by the lockout, and a
+// challenge is used up by its first success.
+func (s *Service) LoginMFA(ctx context.Context, challengeToken, code string) (models.TokenPair, error) {
+	logger := s.annotatedLogger(ctx)
+
+	claims, err := s.parsePurposeToken(ctx, challengeToken, purposeMFAChallenge)
+	if err == nil && s.tokenExpired(claims) {
+		err = fmt.Errorf("mfa challenge expired")
+	}
+	if err == nil {
+		err = s.checkNotRevoked(ctx, claims)
+	}
+	if err != nil {
+		logger.Errorf("mfa challenge rejected: %s", err.Error())
+		return models.TokenPair{}, fmt.Errorf("mfa challenge rejected: %w", domainerrors.ErrTokenInvalid)
+	}
+	login := claims.Login
+	if err := s.checkLockout(ctx, login); err != nil {
+		logger.Errorf("login %s rejected: %s", login, err.Error())
+		return models.TokenPair{}, fmt.Errorf("login %s rejected: %w", login, err)
+	}
+	user, err := s.getUser(ctx, claims)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	totp, err := s.mfa.GetTOTP(ctx, login)
+	if err != nil || !totp.Confirmed {
+		logger.Errorf("no confirmed totp for login %s", login)
+		return models.TokenPair{}, fmt.Errorf("no confirmed totp for login %s: %w", login, domainerrors.ErrInvalidCode)
+	}
+	if isTOTPCode(code) {
+		err = s.useTOTPCode(ctx, totp, code)
+	} else {
+		err = s.useRecoveryCode(ctx, login, code)
+	}
+	if err != nil {
+		s.recordLoginFailure(ctx, login)
+		return models.TokenPair{}, err
+	}
+	s.resetLoginFailures(ctx, login)
+	if err := s.revokeToken(ctx, claims); err != nil {
+		logger.Errorf("use up mfa challenge of login %s failed: %s", login, err.Error())
+		return models.TokenPair{}, fmt.Errorf("use up mfa challenge of login %s failed", login)
+	}
+	return s.issueTokens(ctx, user)
+}
+
+// useTOTPCode accepts code if it is valid now and its time step has not been
+// used yet.
+func (s *Service) useTOTPCode(ctx context.Context, totp *models.TOTP, code string) error {
+	logger := s.annotatedLogger(ctx)
+
+	step, ok := s.totp.match(totp.Secret, code, time.Now())
+	if !ok {
+		logger.Errorf("invalid totp code for login %s", totp.Login)
+		return fmt.Errorf("invalid totp code for login %s: %w", totp.Login, domainerrors.ErrInvalidCode)
+	}
+	err := s.mfa.UseTOTPStep(ctx, totp.Login, step)
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		logger.Errorf("reused totp code for login %s", totp.Login)
+		return fmt.Errorf("reused totp code for login %s: %w", totp.Login, domainerrors.ErrInvalidCode)
+	}
+	if err != nil {
+		logger.Errorf("use totp step of login %s failed: %s", totp.Login, err.Error())
+		return fmt.Errorf("use totp step of login %s failed", totp.Login)
+	}
+	return nil
+}
+
+// EnrollTOTP generates a new TOTP secret for login. It guards logins once
+// ConfirmTOTP has seen a code from it; until then enrolling again replaces
+// it.
+func (s *Service) EnrollTOTP(ctx context.Context, login string) (*models.TOTPEnrollment, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if err := s.allowMFA(ctx, login, models.MFAMethodTOTP); err != nil {
+		return nil, err
+	}
+	enabled, err := s.mfaEnabled(ctx, login)
+	if err != nil {
+		logger.Errorf("get mfa of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("get mfa of login %s failed", login)
+	}
+	if enabled {
+		logger.Errorf("totp of login %s is already enabled", login)
+		return nil, fmt.Errorf("totp of login %s: %w", login, domainerrors.ErrAlreadyExists)
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		logger.Errorf("generate totp secret failed: %s", err.Error())
+		return nil, fmt.Errorf("generate totp secret failed")
+	}
+	uri := s.totp.uri(login, secret)
+	qr, err := qrcode.Encode(uri, qrcode.Medium, qrCodeSize)
+	if err != nil {
+		logger.Errorf("encode totp qr code failed: %s", err.Error())
+		return nil, fmt.Errorf("encode totp qr code failed")
+	}
+	if err := s.mfa.SaveTOTP(ctx, &models.TOTP{Login: login, Secret: secret, CreatedAt: time.Now()}); err != nil {
+		logger.Errorf("save totp of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("save totp of login %s failed", login)
+	}
+	return &models.TOTPEnrollment{Secret: secret, URI: uri, QRCode: qr}, nil
+}
+
+// ConfirmTOTP enables the enrolled secret of login once code proves the
+// authenticator app has it, and returns the first batch of recovery codes.
+func (s *Service) ConfirmTOTP(ctx context.Context, login, code string) ([]string, error) {
+	logger := s.annotatedLogger(ctx)
+
+	totp, err := s.mfa.GetTOTP(ctx, login)
+	if err != nil {
+		logger.Errorf("get totp of login %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("get totp of login %s failed", login), err)
+	}
+	if totp.Confirmed {
+		logger.Errorf("totp of login %s is already enabled", login)
+		return nil, fmt.Errorf("totp of login %s: %w", login, domainerrors.ErrAlreadyExists)
+	}
+	if err := s.useTOTPCode(ctx, totp, code); err != nil {
+		return nil, err
+	}
+	totp, err = s.mfa.GetTOTP(ctx, login)
+	if err != nil {
+		logger.Errorf("get totp of login %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("get totp of login %s failed", login), err)
+	}
+	// Codes come first so that 2FA is never enabled without them.
+	codes, err := s.newRecoveryCodes(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+	totp.Confirmed = true
+	if err := s.mfa.SaveTOTP(ctx, totp); err != nil {
+		logger.Errorf("save totp of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("save totp of login %s failed", login)
+	}
+	logger.With("security_event", "mfa_enabled").Infof("totp of login %s enabled", login)
+	return codes, nil
+}
+
+// DisableTOTP removes the TOTP secret and recovery codes of login. It
+// requires a current code, so that a stolen session alone cannot turn 2FA
+// off.
+func (s *Service) DisableTOTP(ctx context.Context, login, code string) error {
+	logger := s.annotatedLogger(ctx)
+
+	totp, err := s.mfa.GetTOTP(ctx, login)
+	if err != nil {
+		logger.Errorf("get totp of login %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("get totp of login %s failed", login), err)
+	}
+	if totp.Confirmed {
+		if err := s.useTOTPCode(ctx, totp, code); err != nil {
+			return err
+		}
+	}
+	if err := s.mfa.DeleteTOTP(ctx, login); err != nil {
+		logger.Errorf("delete totp of login %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("delete totp of login %s failed", login), err)
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, login, nil); err != nil {
+		logger.Errorf("delete recovery codes of login %s failed: %s", login, err.Error())
+	}
+	logger.With("security_event", "mfa_disabled").Infof("totp of login %s disabled", login)
+	return nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+// currentTOTPCode returns the code of secret for the current time step.
+func currentTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret failed: %s", err)
+	}
+	return hotp(key, time.Now().Unix()/int64(totpPeriod.Seconds()))
+}
+
+func TestLoginMFA(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	enrollment, err := s.EnrollTOTP(ctx, "test123")
+	if err != nil || enrollment.Secret == "" || len(enrollment.QRCode) == 0 {
+		t.Fatalf("enroll failed: %v", err)
+	}
+	// Unconfirmed secrets do not guard logins yet.
+	if _, err := s.Login(ctx, "test123", "qwerty"); err != nil {
+		t.Fatalf("Expected login without mfa, but was %v", err)
+	}
+	if _, err := s.ConfirmTOTP(ctx, "test123", "000000"); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+	code := currentTOTPCode(t, enrollment.Secret)
+	if _, err := s.ConfirmTOTP(ctx, "test123", code); err != nil {
+		t.Fatalf("confirm failed: %s", err)
+	}
+
+	_, err = s.Login(ctx, "test123", "qwerty")
+	var mfa *domainerrors.MFARequiredError
+	if !errors.As(err, &mfa) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrMFARequired, err)
+	}
+	if _, err := s.Validate(ctx, mfa.ChallengeToken); err == nil {
+		t.Fatalf("Expected challenge token to be refused as access token")
+	}
+	// The code used for confirmation cannot be replayed.
+	if _, err := s.LoginMFA(ctx, mfa.ChallengeToken, code); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+
+	// Use a code of the next time step, which the skew allows.
+	key, _ := totpEncoding.DecodeString(enrollment.Secret)
+	next := hotp(key, time.Now().Unix()/int64(totpPeriod.Seconds())+1)
+	tokens, err := s.LoginMFA(ctx, mfa.ChallengeToken, next)
+	if err != nil {
+		t.Fatalf("mfa login failed: %s", err)
+	}
+	if _, err := s.Validate(ctx, tokens.AuthToken); err != nil {
+		t.Fatalf("Expected valid access token, but was %v", err)
+	}
+	if _, err := s.LoginMFA(ctx, mfa.ChallengeToken, next); !errors.Is(err, domainerrors.ErrTokenInvalid) {
+		t.Fatalf("Expected used challenge to be refused, but was %v", err)
+	}
+}
+
+func TestLoginRecoveryCode(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	enrollment, _ := s.EnrollTOTP(ctx, "test123")
+	codes, err := s.ConfirmTOTP(ctx, "test123", currentTOTPCode(t, enrollment.Secret))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, but was %d, %v", recoveryCodeCount, len(codes), err)
+	}
+	login := func(code string) error {
+		_, err := s.Login(ctx, "test123", "qwerty")
+		var mfa *domainerrors.MFARequiredError
+		if !errors.As(err, &mfa) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrMFARequired, err)
+		}
+		_, err = s.LoginMFA(ctx, mfa.ChallengeToken, code)
+		return err
+	}
+
+	// Codes are accepted in any case and without dashes, but only once.
+	typed := strings.ToLower(strings.ReplaceAll(codes[0], "-", ""))
+	if err := login(typed); err != nil {
+		t.Fatalf("recovery code login failed: %s", err)
+	}
+	if err := login(codes[0]); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+	if left, err := s.RecoveryCodesLeft(ctx, "test123"); err != nil || left != recoveryCodeCount-1 {
+		t.Fatalf("Expected %d codes left, but was %d, %v", recoveryCodeCount-1, left, err)
+	}
+
+	// Regeneration invalidates the old batch.
+	key, _ := totpEncoding.DecodeString(enrollment.Secret)
+	next := hotp(key, time.Now().Unix()/int64(totpPeriod.Seconds())+1)
+	fresh, err := s.RegenerateRecoveryCodes(ctx, "test123", next)
+	if err != nil || len(fresh) != recoveryCodeCount {
+		t.Fatalf("regenerate failed: %v", err)
+	}
+	if err := login(codes[1]); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+	if err := login(fresh[0]); err != nil {
+		t.Fatalf("recovery code login failed: %s", err)
+	}
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+)
+
+const (
+	saltLength            = 16
+	unknownHashFormat     = "unknown password hash format"
+	unknownHashAlgorithm  = "unknown password hashing algorithm"
+	malformedPasswordHash = "malformed password hash"
+)
+
+// PasswordHasher hashes passwords into self-describing strings (PHC string
+// format or, for bcrypt, modular crypt format) and verifies passwords against
+// them. Parameters needed for verification travel inside the encoded hash.
+type PasswordHasher interface {
+	// ID returns the algorithm identifier used in the encoded hash.
+	ID() string
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded. Comparison is done in
+	// constant time.
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was produced with parameters other
+	// than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// passwordHashers holds the hasher used for new hashes and every hasher able
+// to verify hashes already stored.
+type passwordHashers struct {
+	current PasswordHasher
+	known   map[string]PasswordHasher
+}
+
+func newPasswordHashers(current PasswordHasher, others ...PasswordHasher) *passwordHashers {
+	h := &passwordHashers{
+		current: current,
+		known:   map[string]PasswordHasher{},
+	}
+	for _, hasher := range append([]PasswordHasher{current}, others...) {
+		h.known[hasher.ID()] = hasher
+	}
+	return h
+}
+
+func (h *passwordHashers) hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *passwordHashers) verify(password, encoded string) (bool, error) {
+	hasher, err := h.lookup(encoded)
+	if err != nil {
+		return false, err
+	}
+	return hasher.Verify(password, encoded)
+}
+
+// needsRehash reports whether encoded should be replaced by a hash from the
+// current hasher, either because it uses another algorithm or outdated cost
+// parameters.
+func (h *passwordHashers) needsRehash(encoded string) bool {
+	hasher, err := h.lookup(encoded)
+	if err != nil || hasher.ID() != h.current.ID() {
+		return true
+	}
+	return hasher.NeedsRehash(encoded)
+}
+
+func (h *passwordHashers) lookup(encoded string) (PasswordHasher, error) {
+	id, ok := hashID(encoded)
+	if !ok {
+		return nil, fmt.Errorf(unknownHashFormat)
+	}
+	hasher, ok := h.known[id]
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", unknownHashAlgorithm, id)
+	}
+	return hasher, nil
+}
+
+// hashID extracts the algorithm identifier from "$id$...". bcrypt variants
+// are reported under the single "bcrypt" identifier and bare hex strings are
+// legacy SHA-1 hashes.
+func hashID(encoded string) (string, bool) {
+	if isHex(encoded) {
+		return legacySHA1ID, true
+	}
+	parts := strings.SplitN(encoded, "$", 3)
+	if len(parts) < 3 || parts[0] != "" || parts[1] == "" {
+		return "", false
+	}
+	switch parts[1] {
+	case "2a", "2b", "2y":
+		return bcryptID, true
+	}
+	return parts[1], true
+}
+
+// phcParams parses a "k1=v1,k2=v2" PHC parameter segment.
+func phcParams(segment string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, kv := range strings.Split(segment, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: bad parameter %q", malformedPasswordHash, kv)
+		}
+		params[k] = v
+	}
+	return params, nil
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func phcEncode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
+
+func phcDecode(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// passwordHashersFromConfig builds the hasher set from the password_hashing
+// section; the configured algorithm hashes new passwords while the other
+// supported algorithms, including legacy SHA-1, stay available for
+// verification.
+func passwordHashersFromConfig(cfg *config.Config) (*passwordHashers, error) {
+	c := cfg.Auth.PasswordHashing
+	all := []PasswordHasher{
+		NewArgon2idHasher(c.Argon2id.Memory, c.Argon2id.Iterations, c.Argon2id.Parallelism),
+		NewBcryptHasher(c.Bcrypt.Cost),
+		NewScryptHasher(c.Scrypt.LogN, c.Scrypt.R, c.Scrypt.P),
+	}
+	algorithm := c.Algorithm
+	if algorithm == "" {
+		algorithm = argon2idID
+	}
+	for i, hasher := range all {
+		if hasher.ID() == algorithm {
+			others := append(append([]PasswordHasher{}, all[:i]...), all[i+1:]...)
+			others = append(others, NewLegacySHA1Hasher(cfg.Auth.Salt))
+			return newPasswordHashers(hasher, others...), nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %s", unknownHashAlgorithm, algorithm)
+}
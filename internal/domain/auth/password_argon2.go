@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idID        = "argon2id"
+	argon2idKeyLength = 32
+)
+
+type argon2idHasher struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// NewArgon2idHasher returns a hasher producing
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>.
+func NewArgon2idHasher(memory, iterations uint32, parallelism uint8) PasswordHasher {
+	return &argon2idHasher{
+		memory:      memory,
+		iterations:  iterations,
+		parallelism: parallelism,
+	}
+}
+
+func (h *argon2idHasher) ID() string {
+	return argon2idID
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", fmt.Errorf("salt generation failed: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.iterations, h.memory, h.parallelism, argon2idKeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID, argon2.Version, h.memory, h.iterations, h.parallelism, phcEncode(salt), phcEncode(key)), nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.memory ||
+		p.iterations != h.iterations ||
+		p.parallelism != h.parallelism ||
+		len(p.key) != argon2idKeyLength
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != argon2idID {
+		return nil, fmt.Errorf(malformedPasswordHash)
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, fmt.Errorf("%s: unsupported argon2 version %s", malformedPasswordHash, parts[2])
+	}
+	params, err := phcParams(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	m, errM := strconv.ParseUint(params["m"], 10, 32)
+	t, errT := strconv.ParseUint(params["t"], 10, 32)
+	p, errP := strconv.ParseUint(params["p"], 10, 8)
+	if errM != nil || errT != nil || errP != nil {
+		return nil, fmt.Errorf("%s: bad argon2id parameters", malformedPasswordHash)
+	}
+	salt, err := phcDecode(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", malformedPasswordHash, err.Error())
+	}
+	key, err := phcDecode(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("%s: bad argon2id hash", malformedPasswordHash)
+	}
+	return &argon2idParams{
+		memory:      uint32(m),
+		iterations:  uint32(t),
+		parallelism: uint8(p),
+		salt:        salt,
+		key:         key,
+	}, nil
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"fmt"
+)
+
+const legacySHA1ID = "sha1"
+
+// legacySHA1Hasher verifies hashes produced before adaptive hashing was
+// introduced: hex(salt || sha1(password)) with a single global salt. It is
+// kept only so such hashes can be upgraded on the next successful login.
+type legacySHA1Hasher struct {
+	salt string
+}
+
+func NewLegacySHA1Hasher(salt string) PasswordHasher {
+	return &legacySHA1Hasher{salt: salt}
+}
+
+func (h *legacySHA1Hasher) ID() string {
+	return legacySHA1ID
+}
+
+func (h *legacySHA1Hasher) Hash(password string) (string, error) {
+	hash := sha1.New()
+	hash.Write([]byte(password))
+	return fmt.Sprintf("%x", hash.Sum([]byte(h.salt))), nil
+}
+
+func (h *legacySHA1Hasher) Verify(password, encoded string) (bool, error) {
+	expected, _ := h.Hash(password)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(encoded)) == 1, nil
+}
+
+func (h *legacySHA1Hasher) NeedsRehash(encoded string) bool {
+	return true
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
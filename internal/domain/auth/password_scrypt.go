@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	scryptID        = "scrypt"
+	scryptKeyLength = 32
+)
+
+type scryptHasher struct {
+	logN uint8
+	r    int
+	p    int
+}
+
+// NewScryptHasher returns a hasher producing
+// $scrypt$ln=<logN>,r=<r>,p=<p>$<salt>$<hash>.
+func NewScryptHasher(logN uint8, r, p int) PasswordHasher {
+	return &scryptHasher{
+		logN: logN,
+		r:    r,
+		p:    p,
+	}
+}
+
+func (h *scryptHasher) ID() string {
+	return scryptID
+}
+
+func (h *scryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", fmt.Errorf("salt generation failed: %w", err)
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, scryptKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("scrypt hashing failed: %w", err)
+	}
+	return fmt.Sprintf("$%s$ln=%d,r=%d,p=%d$%s$%s",
+		scryptID, h.logN, h.r, h.p, phcEncode(salt), phcEncode(key)), nil
+}
+
+func (h *scryptHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parseScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), p.salt, 1<<p.logN, p.r, p.p, len(p.key))
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", malformedPasswordHash, err.Error())
+	}
+	return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+}
+
+func (h *scryptHasher) NeedsRehash(encoded string) bool {
+	p, err := parseScrypt(encoded)
+	if err != nil {
+		return true
+	}
+	return p.logN != h.logN || p.r != h.r || p.p != h.p || len(p.key) != scryptKeyLength
+}
+
+type scryptParams struct {
+	logN uint8
+	r    int
+	p    int
+	salt []byte
+	key  []byte
+}
+
+func parseScrypt(encoded string) (*scryptParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != scryptID {
+		return nil, fmt.Errorf(malformedPasswordHash)
+	}
+	params, err := phcParams(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	ln, errLn := strconv.ParseUint(params["ln"], 10, 6)
+	r, errR := strconv.Atoi(params["r"])
+	p, errP := strconv.Atoi(params["p"])
+	if errLn != nil || errR != nil || errP != nil {
+		return nil, fmt.Errorf("%s: bad scrypt parameters", malformedPasswordHash)
+	}
+	salt, err := phcDecode(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", malformedPasswordHash, err.Error())
+	}
+	key, err := phcDecode(parts[4])
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("%s: bad scrypt hash", malformedPasswordHash)
+	}
+	return &scryptParams{
+		logN: uint8(ln),
+		r:    r,
+		p:    p,
+		salt: salt,
+		key:  key,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	cases := []struct {
+		hasher PasswordHasher
+		prefix string
+	}{
+		{
+			hasher: NewArgon2idHasher(1024, 1, 1),
+			prefix: "$argon2id$v=19$m=1024,t=1,p=1$",
+		},
+		{
+			hasher: NewBcryptHasher(4),
+			prefix: "$2a$04$",
+		},
+		{
+			hasher: NewScryptHasher(4, 8, 1),
+			prefix: "$scrypt$ln=4,r=8,p=1$",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.hasher.ID(), func(t *testing.T) {
+			encoded, err := c.hasher.Hash("qwerty")
+			if err != nil {
+				t.Fatalf("Hash failed: %s", err)
+			}
+			if !strings.HasPrefix(encoded, c.prefix) {
+				t.Fatalf("Expected prefix %s, but hash was %s", c.prefix, encoded)
+			}
+			again, _ := c.hasher.Hash("qwerty")
+			if again == encoded {
+				t.Fatalf("Expected distinct salts, but got equal hashes")
+			}
+
+			ok, err := c.hasher.Verify("qwerty", encoded)
+			if err != nil || !ok {
+				t.Fatalf("Expected valid password, but was %t (%v)", ok, err)
+			}
+			ok, err = c.hasher.Verify("qwertz", encoded)
+			if err != nil || ok {
+				t.Fatalf("Expected invalid password, but was %t (%v)", ok, err)
+			}
+			if _, err = c.hasher.Verify("qwerty", encoded[:len(encoded)/2]); err == nil {
+				t.Fatalf("Expected error for malformed hash")
+			}
+		})
+	}
+}
+
+func TestPasswordHashersDispatch(t *testing.T) {
+	argon := NewArgon2idHasher(1024, 1, 1)
+	bcrypt := NewBcryptHasher(4)
+	scrypt := NewScryptHasher(4, 8, 1)
+	h := newPasswordHashers(argon, bcrypt, scrypt)
+
+	for _, hasher := range []PasswordHasher{argon, bcrypt, scrypt} {
+		encoded, _ := hasher.Hash("qwerty")
+		ok, err := h.verify("qwerty", encoded)
+		if err != nil || !ok {
+			t.Fatalf("%s: expected valid password, but was %t (%v)", hasher.ID(), ok, err)
+		}
+	}
+
+	encoded, _ := h.hash("qwerty")
+	if id, _ := hashID(encoded); id != argon.ID() {
+		t.Fatalf("Expected new hashes to use %s, but was %s", argon.ID(), id)
+	}
+	if _, err := h.verify("qwerty", "b1b3773a05c0ed0176787a4f1574ff0075f7521e"); err == nil {
+		t.Fatalf("Expected error for legacy hash without legacy hasher")
+	}
+	if _, err := h.verify("qwerty", "$md5$abc$def"); err == nil {
+		t.Fatalf("Expected error for unknown algorithm")
+	}
+}
+
+func TestPasswordHashersNeedsRehash(t *testing.T) {
+	current := NewArgon2idHasher(1024, 1, 1)
+	h := newPasswordHashers(current, NewBcryptHasher(4), NewLegacySHA1Hasher(""))
+
+	fresh, _ := current.Hash("qwerty")
+	weaker, _ := NewArgon2idHasher(512, 1, 1).Hash("qwerty")
+	other, _ := NewBcryptHasher(4).Hash("qwerty")
+	legacy := "b1b3773a05c0ed0176787a4f1574ff0075f7521e" // sha1("qwerty")
+
+	cases := []struct {
+		name    string
+		encoded string
+		rehash  bool
+	}{
+		{name: "current", encoded: fresh, rehash: false},
+		{name: "outdated parameters", encoded: weaker, rehash: true},
+		{name: "other algorithm", encoded: other, rehash: true},
+		{name: "legacy", encoded: legacy, rehash: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ok, err := h.verify("qwerty", c.encoded)
+			if err != nil || !ok {
+				t.Fatalf("Expected valid password, but was %t (%v)", ok, err)
+			}
+			if h.needsRehash(c.encoded) != c.rehash {
+				t.Fatalf("Expected needsRehash %t", c.rehash)
+			}
+		})
+	}
+}
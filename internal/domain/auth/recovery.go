@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+const (
+	recoveryCodeCount = 10
+	// randomCodeBytes gives recovery codes and app passwords 80 random bits,
+	// enough for an unsalted hash to be safe to store.
+	randomCodeBytes   = 10
+	recoveryCodeGroup = 4
+)
+
+// generateRecoveryCode returns a code such as ABCD-EFGH-2345-6789.
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, randomCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := totpEncoding.EncodeToString(buf)
+	groups := make([]string, 0, len(code)/recoveryCodeGroup)
+	for i := 0; i < len(code); i += recoveryCodeGroup {
+		groups = append(groups, code[i:i+recoveryCodeGroup])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// hashRecoveryCode ignores case, dashes and spaces, which users add or drop
+// when typing a code.
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes replaces the recovery codes of login with a new batch and
+// returns it. Only hashes are stored: the codes are shown this once.
+func (s *Service) newRecoveryCodes(ctx context.Context, login string) ([]string, error) {
+	logger := s.annotatedLogger(ctx)
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			logger.Errorf("generate recovery code failed: %s", err.Error())
+			return nil, fmt.Errorf("generate recovery code failed")
+		}
+		codes[i], hashes[i] = code, hashRecoveryCode(code)
+	}
+	if err := s.mfa.ReplaceRecoveryCodes(ctx, login, hashes); err != nil {
+		logger.Errorf("save recovery codes of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("save recovery codes of login %s failed", login)
+	}
+	logger.With("security_event", "recovery_codes_generated").Infof("recovery codes of login %s generated", login)
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes invalidates the remaining recovery codes of login
+// and returns a new batch. Like disabling 2FA it needs a current TOTP code.
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, login, code string) ([]string, error) {
+	logger := s.annotatedLogger(ctx)
+
+	totp, err := s.mfa.GetTOTP(ctx, login)
+	if err == nil && !totp.Confirmed {
+		err = domainerrors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("get totp of login %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("get totp of login %s failed", login), err)
+	}
+	if err := s.useTOTPCode(ctx, totp, code); err != nil {
+		return nil, err
+	}
+	return s.newRecoveryCodes(ctx, login)
+}
+
+// RecoveryCodesLeft returns the number of unused recovery codes of login.
+func (s *Service) RecoveryCodesLeft(ctx context.Context, login string) (int, error) {
+	logger := s.annotatedLogger(ctx)
+
+	count, err := s.mfa.CountRecoveryCodes(ctx, login)
+	if err != nil {
+		logger.Errorf("count recovery codes of login %s failed: %s", login, err.Error())
+		return 0, fmt.Errorf("count recovery codes of login %s failed", login)
+	}
+	return count, nil
+}
+
+// useRecoveryCode accepts code once instead of a TOTP code.
+func (s *Service) useRecoveryCode(ctx context.Context, login, code string) error {
+	logger := s.annotatedLogger(ctx)
+
+	err := s.mfa.UseRecoveryCode(ctx, login, hashRecoveryCode(code))
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		logger.Errorf("invalid recovery code for login %s", login)
+		return fmt.Errorf("invalid recovery code for login %s: %w", login, domainerrors.ErrInvalidCode)
+	}
+	if err != nil {
+		logger.Errorf("use recovery code of login %s failed: %s", login, err.Error())
+		return fmt.Errorf("use recovery code of login %s failed", login)
+	}
+	left, _ := s.mfa.CountRecoveryCodes(ctx, login)
+	logger.With(
+		"security_event", "recovery_code_used",
+		"codes_left", left,
+	).Warnf("login %s used a recovery code, %d left", login, left)
+	return nil
+}
+
+// isTOTPCode tells TOTP codes, which are digits only, from recovery codes.
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// loginPattern allows logins usable as the local part of a mail address.
+var loginPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,62}[a-z0-9]$`)
+
+type passwordPolicy struct {
+	minLength int
+	maxLength int
+}
+
+func passwordPolicyFromConfig(cfg *config.Config) passwordPolicy {
+	return passwordPolicy{
+		minLength: cfg.Auth.PasswordPolicy.MinLength,
+		maxLength: cfg.Auth.PasswordPolicy.MaxLength,
+	}
+}
+
+// check returns why password is not acceptable for login, if it is not.
+func (p passwordPolicy) check(login, password string) error {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length < p.minLength:
+		return fmt.Errorf("%w: at least %d characters required", domainerrors.ErrWeakPassword, p.minLength)
+	case p.maxLength > 0 && length > p.maxLength:
+		return fmt.Errorf("%w: at most %d characters allowed", domainerrors.ErrWeakPassword, p.maxLength)
+	case strings.Contains(strings.ToLower(password), login):
+		return fmt.Errorf("%w: must not contain the login", domainerrors.ErrWeakPassword)
+	}
+	return nil
+}
+
+func validateLogin(login string) error {
+	if !loginPattern.MatchString(login) || strings.Contains(login, "..") {
+		return fmt.Errorf("%w: 3 to 64 lowercase letters, digits, '.', '_' or '-' expected", domainerrors.ErrInvalidLogin)
+	}
+	return nil
+}
+
+// Register creates an account with the user role. Errors wrap
+// ErrInvalidLogin, ErrWeakPassword, ErrAlreadyExists or, for storages that
+// cannot create users, ErrReadOnly.
+func (s *Service) Register(ctx context.Context, login, password string) (*models.User, error) {
+	return s.createUser(ctx, login, password, models.RoleUser, "")
+}
+
+// createUser creates login with the address login@<domain>, unless domain is
+// empty, and checks password against the policy of that domain.
+func (s *Service) createUser(ctx context.Context, login, password, role, domain string) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if err := validateLogin(login); err != nil {
+		logger.Errorf("register login %q rejected: %s", login, err.Error())
+		return nil, err
+	}
+	if err := s.domains.passwordPolicy(domain, s.policy).check(login, password); err != nil {
+		logger.Errorf("register login %s rejected: %s", login, err.Error())
+		return nil, err
+	}
+	user := &models.User{Login: login, Role: role}
+	if domain != "" {
+		address := login + "@" + domain
+		if err := s.setAddresses(ctx, user, &address, nil); err != nil {
+			logger.Errorf("register login %s rejected: %s", login, err.Error())
+			return nil, err
+		}
+	}
+	if err := s.setPassword(user, password); err != nil {
+		logger.Errorf("hash password for login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("hash password for login %s failed", login)
+	}
+	if err := s.db.Create(ctx, user); err != nil {
+		logger.Errorf("create user %s failed: %s", login, err.Error())
+		if errors.Is(err, domainerrors.ErrAlreadyExists) || errors.Is(err, domainerrors.ErrReadOnly) {
+			return nil, fmt.Errorf("create user %s failed: %w", login, err)
+		}
+		return nil, fmt.Errorf("create user %s failed", login)
+	}
+	logger.Infof("user %s created with role %s", login, role)
+	return user, nil
+}
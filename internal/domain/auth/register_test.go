@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+func TestRegister(t *testing.T) {
+	cases := []struct {
+		name     string
+		login    string
+		password string
+		err      error
+	}{
+		{name: "ok", login: "alice.smith", password: "correct horse"},
+		{name: "existing login", login: "test123", password: "correct horse", err: domainerrors.ErrAlreadyExists},
+		{name: "short login", login: "al", password: "correct horse", err: domainerrors.ErrInvalidLogin},
+		{name: "uppercase login", login: "Alice", password: "correct horse", err: domainerrors.ErrInvalidLogin},
+		{name: "dots", login: "alice..smith", password: "correct horse", err: domainerrors.ErrInvalidLogin},
+		{name: "short password", login: "alice", password: "qwerty", err: domainerrors.ErrWeakPassword},
+		{name: "password with login", login: "alice", password: "ALICE-2024!", err: domainerrors.ErrWeakPassword},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(t)
+			ctx := context.Background()
+
+			_, err := s.Register(ctx, c.login, c.password)
+			if !errors.Is(err, c.err) || (err == nil) != (c.err == nil) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+			if c.err != nil {
+				return
+			}
+			if _, err := s.Login(ctx, c.login, c.password); err != nil {
+				t.Fatalf("Expected registered user to log in, but was %v", err)
+			}
+		})
+	}
+}
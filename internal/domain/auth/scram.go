@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/sasl"
+)
+
+// scramPolicy sets how SCRAM keys are derived from passwords.
+type scramPolicy struct {
+	iterations int
+	// decoyKey derives salts for logins without SCRAM keys, so that the salt
+	// a client is sent does not tell whether the login exists. It comes from
+	// the auth secret to stay the same across restarts and replicas.
+	decoyKey []byte
+}
+
+func scramPolicyFromConfig(cfg *config.Config) scramPolicy {
+	iterations := cfg.Auth.SCRAM.Iterations
+	if iterations < sasl.MinSCRAMIterations {
+		iterations = sasl.MinSCRAMIterations
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.Auth.Secret))
+	mac.Write([]byte("SCRAM decoy salt"))
+	return scramPolicy{iterations: iterations, decoyKey: mac.Sum(nil)}
+}
+
+// setPassword stores the hash of password and the SCRAM keys derived from it
+// in user.
+func (s *Service) setPassword(user *models.User, password string) error {
+	hash, err := s.passwords.hash(password)
+	if err != nil {
+		return err
+	}
+	keys, err := sasl.NewSCRAMCredentials(password, s.scram.iterations)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash, user.SCRAMSHA256 = hash, keys
+	return nil
+}
+
+// needsPasswordUpgrade reports whether a verified password should be stored
+// again, with the current hashing policy or to add SCRAM keys or derive them
+// with the current iteration count.
+func (s *Service) needsPasswordUpgrade(user *models.User) bool {
+	if s.passwords.needsRehash(user.PasswordHash) {
+		return true
+	}
+	credentials, err := sasl.ParseSCRAMCredentials(user.SCRAMSHA256)
+	return err != nil || credentials.Iterations != s.scram.iterations
+}
+
+// SCRAMCredentials returns the salt and iteration count a SCRAM exchange
+// for login starts with. Unknown logins get a stable decoy salt; the
+// exchange then fails in AuthenticateSCRAM like a wrong password.
+func (s *Service) SCRAMCredentials(ctx context.Context, login string) (*models.SCRAMCredentials, error) {
+	login = s.ResolveLogin(ctx, login)
+	user, err := s.db.Get(ctx, login)
+	if err == nil {
+		if credentials, err := sasl.ParseSCRAMCredentials(user.SCRAMSHA256); err == nil {
+			return credentials, nil
+		}
+	}
+	mac := hmac.New(sha256.New, s.scram.decoyKey)
+	mac.Write([]byte(login))
+	return &models.SCRAMCredentials{Salt: mac.Sum(nil)[:16], Iterations: s.scram.iterations}, nil
+}
+
+// AuthenticateSCRAM finishes a SCRAM exchange of login: verify checks the
+// client proof against the stored keys. Like the account password in
+// AuthenticatePlain, SCRAM is refused while 2FA is on, and failures count
+// towards the lockout.
+func (s *Service) AuthenticateSCRAM(ctx context.Context, login, protocol string, verify func(models.SCRAMCredentials) bool) (*models.User, error) {
+	logger := s.annotatedLogger(ctx)
+
+	login = s.ResolveLogin(ctx, login)
+	if err := s.checkLockout(ctx, login); err != nil {
+		logger.Errorf("%s authentication of login %s rejected: %s", protocol, login, err.Error())
+		return nil, fmt.Errorf("%s authentication of login %s rejected: %w", protocol, login, err)
+	}
+	user, err := s.db.Get(ctx, login)
+	if err != nil {
+		s.recordLoginFailure(ctx, login)
+		logger.Errorf("get user info for login %s failed", login)
+		return nil, fmt.Errorf("get user info for login %s failed", login)
+	}
+	enabled, err := s.mfaEnabled(ctx, login)
+	if err != nil {
+		logger.Errorf("get mfa of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("get mfa of login %s failed", login)
+	}
+	credentials, err := sasl.ParseSCRAMCredentials(user.SCRAMSHA256)
+	if err != nil || enabled || !verify(*credentials) {
+		s.recordLoginFailure(ctx, login)
+		logger.Errorf("invalid %s SCRAM proof for login %s", protocol, login)
+		return nil, fmt.Errorf("invalid %s password for login %s", protocol, login)
+	}
+	s.resetLoginFailures(ctx, login)
+	if user.Disabled {
+		logger.Errorf("login %s is disabled", login)
+		return nil, fmt.Errorf("%s authentication of login %s rejected: %w", protocol, login, domainerrors.ErrUserDisabled)
+	}
+	return user, nil
+}
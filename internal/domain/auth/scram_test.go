@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/sasl"
+)
+
+// scramLogin runs a SCRAM-SHA-256 exchange as a client would.
+func scramLogin(t *testing.T, s *Service, login, password string) (*models.User, error) {
+	t.Helper()
+	mech, err := sasl.New("SCRAM-SHA-256", s, models.ProtocolIMAP)
+	if err != nil {
+		t.Fatalf("new mechanism failed: %s", err)
+	}
+	clientFirstBare := "n=" + login + ",r=clientnonce"
+	serverFirst, _, err := mech.Next(context.Background(), []byte("n,,"+clientFirstBare))
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(string(serverFirst), ",") {
+		attrs[attr[:1]] = attr[2:]
+	}
+	salt, _ := base64.StdEncoding.DecodeString(attrs["s"])
+	iterations, _ := strconv.Atoi(attrs["i"])
+
+	mac := func(key []byte, msg string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(msg))
+		return h.Sum(nil)
+	}
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := mac(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + attrs["r"]
+	signature := mac(storedKey[:], clientFirstBare+","+string(serverFirst)+","+withoutProof)
+	for i := range clientKey {
+		clientKey[i] ^= signature[i]
+	}
+	serverFinal, user, err := mech.Next(context.Background(), []byte(withoutProof+",p="+base64.StdEncoding.EncodeToString(clientKey)))
+	if err != nil {
+		return nil, err
+	}
+	serverSignature := mac(mac(salted, "Server Key"), clientFirstBare+","+string(serverFirst)+","+withoutProof)
+	if string(serverFinal) != "v="+base64.StdEncoding.EncodeToString(serverSignature) {
+		t.Fatalf("Expected the server signature, but was %q", serverFinal)
+	}
+	return user, nil
+}
+
+func TestAuthenticateSCRAM(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	// The seeded user has no SCRAM keys until a password login adds them.
+	if _, err := scramLogin(t, s, "test123", "qwerty"); err == nil {
+		t.Fatalf("Expected an error without SCRAM keys, but was nil")
+	}
+	if _, err := s.AuthenticatePlain(ctx, "test123", "qwerty", models.ProtocolIMAP); err != nil {
+		t.Fatalf("plain login failed: %s", err)
+	}
+	user, err := scramLogin(t, s, "test123", "qwerty")
+	if err != nil || user.Login != "test123" {
+		t.Fatalf("Expected test123, but was %v, %v", user, err)
+	}
+	if _, err := scramLogin(t, s, "test123", "qwertz"); err == nil {
+		t.Fatalf("Expected an error for a wrong password, but was nil")
+	}
+
+	// Unknown logins get a stable salt, like existing ones.
+	first, _ := s.SCRAMCredentials(ctx, "nobody")
+	second, _ := s.SCRAMCredentials(ctx, "nobody")
+	if string(first.Salt) != string(second.Salt) || first.Iterations != s.scram.iterations {
+		t.Fatalf("Expected a stable decoy salt, but was %x and %x", first.Salt, second.Salt)
+	}
+	if _, err := scramLogin(t, s, "nobody", "qwerty"); err == nil {
+		t.Fatalf("Expected an error for an unknown login, but was nil")
+	}
+}
+
+func TestSCRAMIterationsUpgrade(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := s.AuthenticatePlain(ctx, "test123", "qwerty", models.ProtocolIMAP); err != nil {
+		t.Fatalf("plain login failed: %s", err)
+	}
+
+	// The next password login rederives the keys with a new iteration count.
+	s.scram.iterations = 2 * sasl.MinSCRAMIterations
+	if _, err := s.AuthenticatePlain(ctx, "test123", "qwerty", models.ProtocolIMAP); err != nil {
+		t.Fatalf("plain login failed: %s", err)
+	}
+	credentials, err := s.SCRAMCredentials(ctx, "test123")
+	if err != nil || credentials.Iterations != s.scram.iterations {
+		t.Fatalf("Expected %d iterations, but was %v, %v", s.scram.iterations, credentials, err)
+	}
+	user, err := scramLogin(t, s, "test123", "qwerty")
+	if err != nil || user.Login != "test123" {
+		t.Fatalf("Expected test123, but was %v, %v", user, err)
+	}
+}
+
+func TestSCRAMDecoySalt(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{}
+
+	// Replicas and restarts with the same secret send the same salt.
+	salts := map[string]bool{}
+	for _, secret := range []string{"secret", "secret", "other secret"} {
+		cfg.Auth.Secret = secret
+		s := newTestService(t)
+		s.scram = scramPolicyFromConfig(cfg)
+		credentials, err := s.SCRAMCredentials(ctx, "nobody")
+		if err != nil {
+			t.Fatalf("get credentials failed: %s", err)
+		}
+		salts[string(credentials.Salt)] = true
+	}
+	if len(salts) != 2 {
+		t.Fatalf("Expected 2 salts for 2 secrets, but was %d", len(salts))
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+func (s *Service) newSession(ctx context.Context, login string) *models.Session {
+	now := time.Now()
+	session := &models.Session{
+		ID:        uuid.NewString(),
+		Login:     login,
+		CreatedAt: now,
+	}
+	s.touchSession(ctx, session)
+	return session
+}
+
+// touchSession records the device the current request comes from.
+func (s *Service) touchSession(ctx context.Context, session *models.Session) {
+	session.LastSeenAt = time.Now()
+	if userAgent, _ := ctx.Value(utils.CtxKeyUserAgentGet()).(string); userAgent != "" {
+		session.UserAgent = userAgent
+	}
+	if ip, _ := ctx.Value(utils.CtxKeyRemoteIPGet()).(string); ip != "" {
+		session.IP = ip
+	}
+}
+
+func (s *Service) Sessions(ctx context.Context, login string) ([]models.Session, error) {
+	logger := s.annotatedLogger(ctx)
+
+	sessions, err := s.sessions.ListSessions(ctx, login)
+	if err != nil {
+		logger.Errorf("list sessions for login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("list sessions for login %s failed", login)
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs the device out: the session's tokens stop working
+// immediately.
+func (s *Service) RevokeSession(ctx context.Context, login, id string) error {
+	logger := s.annotatedLogger(ctx)
+
+	session, err := s.sessions.GetSession(ctx, id)
+	if err == nil && session.Login != login {
+		err = domainerrors.ErrNotFound
+	}
+	if err != nil {
+		logger.Errorf("session %s of login %s lookup failed: %s", id, login, err.Error())
+		return fmt.Errorf("session %s lookup failed: %w", id, err)
+	}
+	if err := s.endSession(ctx, session); err != nil {
+		logger.Errorf("end session %s failed: %s", id, err.Error())
+		return fmt.Errorf("end session %s failed", id)
+	}
+	return nil
+}
+
+// RevokeSessions signs login out everywhere and returns the number of ended
+// sessions.
+func (s *Service) RevokeSessions(ctx context.Context, login string) (int, error) {
+	logger := s.annotatedLogger(ctx)
+
+	sessions, err := s.sessions.ListSessions(ctx, login)
+	if err != nil {
+		logger.Errorf("list sessions for login %s failed: %s", login, err.Error())
+		return 0, fmt.Errorf("list sessions for login %s failed", login)
+	}
+	for i := range sessions {
+		if err := s.endSession(ctx, &sessions[i]); err != nil {
+			logger.Errorf("end session %s failed: %s", sessions[i].ID, err.Error())
+			return i, fmt.Errorf("end session %s failed", sessions[i].ID)
+		}
+	}
+	return len(sessions), nil
+}
+
+func (s *Service) endSessionByID(ctx context.Context, id string) error {
+	if id == "" {
+		return nil
+	}
+	session, err := s.sessions.GetSession(ctx, id)
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		return s.tokens.RevokeTokenFamily(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.endSession(ctx, session)
+}
+
+// endSession revokes the refresh token family and the latest tokens of the
+// session, then forgets it. Earlier access tokens of the session have
+// already expired, since they are only replaced after expiry.
+func (s *Service) endSession(ctx context.Context, session *models.Session) error {
+	if err := s.tokens.RevokeTokenFamily(ctx, session.ID); err != nil {
+		return err
+	}
+	if err := s.revoked.Revoke(ctx, session.AccessTokenID, time.Now().Add(s.domains.longestAccessTokenTTL())); err != nil {
+		return err
+	}
+	if err := s.revoked.Revoke(ctx, session.RefreshTokenID, session.ExpiresAt); err != nil {
+		return err
+	}
+	err := s.sessions.DeleteSession(ctx, session.ID)
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		return nil
+	}
+	return err
+}
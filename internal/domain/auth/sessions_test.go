@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+)
+
+func TestSessions(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.WithValue(context.Background(), utils.CtxKeyUserAgentGet(), "Thunderbird")
+	ctx = context.WithValue(ctx, utils.CtxKeyRemoteIPGet(), "192.0.2.1")
+
+	laptop, err := s.Login(ctx, "test123", "qwerty")
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	phone, _ := s.Login(context.Background(), "test123", "qwerty")
+
+	sessions, err := s.Sessions(ctx, "test123")
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, but was %d (%v)", len(sessions), err)
+	}
+	laptopClaims, _ := s.parseToken(ctx, laptop.AuthToken)
+	var found bool
+	for _, session := range sessions {
+		if session.ID == laptopClaims.Session {
+			found = session.UserAgent == "Thunderbird" && session.IP == "192.0.2.1"
+		}
+	}
+	if !found {
+		t.Fatalf("Expected laptop session with client details in %+v", sessions)
+	}
+
+	if err := s.RevokeSession(ctx, "other", laptopClaims.Session); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected foreign session to be not found, but was %v", err)
+	}
+	if err := s.RevokeSession(ctx, "test123", laptopClaims.Session); err != nil {
+		t.Fatalf("revoke session failed: %s", err)
+	}
+	if _, err := s.Validate(ctx, laptop.AuthToken); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected revoked session tokens to be rejected, but was %v", err)
+	}
+	if _, err := s.Validate(ctx, phone.AuthToken); err != nil {
+		t.Fatalf("Expected other session to stay valid, but was %v", err)
+	}
+
+	revoked, err := s.RevokeSessions(ctx, "test123")
+	if err != nil || revoked != 1 {
+		t.Fatalf("Expected 1 revoked session, but was %d (%v)", revoked, err)
+	}
+	if _, _, err := s.ValidateAndRefresh(ctx, &phone); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenRevoked, err)
+	}
+	if sessions, _ := s.Sessions(ctx, "test123"); len(sessions) != 0 {
+		t.Fatalf("Expected no sessions left, but was %d", len(sessions))
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+)
+
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpPolicy checks RFC 6238 codes: HMAC-SHA1, six digits, 30 second steps,
+// accepting skew steps of clock drift either way.
+type totpPolicy struct {
+	issuer string
+	skew   int
+}
+
+func totpPolicyFromConfig(cfg *config.Config) totpPolicy {
+	return totpPolicy{issuer: cfg.Auth.MFA.Issuer, skew: cfg.Auth.MFA.Skew}
+}
+
+func generateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// uri is the otpauth:// URI authenticator apps import, usually from a QR code.
+func (p totpPolicy) uri(login, secret string) string {
+	label := url.PathEscape(p.issuer + ":" + login)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {p.issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod.Seconds()))},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// match returns the time step code belongs to if it is valid at now.
+func (p totpPolicy) match(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - int64(p.skew); step <= current+int64(p.skew); step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// hotp is the RFC 4226 one-time password of counter.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
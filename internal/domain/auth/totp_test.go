@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPMatch(t *testing.T) {
+	// RFC 6238 appendix B SHA-1 vectors, truncated to six digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	p := totpPolicy{issuer: "test", skew: 1}
+	cases := []struct {
+		unix int64
+		code string
+		ok   bool
+	}{
+		{unix: 59, code: "287082", ok: true},
+		{unix: 1111111109, code: "081804", ok: true},
+		{unix: 1234567890, code: "005924", ok: true},
+		{unix: 2000000000, code: "279037", ok: true},
+		{unix: 1111111109 + 30, code: "081804", ok: true},
+		{unix: 1111111109 + 90, code: "081804"},
+		{unix: 59, code: "287083"},
+		{unix: 59, code: "28708"},
+	}
+	for _, c := range cases {
+		if _, ok := p.match(secret, c.code, time.Unix(c.unix, 0)); ok != c.ok {
+			t.Fatalf("Expected %s at %d valid %t, but was %t", c.code, c.unix, c.ok, ok)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+const (
+	purposeWebAuthnRegistration = "webauthn.create"
+	purposeWebAuthnLogin        = "webauthn.get"
+)
+
+// relyingParty is the WebAuthn relying party the mail web UI acts as.
+// Passkeys replace the password and the second factor, so user verification
+// is always required.
+type relyingParty struct {
+	id          string
+	name        string
+	origins     []string
+	attestation string
+	timeout     time.Duration
+}
+
+func relyingPartyFromConfig(cfg *config.Config) relyingParty {
+	c := cfg.Auth.WebAuthn
+	return relyingParty{
+		id:          c.RPID,
+		name:        c.RPName,
+		origins:     c.Origins,
+		attestation: c.Attestation,
+		timeout:     c.Timeout,
+	}
+}
+
+func (rp relyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// webauthnUserHandle is the user.id of the credentials of login; the spec
+// asks not to expose the account name there.
+func webauthnUserHandle(login string) []byte {
+	sum := sha256.Sum256([]byte("webauthn:" + login))
+	return sum[:]
+}
+
+// newWebAuthnChallenge issues a challenge token for purpose. The random jti
+// of the token doubles as the challenge and is revoked once used.
+func (s *Service) newWebAuthnChallenge(ctx context.Context, login, purpose string) (string, string, error) {
+	claims := &tokenClaims{Login: login, Purpose: purpose}
+	token, err := s.generateToken(ctx, claims, s.rp.timeout)
+	if err != nil {
+		return "", "", err
+	}
+	return token, b64url([]byte(claims.Id)), nil
+}
+
+// useWebAuthnChallenge checks the challenge token against the client data
+// and uses it up.
+func (s *Service) useWebAuthnChallenge(ctx context.Context, challengeToken, purpose string, data *clientData) (*tokenClaims, error) {
+	claims, err := s.parsePurposeToken(ctx, challengeToken, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if s.tokenExpired(claims) {
+		return nil, fmt.Errorf("challenge expired")
+	}
+	if err := s.checkNotRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	if data.Challenge != b64url([]byte(claims.Id)) {
+		return nil, fmt.Errorf("client data challenge does not match")
+	}
+	if !s.rp.allowedOrigin(data.Origin) {
+		return nil, fmt.Errorf("origin %q is not allowed", data.Origin)
+	}
+	if err := s.revokeToken(ctx, claims); err != nil {
+		return nil, fmt.Errorf("use up challenge failed: %s", err)
+	}
+	return claims, nil
+}
+
+// checkAuthenticatorData checks the relying party and that the user was
+// present and verified.
+func (s *Service) checkAuthenticatorData(data *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(s.rp.id))
+	if !bytes.Equal(data.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("credential is for another relying party")
+	}
+	if data.flags&flagUserPresent == 0 || data.flags&flagUserVerified == 0 {
+		return fmt.Errorf("user was not present and verified")
+	}
+	return nil
+}
+
+// BeginWebAuthnRegistration starts adding a passkey to login.
+func (s *Service) BeginWebAuthnRegistration(ctx context.Context, login string) (*models.WebAuthnRegistration, error) {
+	logger := s.annotatedLogger(ctx)
+
+	if err := s.allowMFA(ctx, login, models.MFAMethodWebAuthn); err != nil {
+		return nil, err
+	}
+	credentials, err := s.webauthn.ListWebAuthnCredentials(ctx, login)
+	if err != nil {
+		logger.Errorf("list webauthn credentials of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("list webauthn credentials of login %s failed", login)
+	}
+	token, challenge, err := s.newWebAuthnChallenge(ctx, login, purposeWebAuthnRegistration)
+	if err != nil {
+		logger.Errorf("generate webauthn challenge for login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("generate webauthn challenge for login %s failed", login)
+	}
+
+	options := models.WebAuthnCreationOptions{
+		Challenge:   challenge,
+		Timeout:     s.rp.timeout.Milliseconds(),
+		Attestation: s.rp.attestation,
+		PubKeyCredParams: []models.WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: coseES256},
+			{Type: "public-key", Alg: coseEdDSA},
+			{Type: "public-key", Alg: coseRS256},
+		},
+		ExcludeCredentials: credentialDescriptors(credentials),
+	}
+	options.RP.ID = s.rp.id
+	options.RP.Name = s.rp.name
+	options.User.ID = b64url(webauthnUserHandle(login))
+	options.User.Name = login
+	options.User.DisplayName = login
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "required"
+	return &models.WebAuthnRegistration{ChallengeToken: token, Options: options}, nil
+}
+
+// FinishWebAuthnRegistration verifies the attestation of a new credential and
+// stores it under name.
+func (s *Service) FinishWebAuthnRegistration(ctx context.Context, login, challengeToken, name string, attestation models.WebAuthnAttestation) (*models.WebAuthnCredential, error) {
+	logger := s.annotatedLogger(ctx)
+
+	credential, err := s.verifyRegistration(ctx, login, challengeToken, attestation)
+	if err != nil {
+		logger.Errorf("webauthn registration for login %s rejected: %s", login, err.Error())
+		return nil, fmt.Errorf("webauthn registration rejected: %w", domainerrors.ErrInvalidCode)
+	}
+	credential.Name = name
+	if err := s.webauthn.CreateWebAuthnCredential(ctx, credential); err != nil {
+		logger.Errorf("store webauthn credential of login %s failed: %s", login, err.Error())
+		return nil, storageError(fmt.Sprintf("store webauthn credential of login %s failed", login), err)
+	}
+	logger.With("security_event", "webauthn_registered").Infof("webauthn credential %q of login %s registered", name, login)
+	return credential, nil
+}
+
+func (s *Service) verifyRegistration(ctx context.Context, login, challengeToken string, attestation models.WebAuthnAttestation) (*models.WebAuthnCredential, error) {
+	data, err := parseClientData(attestation.ClientDataJSON, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.useWebAuthnChallenge(ctx, challengeToken, purposeWebAuthnRegistration, data)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Login != login {
+		return nil, fmt.Errorf("challenge was issued to another login")
+	}
+
+	var obj attestationObject
+	if err := cbor.Unmarshal(attestation.AttestationObject, &obj); err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %s", err)
+	}
+	authData, err := parseAuthenticatorData(obj.AuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 {
+		return nil, fmt.Errorf("attested credential data missing")
+	}
+	if _, _, err := parseCOSEKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(attestation.ClientDataJSON)
+	if err := verifyAttestation(&obj, authData, clientDataHash[:]); err != nil {
+		return nil, err
+	}
+	return &models.WebAuthnCredential{
+		ID:        authData.credentialID,
+		Login:     login,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+		AAGUID:    authData.aaguid,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// BeginWebAuthnLogin starts a passkey login. Without a login any discoverable
+// credential of the relying party may answer.
+func (s *Service) BeginWebAuthnLogin(ctx context.Context, login string) (*models.WebAuthnLogin, error) {
+	logger := s.annotatedLogger(ctx)
+
+	var credentials []models.WebAuthnCredential
+	if login != "" {
+		login = s.ResolveLogin(ctx, login)
+		var err error
+		credentials, err = s.webauthn.ListWebAuthnCredentials(ctx, login)
+		if err != nil {
+			logger.Errorf("list webauthn credentials of login %s failed: %s", login, err.Error())
+			return nil, fmt.Errorf("list webauthn credentials of login %s failed", login)
+		}
+	}
+	token, challenge, err := s.newWebAuthnChallenge(ctx, login, purposeWebAuthnLogin)
+	if err != nil {
+		logger.Errorf("generate webauthn challenge failed: %s", err.Error())
+		return nil, fmt.Errorf("generate webauthn challenge failed")
+	}
+	return &models.WebAuthnLogin{
+		ChallengeToken: token,
+		Options: models.WebAuthnRequestOptions{
+			Challenge:        challenge,
+			Timeout:          s.rp.timeout.Milliseconds(),
+			RPID:             s.rp.id,
+			AllowCredentials: credentialDescriptors(credentials),
+			UserVerification: "required",
+		},
+	}, nil
+}
+
+// FinishWebAuthnLogin verifies an assertion and starts a session. A sign
+// count that does not grow points to a cloned authenticator and is refused.
+func (s *Service) FinishWebAuthnLogin(ctx context.Context, challengeToken string, assertion models.WebAuthnAssertion) (models.TokenPair, error) {
+	logger := s.annotatedLogger(ctx)
+
+	credential, err := s.verifyAssertion(ctx, challengeToken, assertion)
+	if err != nil {
+		logger.Errorf("webauthn login rejected: %s", err.Error())
+		return models.TokenPair{}, fmt.Errorf("webauthn login rejected: %w", domainerrors.ErrInvalidCode)
+	}
+	user, err := s.getUser(ctx, &tokenClaims{Login: credential.Login})
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return s.issueTokens(ctx, user)
+}
+
+func (s *Service) verifyAssertion(ctx context.Context, challengeToken string, assertion models.WebAuthnAssertion) (*models.WebAuthnCredential, error) {
+	logger := s.annotatedLogger(ctx)
+
+	data, err := parseClientData(assertion.ClientDataJSON, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.useWebAuthnChallenge(ctx, challengeToken, purposeWebAuthnLogin, data)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webauthn.GetWebAuthnCredential(ctx, assertion.CredentialID)
+	if err != nil {
+		return nil, fmt.Errorf("credential lookup failed: %w", err)
+	}
+	if claims.Login != "" && claims.Login != credential.Login {
+		return nil, fmt.Errorf("challenge was issued to another login")
+	}
+	if len(assertion.UserHandle) != 0 && !bytes.Equal(assertion.UserHandle, webauthnUserHandle(credential.Login)) {
+		return nil, fmt.Errorf("user handle does not match the credential")
+	}
+
+	authData, err := parseAuthenticatorData(assertion.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	alg, pub, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(assertion.ClientDataJSON)
+	signed := append(append([]byte{}, assertion.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(alg, pub, signed, assertion.Signature); err != nil {
+		return nil, err
+	}
+
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		logger.With(
+			"security_event", "webauthn_clone_suspected",
+			"login", credential.Login,
+		).Warnf("sign count %d of credential %q did not grow from %d", authData.signCount, credential.Name, credential.SignCount)
+		return nil, fmt.Errorf("sign count did not grow")
+	}
+	err = s.webauthn.UseWebAuthnCredential(ctx, credential.ID, credential.SignCount, authData.signCount, time.Now())
+	if errors.Is(err, domainerrors.ErrNotFound) {
+		return nil, fmt.Errorf("credential was used concurrently")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (s *Service) WebAuthnCredentials(ctx context.Context, login string) ([]models.WebAuthnCredential, error) {
+	logger := s.annotatedLogger(ctx)
+
+	credentials, err := s.webauthn.ListWebAuthnCredentials(ctx, login)
+	if err != nil {
+		logger.Errorf("list webauthn credentials of login %s failed: %s", login, err.Error())
+		return nil, fmt.Errorf("list webauthn credentials of login %s failed", login)
+	}
+	return credentials, nil
+}
+
+func (s *Service) DeleteWebAuthnCredential(ctx context.Context, login string, id []byte) error {
+	logger := s.annotatedLogger(ctx)
+
+	if err := s.webauthn.DeleteWebAuthnCredential(ctx, login, id); err != nil {
+		logger.Errorf("delete webauthn credential of login %s failed: %s", login, err.Error())
+		return storageError(fmt.Sprintf("delete webauthn credential of login %s failed", login), err)
+	}
+	logger.With("security_event", "webauthn_deleted").Infof("webauthn credential of login %s deleted", login)
+	return nil
+}
+
+// deleteWebAuthnCredentials removes every credential of a deleted user so
+// that a new account with the same login cannot inherit them.
+func (s *Service) deleteWebAuthnCredentials(ctx context.Context, login string) {
+	logger := s.annotatedLogger(ctx)
+
+	credentials, err := s.webauthn.ListWebAuthnCredentials(ctx, login)
+	if err != nil {
+		logger.Errorf("list webauthn credentials of user %s failed: %s", login, err.Error())
+		return
+	}
+	for _, credential := range credentials {
+		if err := s.webauthn.DeleteWebAuthnCredential(ctx, login, credential.ID); err != nil {
+			logger.Errorf("delete webauthn credential of user %s failed: %s", login, err.Error())
+		}
+	}
+}
+
+func credentialDescriptors(credentials []models.WebAuthnCredential) []models.WebAuthnCredentialDescriptor {
+	descriptors := make([]models.WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptors = append(descriptors, models.WebAuthnCredentialDescriptor{
+			Type: "public-key",
+			ID:   b64url(credential.ID),
+		})
+	}
+	return descriptors
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+// softAuthenticator is a P-256 authenticator that signs whatever it is given.
+type softAuthenticator struct {
+	t         *testing.T
+	rpID      string
+	origin    string
+	id        []byte
+	key       *ecdsa.PrivateKey
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key failed: %s", err)
+	}
+	return &softAuthenticator{t: t, rpID: "mail.example.com", origin: "https://mail.example.com", id: []byte("credential-1"), key: key}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	raw, _ := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	return raw
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := byte(flagUserPresent | flagUserVerified)
+	if attested {
+		flags |= flagAttested
+	}
+	data = append(data, flags)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], a.signCount)
+	if !attested {
+		return data
+	}
+	data = append(data, make([]byte, 16)...)
+	data = append(data, 0, 0)
+	binary.BigEndian.PutUint16(data[len(data)-2:], uint16(len(a.id)))
+	data = append(data, a.id...)
+	key, err := cbor.Marshal(map[int]interface{}{
+		1:  2,
+		3:  coseES256,
+		-1: 1,
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("encode COSE key failed: %s", err)
+	}
+	return append(data, key...)
+}
+
+func (a *softAuthenticator) sign(authData, clientDataJSON []byte) []byte {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("sign failed: %s", err)
+	}
+	return sig
+}
+
+func (a *softAuthenticator) create(options models.WebAuthnCreationOptions, format string) models.WebAuthnAttestation {
+	clientDataJSON := a.clientData("webauthn.create", options.Challenge)
+	authData := a.authData(true)
+	stmt := map[string]interface{}{}
+	if format == "packed" {
+		stmt = map[string]interface{}{"alg": coseES256, "sig": a.sign(authData, clientDataJSON)}
+	}
+	obj, err := cbor.Marshal(map[string]interface{}{"fmt": format, "attStmt": stmt, "authData": authData})
+	if err != nil {
+		a.t.Fatalf("encode attestation object failed: %s", err)
+	}
+	return models.WebAuthnAttestation{ClientDataJSON: clientDataJSON, AttestationObject: obj}
+}
+
+func (a *softAuthenticator) get(options models.WebAuthnRequestOptions) models.WebAuthnAssertion {
+	a.signCount++
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+	authData := a.authData(false)
+	return models.WebAuthnAssertion{
+		CredentialID:      a.id,
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         a.sign(authData, clientDataJSON),
+	}
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		origin string
+		rpID   string
+		err    error
+	}{
+		{"none attestation", "none", "https://mail.example.com", "mail.example.com", nil},
+		{"packed self attestation", "packed", "https://mail.example.com", "mail.example.com", nil},
+		{"wrong origin", "none", "https://evil.example.com", "mail.example.com", domainerrors.ErrInvalidCode},
+		{"wrong relying party", "none", "https://mail.example.com", "evil.example.com", domainerrors.ErrInvalidCode},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestService(t)
+			ctx := context.Background()
+			authenticator := newSoftAuthenticator(t)
+			authenticator.origin, authenticator.rpID = c.origin, c.rpID
+
+			registration, err := s.BeginWebAuthnRegistration(ctx, "test123")
+			if err != nil {
+				t.Fatalf("begin registration failed: %s", err)
+			}
+			attestation := authenticator.create(registration.Options, c.format)
+			_, err = s.FinishWebAuthnRegistration(ctx, "test123", registration.ChallengeToken, "laptop", attestation)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestWebAuthnLogin(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	authenticator := newSoftAuthenticator(t)
+
+	registration, _ := s.BeginWebAuthnRegistration(ctx, "test123")
+	attestation := authenticator.create(registration.Options, "none")
+	if _, err := s.FinishWebAuthnRegistration(ctx, "test123", registration.ChallengeToken, "laptop", attestation); err != nil {
+		t.Fatalf("registration failed: %s", err)
+	}
+	// Challenges are single-use.
+	if _, err := s.FinishWebAuthnRegistration(ctx, "test123", registration.ChallengeToken, "laptop", attestation); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+
+	login, err := s.BeginWebAuthnLogin(ctx, "test123")
+	if err != nil || len(login.Options.AllowCredentials) != 1 {
+		t.Fatalf("Expected 1 allowed credential, but was %v, %v", login, err)
+	}
+	assertion := authenticator.get(login.Options)
+	tokens, err := s.FinishWebAuthnLogin(ctx, login.ChallengeToken, assertion)
+	if err != nil {
+		t.Fatalf("login failed: %s", err)
+	}
+	if _, err := s.Validate(ctx, tokens.AuthToken); err != nil {
+		t.Fatalf("Expected valid access token, but was %v", err)
+	}
+	if _, err := s.FinishWebAuthnLogin(ctx, login.ChallengeToken, assertion); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected replayed assertion to be refused, but was %v", err)
+	}
+
+	// A cloned authenticator repeats a sign count already seen.
+	login, _ = s.BeginWebAuthnLogin(ctx, "")
+	authenticator.signCount--
+	if _, err := s.FinishWebAuthnLogin(ctx, login.ChallengeToken, authenticator.get(login.Options)); !errors.Is(err, domainerrors.ErrInvalidCode) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrInvalidCode, err)
+	}
+
+	login, _ = s.BeginWebAuthnLogin(ctx, "")
+	if _, err := s.FinishWebAuthnLogin(ctx, login.ChallengeToken, authenticator.get(login.Options)); err != nil {
+		t.Fatalf("Expected discoverable login, but was %v", err)
+	}
+	credentials, _ := s.WebAuthnCredentials(ctx, "test123")
+	if len(credentials) != 1 || credentials[0].SignCount != 2 || credentials[0].LastUsedAt.IsZero() {
+		t.Fatalf("Expected used credential with sign count 2, but was %+v", credentials)
+	}
+}
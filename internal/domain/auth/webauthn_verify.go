@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// COSE algorithm identifiers accepted for credentials.
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// oidAAGUID is the id-fido-gen-ce-aaguid certificate extension.
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+type attestationObject struct {
+	Fmt      string          `cbor:"fmt"`
+	AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	AuthData []byte          `cbor:"authData"`
+}
+
+type packedStatement struct {
+	Alg int64    `cbor:"alg"`
+	Sig []byte   `cbor:"sig"`
+	X5C [][]byte `cbor:"x5c"`
+}
+
+func parseClientData(raw []byte, typ string) (*clientData, error) {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("invalid client data: %s", err)
+	}
+	if data.Type != typ {
+		return nil, fmt.Errorf("client data type %q, expected %q", data.Type, typ)
+	}
+	return &data, nil
+}
+
+// parseAuthenticatorData splits authenticator data into its fields. The
+// credential members are only set with the attested flag.
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+	data := &authenticatorData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagAttested == 0 {
+		return data, nil
+	}
+	rest := raw[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("attested credential data too short")
+	}
+	data.aaguid = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLength {
+		return nil, fmt.Errorf("credential id too short")
+	}
+	data.credentialID = rest[:idLength]
+	rest = rest[idLength:]
+
+	// The COSE key is followed by extensions, so its length is only known
+	// after decoding it.
+	var key cbor.RawMessage
+	dec := cbor.NewDecoder(bytes.NewReader(rest))
+	if err := dec.Decode(&key); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %s", err)
+	}
+	data.publicKey = rest[:dec.NumBytesRead()]
+	return data, nil
+}
+
+// parseCOSEKey returns the algorithm and public key of a COSE_Key.
+func parseCOSEKey(raw []byte) (int64, crypto.PublicKey, error) {
+	var key map[int64]interface{}
+	if err := cbor.Unmarshal(raw, &key); err != nil {
+		return 0, nil, fmt.Errorf("invalid COSE key: %s", err)
+	}
+	kty, _ := coseInt(key[1])
+	alg, _ := coseInt(key[3])
+	switch {
+	case kty == 2 && alg == coseES256:
+		crv, _ := coseInt(key[-1])
+		x, _ := key[-2].([]byte)
+		y, _ := key[-3].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("invalid P-256 COSE key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, fmt.Errorf("COSE key point is not on P-256")
+		}
+		return alg, pub, nil
+	case kty == 1 && alg == coseEdDSA:
+		crv, _ := coseInt(key[-1])
+		x, _ := key[-2].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, fmt.Errorf("invalid Ed25519 COSE key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case kty == 3 && alg == coseRS256:
+		n, _ := key[-1].([]byte)
+		e, _ := key[-2].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, fmt.Errorf("invalid RSA COSE key")
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return 0, nil, fmt.Errorf("unsupported COSE key type %d with algorithm %d", kty, alg)
+	}
+}
+
+// coseInt reads a CBOR integer, which decodes as uint64 or int64.
+func coseInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		return int64(n), n <= 1<<63-1
+	default:
+		return 0, false
+	}
+}
+
+func verifySignature(alg int64, pub crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	valid := false
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		valid = alg == coseES256 && ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		valid = alg == coseEdDSA && ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		valid = alg == coseRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	if !valid {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// verifyAttestation checks the attestation statement of a new credential.
+// Attestation certificates are checked for form but not chained to a trust
+// anchor: the statement proves that the key lives in an authenticator, not
+// which vendor made it.
+func verifyAttestation(obj *attestationObject, data *authenticatorData, clientDataHash []byte) error {
+	switch obj.Fmt {
+	case "none":
+		var stmt map[string]interface{}
+		if err := cbor.Unmarshal(obj.AttStmt, &stmt); err != nil || len(stmt) != 0 {
+			return fmt.Errorf("attestation none with a statement")
+		}
+		return nil
+	case "packed":
+		var stmt packedStatement
+		if err := cbor.Unmarshal(obj.AttStmt, &stmt); err != nil {
+			return fmt.Errorf("invalid packed attestation statement: %s", err)
+		}
+		signed := append(append([]byte{}, obj.AuthData...), clientDataHash...)
+		if len(stmt.X5C) == 0 {
+			alg, pub, err := parseCOSEKey(data.publicKey)
+			if err != nil {
+				return err
+			}
+			if alg != stmt.Alg {
+				return fmt.Errorf("self attestation algorithm %d differs from credential algorithm %d", stmt.Alg, alg)
+			}
+			return verifySignature(alg, pub, signed, stmt.Sig)
+		}
+		cert, err := x509.ParseCertificate(stmt.X5C[0])
+		if err != nil {
+			return fmt.Errorf("invalid attestation certificate: %s", err)
+		}
+		if err := checkAttestationCertificate(cert, data.aaguid); err != nil {
+			return err
+		}
+		return verifySignature(stmt.Alg, cert.PublicKey, signed, stmt.Sig)
+	default:
+		return fmt.Errorf("unsupported attestation format %q", obj.Fmt)
+	}
+}
+
+// checkAttestationCertificate applies the packed attestation certificate
+// requirements of WebAuthn section 8.2.1.
+func checkAttestationCertificate(cert *x509.Certificate, aaguid []byte) error {
+	if cert.Version != 3 {
+		return fmt.Errorf("attestation certificate version %d, expected 3", cert.Version)
+	}
+	if len(cert.Subject.OrganizationalUnit) != 1 || cert.Subject.OrganizationalUnit[0] != "Authenticator Attestation" {
+		return fmt.Errorf("attestation certificate subject without OU Authenticator Attestation")
+	}
+	if !cert.BasicConstraintsValid || cert.IsCA {
+		return fmt.Errorf("attestation certificate is a CA")
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAAGUID) {
+			continue
+		}
+		var value []byte
+		if _, err := asn1.Unmarshal(ext.Value, &value); err != nil || !bytes.Equal(value, aaguid) {
+			return fmt.Errorf("attestation certificate AAGUID differs from authenticator data")
+		}
+	}
+	return nil
+}
@@ -1,8 +1,71 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
-	ErrNotFound = errors.New("not found")
-	ErrTokenInvalid = errors.New("invalid token")
-)
\ No newline at end of file
+	ErrNotFound       = errors.New("not found")
+	ErrAlreadyExists  = errors.New("already exists")
+	ErrReadOnly       = errors.New("storage is read-only")
+	ErrInvalidLogin   = errors.New("invalid login")
+	ErrWeakPassword   = errors.New("password does not meet the policy")
+	ErrInvalidRole    = errors.New("invalid role")
+	ErrUserDisabled   = errors.New("user disabled")
+	ErrForbidden      = errors.New("forbidden")
+	ErrTooManyLogins  = errors.New("too many failed logins")
+	ErrRateLimited    = errors.New("rate limit exceeded")
+	ErrMFARequired    = errors.New("mfa_required")
+	ErrInvalidCode    = errors.New("invalid verification code")
+	ErrInvalidScope   = errors.New("invalid app password scope")
+	ErrInvalidAddress = errors.New("invalid mail address")
+	ErrUnsupported    = errors.New("unsupported SASL mechanism")
+	ErrMalformed      = errors.New("malformed SASL message")
+	ErrTokenInvalid   = errors.New("invalid token")
+	ErrTokenReused    = errors.New("refresh token reused")
+	ErrTokenRevoked   = errors.New("token revoked")
+)
+
+// RetryAfterError is ErrTooManyLogins together with the time until the next
+// attempt is allowed.
+type RetryAfterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyLogins, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return ErrTooManyLogins
+}
+
+// RateLimitError is ErrRateLimited together with the time until the next
+// request is allowed.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrRateLimited, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// MFARequiredError is ErrMFARequired together with the challenge token that
+// completes the login with a second factor.
+type MFARequiredError struct {
+	ChallengeToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Unwrap() error {
+	return ErrMFARequired
+}
@@ -0,0 +1,59 @@
+// Package mailaddr normalizes mail addresses, so that the spellings a user
+// may type for an address compare equal.
+package mailaddr
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+const maxLength = 254
+
+var fold = cases.Fold()
+
+// Normalize case folds the local part and converts the domain to lower case
+// ASCII, with internationalized domains in punycode:
+// Ünïcode@Bücher.Example becomes ünïcode@xn--bcher-kva.example.
+func Normalize(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return "", fmt.Errorf("%w: %q lacks a local part or domain", domainerrors.ErrInvalidAddress, address)
+	}
+	local, domain := address[:at], address[at+1:]
+	if strings.ContainsAny(local, " \t\r\n<>") {
+		return "", fmt.Errorf("%w: %q", domainerrors.ErrInvalidAddress, address)
+	}
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q: %s", domainerrors.ErrInvalidAddress, address, err)
+	}
+	normalized := fold.String(local) + "@" + domain
+	if len(normalized) > maxLength {
+		return "", fmt.Errorf("%w: %q is longer than %d bytes", domainerrors.ErrInvalidAddress, address, maxLength)
+	}
+	return normalized, nil
+}
+
+// StripPlus removes a subaddress such as +lists from the local part of a
+// normalized address. An empty delimiter keeps the address as it is.
+func StripPlus(address, delimiter string) string {
+	if delimiter == "" {
+		return address
+	}
+	at := strings.LastIndex(address, "@")
+	if i := strings.Index(address[:at+1], delimiter); i > 0 && i < at {
+		return address[:i] + address[at:]
+	}
+	return address
+}
+
+// Domain returns the domain of a normalized address.
+func Domain(address string) string {
+	return address[strings.LastIndex(address, "@")+1:]
+}
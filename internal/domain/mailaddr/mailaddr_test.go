@@ -0,0 +1,61 @@
+package mailaddr
+
+import (
+	"errors"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		address string
+		want    string
+	}{
+		{"Alice@Example.COM", "alice@example.com"},
+		{" alice@example.com ", "alice@example.com"},
+		{"STRASSE@example.com", "strasse@example.com"},
+		{"Ünïcode@Bücher.Example", "ünïcode@xn--bcher-kva.example"},
+		{"alice@xn--bcher-kva.example", "alice@xn--bcher-kva.example"},
+		{"\"a@b\"@example.com", "\"a@b\"@example.com"},
+		{"alice", ""},
+		{"@example.com", ""},
+		{"alice@", ""},
+		{"alice@exa mple.com", ""},
+		{"a lice@example.com", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.address, func(t *testing.T) {
+			got, err := Normalize(c.address)
+			if c.want == "" {
+				if !errors.Is(err, domainerrors.ErrInvalidAddress) {
+					t.Fatalf("Expected %v, but was %q, %v", domainerrors.ErrInvalidAddress, got, err)
+				}
+				return
+			}
+			if err != nil || got != c.want {
+				t.Fatalf("Expected %s, but was %q, %v", c.want, got, err)
+			}
+		})
+	}
+}
+
+func TestStripPlus(t *testing.T) {
+	cases := []struct {
+		address   string
+		delimiter string
+		want      string
+	}{
+		{"alice+lists@example.com", "+", "alice@example.com"},
+		{"alice+a+b@example.com", "+", "alice@example.com"},
+		{"+alice@example.com", "+", "+alice@example.com"},
+		{"alice@ex+ample.com", "+", "alice@ex+ample.com"},
+		{"alice-lists@example.com", "-", "alice@example.com"},
+		{"alice+lists@example.com", "", "alice+lists@example.com"},
+	}
+	for _, c := range cases {
+		if got := StripPlus(c.address, c.delimiter); got != c.want {
+			t.Fatalf("Expected %s for %s, but was %s", c.want, c.address, got)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Protocols an app password can be scoped to.
+const (
+	ProtocolIMAP = "imap"
+	ProtocolSMTP = "smtp"
+	ProtocolPOP3 = "pop3"
+)
+
+// AppPassword is a generated password for a mail client that cannot do
+// token or two-factor logins. It only works for its scopes.
+type AppPassword struct {
+	ID        string
+	Login     string
+	Name      string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+	// LastUsedAt is zero until the first login with the password.
+	LastUsedAt time.Time
+}
+
+// HasScope reports whether the password may be used for protocol.
+func (p *AppPassword) HasScope(protocol string) bool {
+	for _, scope := range p.Scopes {
+		if scope == protocol {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginFailures counts consecutive failed logins for a key, such as a login
+// name or a client address.
+type LoginFailures struct {
+	Key           string
+	Count         int
+	LastFailureAt time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RateLimitSubject identifies who sent a request. Empty fields are unknown.
+type RateLimitSubject struct {
+	IP     string
+	Login  string
+	Client string
+}
+
+// RateLimitBucket is the token bucket of a rate limit key.
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken is the server-side record of an issued refresh token. Every
+// token belongs to a family started by a login; each refresh uses up the
+// presented token and adds its successor to the same family.
+type RefreshToken struct {
+	ID        string
+	Family    string
+	Login     string
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is a signed-in device. It starts with a login, shares its id with
+// the refresh token family and tracks the ids (jti) of the latest tokens
+// issued to it, so ending the session can revoke them.
+type Session struct {
+	ID             string
+	Login          string
+	CreatedAt      time.Time
+	LastSeenAt     time.Time
+	ExpiresAt      time.Time
+	UserAgent      string
+	IP             string
+	AccessTokenID  string
+	RefreshTokenID string
+}
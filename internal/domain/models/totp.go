@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// TOTP is the authenticator app secret of a user. It only guards logins once
+// the user has confirmed it with a valid code.
+type TOTP struct {
+	Login     string
+	Secret    string
+	Confirmed bool
+	// LastUsedStep is the time step of the last accepted code; codes from it
+	// and earlier steps are refused so that a code works only once.
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// TOTPEnrollment is what an authenticator app needs to add a TOTP secret.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+	QRCode []byte
+}
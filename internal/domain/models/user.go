@@ -1,6 +1,70 @@
 package models
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+	// RoleDomainAdmin manages the plain users of its own domain only.
+	RoleDomainAdmin = "domain_admin"
+)
+
+// Second factors a domain may enable.
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
 type User struct {
-	Login        string
+	Login string
+	// Address is the primary mail address, normalized, and Domain its
+	// domain, which is the tenant the user belongs to. Both are empty for
+	// users known by their login only.
+	Address string
+	Domain  string
+	// Aliases are further normalized addresses that receive mail for and
+	// log in as the user.
+	Aliases      []string
+	DisplayName  string
 	PasswordHash string
+	// SCRAMSHA256 holds the SCRAM-SHA-256 keys derived from the password in
+	// RFC 5803 form. It is empty until the password is set or used again.
+	SCRAMSHA256 string
+	Role        string
+	Disabled    bool
+}
+
+// Addresses returns the primary address followed by the aliases.
+func (u *User) Addresses() []string {
+	if u.Address == "" {
+		return u.Aliases
+	}
+	return append([]string{u.Address}, u.Aliases...)
+}
+
+// SCRAMCredentials are the keys a SCRAM server stores instead of the
+// password, see RFC 5802.
+type SCRAMCredentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// UserFilter selects a page of users ordered by login. A zero Limit means no
+// limit.
+type UserFilter struct {
+	LoginPrefix string
+	// Domain, if not empty, selects the users of one domain.
+	Domain string
+	Offset int
+	Limit  int
+}
+
+// UserUpdate holds the account attributes an administrator changes; nil
+// fields are left as they are.
+type UserUpdate struct {
+	Role        *string
+	Disabled    *bool
+	Address     *string
+	Aliases     *[]string
+	DisplayName *string
 }
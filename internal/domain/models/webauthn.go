@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+type WebAuthnCredential struct {
+	ID        []byte
+	Login     string
+	Name      string
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+	AAGUID    []byte
+	CreatedAt time.Time
+	// LastUsedAt is zero until the first login with the credential.
+	LastUsedAt time.Time
+}
+
+// WebAuthnRegistration starts a registration ceremony. Options is passed as
+// publicKey to navigator.credentials.create; ChallengeToken has to be sent
+// back with the result.
+type WebAuthnRegistration struct {
+	ChallengeToken string
+	Options        WebAuthnCreationOptions
+}
+
+// WebAuthnLogin starts a login ceremony, see WebAuthnRegistration.
+type WebAuthnLogin struct {
+	ChallengeToken string
+	Options        WebAuthnRequestOptions
+}
+
+// WebAuthnCreationOptions is PublicKeyCredentialCreationOptions with binary
+// members in base64url.
+type WebAuthnCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// WebAuthnRequestOptions is PublicKeyCredentialRequestOptions with binary
+// members in base64url.
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// WebAuthnAttestation is the browser response to a registration.
+type WebAuthnAttestation struct {
+	ClientDataJSON    []byte
+	AttestationObject []byte
+}
+
+// WebAuthnAssertion is the browser response to a login.
+type WebAuthnAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
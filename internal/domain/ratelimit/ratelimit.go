@@ -0,0 +1,227 @@
+// Package ratelimit throttles requests per route with token buckets keyed by
+// client address, login or API client.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/config"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyLogin  = "login"
+	KeyClient = "client"
+
+	cleanupPeriod = 10 * time.Minute
+)
+
+// Rule allows rate requests per second, with bursts of up to burst, to the
+// routes matching route for every distinct key value.
+type Rule struct {
+	Route string
+	Key   string
+	Rate  float64
+	Burst int
+	// FailClosed rejects requests while the storage fails, instead of
+	// letting them through unthrottled.
+	FailClosed bool
+}
+
+func (r Rule) validate() error {
+	switch {
+	case r.Route == "":
+		return fmt.Errorf("rate limit rule without route")
+	case r.Key != KeyIP && r.Key != KeyLogin && r.Key != KeyClient:
+		return fmt.Errorf("rate limit rule for %s has unknown key %q", r.Route, r.Key)
+	case r.Rate <= 0 || r.Burst < 1:
+		return fmt.Errorf("rate limit rule for %s needs a positive rate and burst", r.Route)
+	}
+	return nil
+}
+
+// matches reports whether route is the rule route or, for rules ending in *,
+// starts with it.
+func (r Rule) matches(route string) bool {
+	if prefix := strings.TrimSuffix(r.Route, "*"); prefix != r.Route {
+		return strings.HasPrefix(route, prefix)
+	}
+	return route == r.Route
+}
+
+// keys names the buckets of subject, whose Client has been verified. Logins
+// are whatever the request claims, so requests of a login rule also count
+// against their address: naming a new login every time does not escape the
+// limit. Subjects without the rule key share the buckets of their address.
+func (r Rule) keys(subject models.RateLimitSubject) []string {
+	ip := r.Route + "|" + KeyIP + ":" + subject.IP
+	switch {
+	case r.Key == KeyLogin && subject.Login != "":
+		return []string{r.Route + "|" + KeyLogin + ":" + subject.Login, ip}
+	case r.Key == KeyClient && subject.Client != "":
+		return []string{r.Route + "|" + KeyClient + ":" + subject.Client}
+	}
+	return []string{ip}
+}
+
+// Client is an API client allowed to name itself in rate limited requests
+// from its networks.
+type Client struct {
+	ID       string
+	Networks []*net.IPNet
+}
+
+type Limiter struct {
+	rules   []Rule
+	clients map[string][]*net.IPNet
+	store   ports.RateLimitStorage
+	logger  *zap.SugaredLogger
+}
+
+var _ ports.RateLimiter = (*Limiter)(nil)
+
+// New creates a limiter with the rules and clients in the config. Invalid
+// rules and client networks are logged and left out.
+func New(store ports.RateLimitStorage, logger *zap.SugaredLogger) *Limiter {
+	cfg := config.GetConfig(logger).RateLimit
+	var rules []Rule
+	for _, c := range cfg.Rules {
+		rule := Rule{Route: c.Route, Key: c.Key, Rate: c.Rate, Burst: c.Burst, FailClosed: c.FailClosed}
+		if err := rule.validate(); err != nil {
+			logger.Errorf("%s", err.Error())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	var clients []Client
+	for _, c := range cfg.Clients {
+		client := Client{ID: c.ID}
+		for _, cidr := range c.Networks {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				logger.Errorf("rate limit client %s has invalid network %q", c.ID, cidr)
+				continue
+			}
+			client.Networks = append(client.Networks, network)
+		}
+		clients = append(clients, client)
+	}
+	return newLimiter(store, rules, clients, logger)
+}
+
+func newLimiter(store ports.RateLimitStorage, rules []Rule, clients []Client, logger *zap.SugaredLogger) *Limiter {
+	l := &Limiter{rules: rules, clients: map[string][]*net.IPNet{}, store: store, logger: logger}
+	for _, client := range clients {
+		l.clients[client.ID] = append(l.clients[client.ID], client.Networks...)
+	}
+	return l
+}
+
+// verifiedClient returns the client id of subject if it is a known client
+// sending from one of its networks, and an empty id otherwise: anyone can
+// claim an id, and every new one would get a bucket of its own.
+func (l *Limiter) verifiedClient(subject models.RateLimitSubject) string {
+	ip := net.ParseIP(subject.IP)
+	if ip == nil {
+		return ""
+	}
+	for _, network := range l.clients[subject.Client] {
+		if network.Contains(ip) {
+			return subject.Client
+		}
+	}
+	return ""
+}
+
+func (l *Limiter) annotatedLogger(ctx context.Context) *zap.SugaredLogger {
+	request_id, _ := ctx.Value(utils.CtxKeyRequestIDGet()).(string)
+	method, _ := ctx.Value(utils.CtxKeyMethodGet()).(string)
+	url, _ := ctx.Value(utils.CtxKeyURLGet()).(string)
+
+	return l.logger.With(
+		"request_id", request_id,
+		"method", method,
+		"url", url,
+	)
+}
+
+// Allow takes a token from the bucket of every rule matching route. Storage
+// errors let the request through, so that an unavailable limiter does not
+// take authentication down with it, unless the rule fails closed; the
+// request is then rejected as if its bucket were empty.
+func (l *Limiter) Allow(ctx context.Context, route string, subject models.RateLimitSubject) error {
+	logger := l.annotatedLogger(ctx)
+
+	now := time.Now()
+	verified := subject
+	verified.Client = l.verifiedClient(subject)
+	var wait time.Duration
+	for _, rule := range l.rules {
+		if !rule.matches(route) {
+			continue
+		}
+		for _, key := range rule.keys(verified) {
+			ok, retryAfter, err := l.store.TakeToken(ctx, key, rule.Rate, rule.Burst, now)
+			if err != nil {
+				logger.Errorf("take rate limit token for %s failed: %s", key, err.Error())
+				if !rule.FailClosed {
+					continue
+				}
+				ok, retryAfter = false, time.Duration(float64(time.Second)/rule.Rate)
+			}
+			if !ok && retryAfter > wait {
+				wait = retryAfter
+			}
+		}
+	}
+	if wait > 0 {
+		logger.With(
+			"security_event", "rate_limited",
+			"ip", subject.IP,
+			"login", subject.Login,
+			"client", subject.Client,
+		).Warnf("%s rate limited for %s", route, wait)
+		return &domainerrors.RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Run forgets idle buckets until ctx is done.
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(cleanupPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.deleteIdleBuckets(ctx)
+	}
+}
+
+// deleteIdleBuckets deletes buckets that have refilled completely, which is
+// the same as having none.
+func (l *Limiter) deleteIdleBuckets(ctx context.Context) {
+	var refill time.Duration
+	for _, rule := range l.rules {
+		if d := time.Duration(float64(rule.Burst) / rule.Rate * float64(time.Second)); d > refill {
+			refill = d
+		}
+	}
+	deleted, err := l.store.DeleteRateLimitsBefore(ctx, time.Now().Add(-refill))
+	if err != nil {
+		l.logger.Errorf("idle rate limit buckets cleanup failed: %s", err.Error())
+		return
+	}
+	l.logger.Infof("%d idle rate limit buckets deleted", deleted)
+}
@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/adapters/memory"
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+func TestAllow(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	rules := []Rule{
+		{Route: "/i", Key: KeyIP, Rate: 0.001, Burst: 2},
+		{Route: "/authgrpc.AuthGrpc/*", Key: KeyClient, Rate: 0.001, Burst: 1},
+		{Route: "/login", Key: KeyLogin, Rate: 0.001, Burst: 1},
+	}
+	clients := []Client{
+		{ID: "alice", Networks: []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}},
+		{ID: "bob", Networks: []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}},
+	}
+	alice := models.RateLimitSubject{IP: "10.0.0.1", Client: "alice"}
+	bob := models.RateLimitSubject{IP: "10.0.0.1", Client: "bob"}
+	spoofed := func(client string) models.RateLimitSubject {
+		return models.RateLimitSubject{IP: "192.0.2.1", Client: client}
+	}
+	guess := func(login string) models.RateLimitSubject {
+		return models.RateLimitSubject{IP: "192.0.2.1", Login: login}
+	}
+
+	cases := []struct {
+		name     string
+		requests []models.RateLimitSubject
+		route    string
+		limited  bool
+	}{
+		{name: "within burst", route: "/i", requests: []models.RateLimitSubject{alice, alice}},
+		{name: "burst exceeded", route: "/i", requests: []models.RateLimitSubject{alice, bob, alice}, limited: true},
+		{name: "unmatched route", route: "/register", requests: []models.RateLimitSubject{alice, alice, alice}},
+		{name: "prefix route per client", route: "/authgrpc.AuthGrpc/Validate", requests: []models.RateLimitSubject{alice, bob}},
+		{name: "prefix route exceeded", route: "/authgrpc.AuthGrpc/Validate", requests: []models.RateLimitSubject{alice, alice}, limited: true},
+		{name: "missing client falls back to ip", route: "/authgrpc.AuthGrpc/Login", requests: []models.RateLimitSubject{{IP: "10.0.0.2"}, {IP: "10.0.0.2"}}, limited: true},
+		{name: "unknown clients fall back to ip", route: "/authgrpc.AuthGrpc/Validate", requests: []models.RateLimitSubject{{IP: "10.0.0.2", Client: "x"}, {IP: "10.0.0.2", Client: "y"}}, limited: true},
+		{name: "client outside its networks", route: "/authgrpc.AuthGrpc/Validate", requests: []models.RateLimitSubject{spoofed("alice"), spoofed("bob")}, limited: true},
+		{name: "login per login", route: "/login", requests: []models.RateLimitSubject{{IP: "10.0.0.3", Login: "alice"}, {IP: "10.0.0.4", Login: "alice"}}, limited: true},
+		{name: "rotated logins count per ip", route: "/login", requests: []models.RateLimitSubject{guess("a"), guess("b")}, limited: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := newLimiter(memory.New(logger), rules, clients, logger)
+			var err error
+			for _, subject := range c.requests {
+				err = l.Allow(context.Background(), c.route, subject)
+			}
+			var limited *domainerrors.RateLimitError
+			if c.limited != errors.As(err, &limited) {
+				t.Fatalf("Expected limited %t, but was %v", c.limited, err)
+			}
+			if c.limited && limited.RetryAfter <= 0 {
+				t.Fatalf("Expected retry delay, but was %s", limited.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	cases := []struct {
+		rule  Rule
+		valid bool
+	}{
+		{rule: Rule{Route: "/i", Key: KeyIP, Rate: 1, Burst: 1}, valid: true},
+		{rule: Rule{Key: KeyIP, Rate: 1, Burst: 1}},
+		{rule: Rule{Route: "/i", Key: "user", Rate: 1, Burst: 1}},
+		{rule: Rule{Route: "/i", Key: KeyLogin, Rate: 0, Burst: 1}},
+		{rule: Rule{Route: "/i", Key: KeyLogin, Rate: 1, Burst: 0}},
+	}
+	for _, c := range cases {
+		if err := c.rule.validate(); (err == nil) != c.valid {
+			t.Fatalf("Expected %+v valid %t, but was %v", c.rule, c.valid, err)
+		}
+	}
+}
+
+// failingStore is a rate limit backend that is down.
+type failingStore struct {
+	ports.RateLimitStorage
+}
+
+func (failingStore) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	return false, 0, fmt.Errorf("connection refused")
+}
+
+func TestAllowStorageDown(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	rules := []Rule{
+		{Route: "/i", Key: KeyIP, Rate: 1, Burst: 10},
+		{Route: "/login", Key: KeyIP, Rate: 0.5, Burst: 10, FailClosed: true},
+	}
+	l := newLimiter(failingStore{}, rules, nil, logger)
+	subject := models.RateLimitSubject{IP: "192.0.2.1"}
+
+	if err := l.Allow(context.Background(), "/i", subject); err != nil {
+		t.Fatalf("Expected a failing open rule to allow, but was %v", err)
+	}
+	var limited *domainerrors.RateLimitError
+	if err := l.Allow(context.Background(), "/login", subject); !errors.As(err, &limited) || limited.RetryAfter != 2*time.Second {
+		t.Fatalf("Expected a failing closed rule to limit for 2s, but was %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package sasl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+// oauthBearer is OAUTHBEARER of RFC 7628, or the older XOAUTH2 which sends
+// "user=<login>^Aauth=Bearer <token>^A^A". The bearer token is an access
+// token of this service.
+type oauthBearer struct {
+	auth    ports.Auth
+	xoauth2 bool
+	login   string
+	// failed holds the error of a refused token until the client has
+	// acknowledged the error challenge.
+	failed error
+}
+
+type oauthError struct {
+	Status  string `json:"status"`
+	Schemes string `json:"schemes"`
+}
+
+func (m *oauthBearer) Next(ctx context.Context, response []byte) ([]byte, *models.User, error) {
+	if m.failed != nil {
+		return nil, nil, m.failed
+	}
+	if response == nil {
+		return []byte{}, nil, nil
+	}
+	login, token, err := m.parse(string(response))
+	if err != nil {
+		return nil, nil, err
+	}
+	m.login = login
+
+	// The claimed identity may be an address or alias of the token's login,
+	// as with the other mechanisms.
+	user, err := m.auth.Validate(ctx, token)
+	if err == nil && login != "" && m.auth.ResolveLogin(ctx, login) != user.Login {
+		err = fmt.Errorf("token of %s used for %s", user.Login, login)
+	}
+	if err != nil {
+		// Both mechanisms answer with an error challenge that the client
+		// acknowledges before the exchange fails.
+		m.failed = fmt.Errorf("bearer token rejected: %s: %w", err, domainerrors.ErrTokenInvalid)
+		status := "invalid_token"
+		if m.xoauth2 {
+			status = "401"
+		}
+		challenge, _ := json.Marshal(oauthError{Status: status, Schemes: "bearer"})
+		return challenge, nil, nil
+	}
+	if m.login == "" {
+		m.login = user.Login
+	}
+	return nil, user, nil
+}
+
+func (m *oauthBearer) Login() string {
+	return m.login
+}
+
+// parse returns the login, which may be empty with OAUTHBEARER, and the
+// token.
+func (m *oauthBearer) parse(msg string) (string, string, error) {
+	var login string
+	if !m.xoauth2 {
+		// gs2-header: "n,a=<login>," followed by ^A separated key=value pairs.
+		header, rest, ok := strings.Cut(msg, "\x01")
+		parts := strings.Split(header, ",")
+		if !ok || len(parts) != 3 || (parts[0] != "n" && parts[0] != "y") {
+			return "", "", malformed("OAUTHBEARER message without gs2 header")
+		}
+		if parts[1] != "" {
+			if !strings.HasPrefix(parts[1], "a=") {
+				return "", "", malformed("invalid OAUTHBEARER authorization identity")
+			}
+			var err error
+			if login, err = decodeSASLName(strings.TrimPrefix(parts[1], "a=")); err != nil {
+				return "", "", malformed("invalid OAUTHBEARER authorization identity")
+			}
+		}
+		msg = rest
+	}
+	if !strings.HasSuffix(msg, "\x01\x01") {
+		return "", "", malformed("unterminated bearer message")
+	}
+	var token string
+	for _, pair := range strings.Split(strings.TrimSuffix(msg, "\x01\x01"), "\x01") {
+		key, value, _ := strings.Cut(pair, "=")
+		switch key {
+		case "auth":
+			scheme, credentials, ok := strings.Cut(value, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				return "", "", malformed("auth is not a bearer token")
+			}
+			token = strings.TrimSpace(credentials)
+		case "user":
+			if m.xoauth2 {
+				login = value
+			}
+		}
+	}
+	if token == "" {
+		return "", "", malformed("message without bearer token")
+	}
+	if m.xoauth2 && login == "" {
+		return "", "", malformed("XOAUTH2 message without user")
+	}
+	return login, token, nil
+}
@@ -0,0 +1,73 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+// plain is RFC 4616. The authorization identity must be empty or the
+// authentication identity: acting as another user is not supported.
+type plain struct {
+	auth     ports.Auth
+	protocol string
+	login    string
+}
+
+func (m *plain) Next(ctx context.Context, response []byte) ([]byte, *models.User, error) {
+	if response == nil {
+		return []byte{}, nil, nil
+	}
+	parts := bytes.Split(response, []byte{0})
+	if len(parts) != 3 {
+		return nil, nil, malformed("PLAIN response without three parts")
+	}
+	authzid, authcid, password := string(parts[0]), string(parts[1]), string(parts[2])
+	if authcid == "" {
+		return nil, nil, malformed("empty PLAIN authentication identity")
+	}
+	m.login = authcid
+	if authzid != "" && authzid != authcid {
+		return nil, nil, malformed("PLAIN authorization identity %q differs from %q", authzid, authcid)
+	}
+	user, err := m.auth.AuthenticatePlain(ctx, authcid, password, m.protocol)
+	return nil, user, err
+}
+
+func (m *plain) Login() string {
+	return m.login
+}
+
+// login is the obsolete but widespread LOGIN mechanism. Some clients send
+// the user name as initial response.
+type login struct {
+	auth     ports.Auth
+	protocol string
+	step     int
+	login    string
+}
+
+func (m *login) Next(ctx context.Context, response []byte) ([]byte, *models.User, error) {
+	switch {
+	case m.step == 0 && response == nil:
+		m.step = 1
+		return []byte("Username:"), nil, nil
+	case m.step <= 1:
+		m.login = strings.TrimSpace(string(response))
+		if m.login == "" {
+			return nil, nil, malformed("empty LOGIN user name")
+		}
+		m.step = 2
+		return []byte("Password:"), nil, nil
+	default:
+		user, err := m.auth.AuthenticatePlain(ctx, m.login, string(response), m.protocol)
+		return nil, user, err
+	}
+}
+
+func (m *login) Login() string {
+	return m.login
+}
@@ -0,0 +1,66 @@
+// Package sasl implements the server side of the SASL mechanisms used by
+// mail protocols. Credentials are checked with ports.Auth, so every protocol
+// adapter applies the same accounts, app passwords and lockout.
+package sasl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+// Mechanism is one exchange of a SASL mechanism.
+type Mechanism interface {
+	// Next takes a client response, nil if the client sent none, and
+	// returns the next challenge. The exchange ends with an error or with
+	// the authenticated user; the challenge returned with the user, if not
+	// nil, is additional data to send with the success.
+	Next(ctx context.Context, response []byte) ([]byte, *models.User, error)
+	// Login returns the login the client claims, empty until it is known.
+	Login() string
+}
+
+// Info describes a mechanism to clients.
+type Info struct {
+	Name string
+	// Plaintext mechanisms send the password itself and need TLS.
+	Plaintext bool
+	// MutualAuth mechanisms also prove the server to the client.
+	MutualAuth bool
+}
+
+// Mechanisms lists the supported mechanisms, strongest first.
+var Mechanisms = []Info{
+	{Name: "SCRAM-SHA-256", MutualAuth: true},
+	{Name: "OAUTHBEARER"},
+	{Name: "XOAUTH2"},
+	{Name: "PLAIN", Plaintext: true},
+	{Name: "LOGIN", Plaintext: true},
+}
+
+// New starts an exchange of the mechanism name for a client of protocol,
+// such as imap or smtp, which scopes app passwords.
+func New(name string, auth ports.Auth, protocol string) (Mechanism, error) {
+	switch strings.ToUpper(name) {
+	case "PLAIN":
+		return &plain{auth: auth, protocol: protocol}, nil
+	case "LOGIN":
+		return &login{auth: auth, protocol: protocol}, nil
+	case "SCRAM-SHA-256":
+		return &scram{auth: auth, protocol: protocol}, nil
+	case "OAUTHBEARER":
+		return &oauthBearer{auth: auth}, nil
+	case "XOAUTH2":
+		return &oauthBearer{auth: auth, xoauth2: true}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", domainerrors.ErrUnsupported, name)
+	}
+}
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", domainerrors.ErrMalformed, fmt.Sprintf(format, args...))
+}
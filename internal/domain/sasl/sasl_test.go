@@ -0,0 +1,273 @@
+package sasl
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+// fakeAuth knows user with password pencil, the account of RFC 7677, the
+// access token token-of-user and the addresses user@example.com and
+// postmaster@example.com of user.
+type fakeAuth struct {
+	ports.Auth
+	credentials models.SCRAMCredentials
+}
+
+func newFakeAuth(t *testing.T) *fakeAuth {
+	salt, err := base64.StdEncoding.DecodeString("W22ZaJ0SNY7soEsUEjb6gQ==")
+	if err != nil {
+		t.Fatalf("decode salt failed: %s", err)
+	}
+	return &fakeAuth{credentials: DeriveSCRAMCredentials("pencil", salt, 4096)}
+}
+
+func (a *fakeAuth) AuthenticatePlain(ctx context.Context, login, password, protocol string) (*models.User, error) {
+	if login != "user" || password != "pencil" {
+		return nil, fmt.Errorf("invalid password")
+	}
+	return &models.User{Login: login}, nil
+}
+
+func (a *fakeAuth) SCRAMCredentials(ctx context.Context, login string) (*models.SCRAMCredentials, error) {
+	return &a.credentials, nil
+}
+
+func (a *fakeAuth) AuthenticateSCRAM(ctx context.Context, login, protocol string, verify func(models.SCRAMCredentials) bool) (*models.User, error) {
+	if login != "user" || !verify(a.credentials) {
+		return nil, fmt.Errorf("invalid proof")
+	}
+	return &models.User{Login: login}, nil
+}
+
+func (a *fakeAuth) ResolveLogin(ctx context.Context, login string) string {
+	switch strings.ToLower(login) {
+	case "user@example.com", "postmaster@example.com":
+		return "user"
+	}
+	return login
+}
+
+func (a *fakeAuth) Validate(ctx context.Context, token string) (*models.User, error) {
+	if token != "token-of-user" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return &models.User{Login: "user"}, nil
+}
+
+// step is a client response and the expected challenge; done marks the
+// step that authenticates.
+type step struct {
+	response  []byte
+	challenge string
+	done      bool
+}
+
+func run(t *testing.T, mech Mechanism, steps []step) error {
+	t.Helper()
+	for i, s := range steps {
+		challenge, user, err := mech.Next(context.Background(), s.response)
+		if err != nil {
+			return err
+		}
+		if string(challenge) != s.challenge {
+			t.Fatalf("Expected challenge %q in step %d, but was %q", s.challenge, i, challenge)
+		}
+		if (user != nil) != s.done {
+			t.Fatalf("Expected done %v in step %d, but was %v", s.done, i, user != nil)
+		}
+	}
+	return nil
+}
+
+func TestSCRAM(t *testing.T) {
+	defer func(saved func() (string, error)) { newNonce = saved }(newNonce)
+	newNonce = func() (string, error) { return "%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0", nil }
+
+	const (
+		clientFirst = "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"
+		serverFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		final       = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0"
+	)
+	cases := []struct {
+		name  string
+		steps []step
+		err   error
+	}{
+		{
+			name: "RFC 7677 example",
+			steps: []step{
+				{response: []byte(clientFirst), challenge: serverFirst},
+				{response: []byte(final + ",p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="), challenge: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", done: true},
+			},
+		},
+		{
+			name: "wrong proof",
+			steps: []step{
+				{response: []byte(clientFirst), challenge: serverFirst},
+				{response: []byte(final + ",p=AAAAZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")},
+			},
+			err: errors.New("invalid proof"),
+		},
+		{
+			name: "changed nonce",
+			steps: []step{
+				{response: []byte(clientFirst), challenge: serverFirst},
+				{response: []byte("c=biws,r=rOprNGfwEbeRWgbNEkqO,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")},
+			},
+			err: domainerrors.ErrMalformed,
+		},
+		{
+			name:  "channel binding",
+			steps: []step{{response: []byte("p=tls-unique,,n=user,r=rOprNGfwEbeRWgbNEkqO")}},
+			err:   domainerrors.ErrMalformed,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mech, _ := New("SCRAM-SHA-256", newFakeAuth(t), models.ProtocolIMAP)
+			err := run(t, mech, c.steps)
+			if (c.err == nil) != (err == nil) || (c.err == domainerrors.ErrMalformed && !errors.Is(err, c.err)) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestSCRAMCredentials(t *testing.T) {
+	encoded, err := NewSCRAMCredentials("pencil", MinSCRAMIterations)
+	if err != nil {
+		t.Fatalf("Expected no error, but was %s", err)
+	}
+	if _, err := NewSCRAMCredentials("pencil", MinSCRAMIterations-1); err == nil {
+		t.Fatalf("Expected too few iterations to be rejected")
+	}
+	c, err := ParseSCRAMCredentials(encoded)
+	if err != nil {
+		t.Fatalf("Expected no error, but was %s", err)
+	}
+	if again := EncodeSCRAMCredentials(DeriveSCRAMCredentials("pencil", c.Salt, c.Iterations)); again != encoded {
+		t.Fatalf("Expected %s, but was %s", encoded, again)
+	}
+	if _, err := ParseSCRAMCredentials("SCRAM-SHA-256$4096:c2FsdA==$a2V5:a2V5"); err == nil {
+		t.Fatalf("Expected an error for short keys, but was nil")
+	}
+}
+
+func TestPlainAndLogin(t *testing.T) {
+	cases := []struct {
+		name  string
+		mech  string
+		steps []step
+		err   error
+	}{
+		{
+			name:  "PLAIN",
+			mech:  "PLAIN",
+			steps: []step{{response: nil, challenge: ""}, {response: []byte("\x00user\x00pencil"), done: true}},
+		},
+		{
+			name:  "PLAIN acting as another user",
+			mech:  "PLAIN",
+			steps: []step{{response: []byte("admin\x00user\x00pencil")}},
+			err:   domainerrors.ErrMalformed,
+		},
+		{
+			name:  "PLAIN wrong password",
+			mech:  "PLAIN",
+			steps: []step{{response: []byte("\x00user\x00wrong")}},
+			err:   errors.New("invalid password"),
+		},
+		{
+			name: "LOGIN",
+			mech: "LOGIN",
+			steps: []step{
+				{response: nil, challenge: "Username:"},
+				{response: []byte("user"), challenge: "Password:"},
+				{response: []byte("pencil"), done: true},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mech, _ := New(c.mech, newFakeAuth(t), models.ProtocolSMTP)
+			err := run(t, mech, c.steps)
+			if (c.err == nil) != (err == nil) || (c.err == domainerrors.ErrMalformed && !errors.Is(err, c.err)) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestOAuthBearer(t *testing.T) {
+	cases := []struct {
+		name  string
+		mech  string
+		steps []step
+		err   error
+	}{
+		{
+			name:  "OAUTHBEARER",
+			mech:  "OAUTHBEARER",
+			steps: []step{{response: []byte("n,a=user,\x01host=mail.example.com\x01auth=Bearer token-of-user\x01\x01"), done: true}},
+		},
+		{
+			name: "OAUTHBEARER invalid token",
+			mech: "OAUTHBEARER",
+			steps: []step{
+				{response: []byte("n,,\x01auth=Bearer expired\x01\x01"), challenge: `{"status":"invalid_token","schemes":"bearer"}`},
+				{response: []byte("\x01")},
+			},
+			err: domainerrors.ErrTokenInvalid,
+		},
+		{
+			name:  "XOAUTH2",
+			mech:  "XOAUTH2",
+			steps: []step{{response: []byte("user=user\x01auth=Bearer token-of-user\x01\x01"), done: true}},
+		},
+		{
+			name:  "OAUTHBEARER address",
+			mech:  "OAUTHBEARER",
+			steps: []step{{response: []byte("n,a=User@Example.COM,\x01auth=Bearer token-of-user\x01\x01"), done: true}},
+		},
+		{
+			name:  "XOAUTH2 alias",
+			mech:  "XOAUTH2",
+			steps: []step{{response: []byte("user=postmaster@example.com\x01auth=Bearer token-of-user\x01\x01"), done: true}},
+		},
+		{
+			name: "XOAUTH2 token of another user",
+			mech: "XOAUTH2",
+			steps: []step{
+				{response: []byte("user=admin\x01auth=Bearer token-of-user\x01\x01"), challenge: `{"status":"401","schemes":"bearer"}`},
+				{response: []byte{}},
+			},
+			err: domainerrors.ErrTokenInvalid,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mech, _ := New(c.mech, newFakeAuth(t), models.ProtocolIMAP)
+			err := run(t, mech, c.steps)
+			if (c.err == nil) != (err == nil) || (c.err != nil && !errors.Is(err, c.err)) {
+				t.Fatalf("Expected %v, but was %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if _, err := New("CRAM-MD5", newFakeAuth(t), models.ProtocolIMAP); !errors.Is(err, domainerrors.ErrUnsupported) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrUnsupported, err)
+	}
+}
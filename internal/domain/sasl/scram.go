@@ -0,0 +1,252 @@
+package sasl
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+const (
+	// MinSCRAMIterations is the RFC 7677 minimum and the common client
+	// default.
+	MinSCRAMIterations = 4096
+	scramSaltBytes     = 16
+	scramNonceBytes    = 18
+	scramPrefix        = "SCRAM-SHA-256$"
+)
+
+// newNonce returns the server part of a SCRAM nonce; tests replace it.
+var newNonce = func() (string, error) {
+	buf := make([]byte, scramNonceBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(buf), nil
+}
+
+// NewSCRAMCredentials derives the SCRAM-SHA-256 keys of password with a
+// random salt and iterations rounds of PBKDF2 in the RFC 5803 form
+// SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>. Passwords are
+// used as given, without SASLprep.
+func NewSCRAMCredentials(password string, iterations int) (string, error) {
+	if iterations < MinSCRAMIterations {
+		return "", fmt.Errorf("at least %d SCRAM iterations required", MinSCRAMIterations)
+	}
+	salt := make([]byte, scramSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return EncodeSCRAMCredentials(DeriveSCRAMCredentials(password, salt, iterations)), nil
+}
+
+func DeriveSCRAMCredentials(password string, salt []byte, iterations int) models.SCRAMCredentials {
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return models.SCRAMCredentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  hmacSHA256(salted, "Server Key"),
+	}
+}
+
+func EncodeSCRAMCredentials(c models.SCRAMCredentials) string {
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("%s%d:%s$%s:%s", scramPrefix, c.Iterations, b64(c.Salt), b64(c.StoredKey), b64(c.ServerKey))
+}
+
+func ParseSCRAMCredentials(encoded string) (*models.SCRAMCredentials, error) {
+	if !strings.HasPrefix(encoded, scramPrefix) {
+		return nil, fmt.Errorf("not SCRAM-SHA-256 credentials")
+	}
+	params, keys, ok := strings.Cut(strings.TrimPrefix(encoded, scramPrefix), "$")
+	iterations, salt, ok1 := strings.Cut(params, ":")
+	storedKey, serverKey, ok2 := strings.Cut(keys, ":")
+	if !ok || !ok1 || !ok2 {
+		return nil, fmt.Errorf("malformed SCRAM-SHA-256 credentials")
+	}
+	var (
+		c   models.SCRAMCredentials
+		err error
+	)
+	if c.Iterations, err = strconv.Atoi(iterations); err != nil || c.Iterations <= 0 {
+		return nil, fmt.Errorf("malformed SCRAM-SHA-256 iteration count")
+	}
+	for _, field := range []struct {
+		dst *[]byte
+		src string
+	}{{&c.Salt, salt}, {&c.StoredKey, storedKey}, {&c.ServerKey, serverKey}} {
+		if *field.dst, err = base64.StdEncoding.DecodeString(field.src); err != nil {
+			return nil, fmt.Errorf("malformed SCRAM-SHA-256 credentials: %s", err)
+		}
+	}
+	if len(c.StoredKey) != sha256.Size || len(c.ServerKey) != sha256.Size {
+		return nil, fmt.Errorf("malformed SCRAM-SHA-256 key length")
+	}
+	return &c, nil
+}
+
+func hmacSHA256(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// scram is SCRAM-SHA-256 of RFC 5802 and RFC 7677 without channel binding.
+type scram struct {
+	auth            ports.Auth
+	protocol        string
+	step            int
+	login           string
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+}
+
+func (m *scram) Next(ctx context.Context, response []byte) ([]byte, *models.User, error) {
+	switch m.step {
+	case 0:
+		if response == nil {
+			return []byte{}, nil, nil
+		}
+		m.step = 1
+		return m.clientFirst(ctx, string(response))
+	case 1:
+		m.step = 2
+		return m.clientFinal(ctx, string(response))
+	default:
+		return nil, nil, malformed("SCRAM exchange is over")
+	}
+}
+
+func (m *scram) Login() string {
+	return m.login
+}
+
+// clientFirst reads "n,[a=<authzid>],n=<user>,r=<nonce>" and answers with the
+// salt and iteration count.
+func (m *scram) clientFirst(ctx context.Context, msg string) ([]byte, *models.User, error) {
+	parts := strings.SplitN(msg, ",", 3)
+	if len(parts) != 3 {
+		return nil, nil, malformed("short SCRAM client-first message")
+	}
+	switch parts[0] {
+	case "n", "y":
+	default:
+		return nil, nil, malformed("SCRAM channel binding %q is not supported", parts[0])
+	}
+	m.gs2Header = parts[0] + "," + parts[1] + ","
+	m.clientFirstBare = parts[2]
+
+	if strings.HasPrefix(m.clientFirstBare, "m=") {
+		return nil, nil, malformed("SCRAM extension m is not supported")
+	}
+	attrs := strings.Split(m.clientFirstBare, ",")
+	if len(attrs) < 2 || !strings.HasPrefix(attrs[0], "n=") || !strings.HasPrefix(attrs[1], "r=") {
+		return nil, nil, malformed("SCRAM client-first message without user or nonce")
+	}
+	login, err := decodeSASLName(strings.TrimPrefix(attrs[0], "n="))
+	if err != nil || login == "" {
+		return nil, nil, malformed("invalid SCRAM user name")
+	}
+	m.login = login
+	if authzid := parts[1]; authzid != "" {
+		authzid, err := decodeSASLName(strings.TrimPrefix(authzid, "a="))
+		if err != nil || !strings.HasPrefix(parts[1], "a=") || authzid != login {
+			return nil, nil, malformed("SCRAM authorization identity differs from %q", login)
+		}
+	}
+	clientNonce := strings.TrimPrefix(attrs[1], "r=")
+	if clientNonce == "" {
+		return nil, nil, malformed("empty SCRAM client nonce")
+	}
+
+	credentials, err := m.auth.SCRAMCredentials(ctx, login)
+	if err != nil {
+		return nil, nil, err
+	}
+	serverNonce, err := newNonce()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate SCRAM nonce failed: %s", err)
+	}
+	m.nonce = clientNonce + serverNonce
+	m.serverFirst = fmt.Sprintf("r=%s,s=%s,i=%d", m.nonce, base64.StdEncoding.EncodeToString(credentials.Salt), credentials.Iterations)
+	return []byte(m.serverFirst), nil, nil
+}
+
+// clientFinal checks "c=<gs2 header>,r=<nonce>,p=<proof>" and answers with
+// the server signature, which proves that the server knows the keys too.
+func (m *scram) clientFinal(ctx context.Context, msg string) ([]byte, *models.User, error) {
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return nil, nil, malformed("SCRAM client-final message without proof")
+	}
+	withoutProof := msg[:i]
+	proof, err := base64.StdEncoding.DecodeString(msg[i+len(",p="):])
+	if err != nil {
+		return nil, nil, malformed("invalid SCRAM proof encoding")
+	}
+	attrs := strings.Split(withoutProof, ",")
+	if len(attrs) < 2 || attrs[0] != "c="+base64.StdEncoding.EncodeToString([]byte(m.gs2Header)) {
+		return nil, nil, malformed("SCRAM channel binding differs from the client-first message")
+	}
+	if attrs[1] != "r="+m.nonce {
+		return nil, nil, malformed("SCRAM nonce differs from the server-first message")
+	}
+
+	authMessage := m.clientFirstBare + "," + m.serverFirst + "," + withoutProof
+	var serverSignature []byte
+	user, err := m.auth.AuthenticateSCRAM(ctx, m.login, m.protocol, func(c models.SCRAMCredentials) bool {
+		clientSignature := hmacSHA256(c.StoredKey, authMessage)
+		if len(proof) != len(clientSignature) {
+			return false
+		}
+		clientKey := make([]byte, len(proof))
+		for i := range proof {
+			clientKey[i] = proof[i] ^ clientSignature[i]
+		}
+		storedKey := sha256.Sum256(clientKey)
+		if !hmac.Equal(storedKey[:], c.StoredKey) {
+			return false
+		}
+		serverSignature = hmacSHA256(c.ServerKey, authMessage)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), user, nil
+}
+
+// decodeSASLName reverses the =2C and =3D escaping of user names.
+func decodeSASLName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '=' {
+			b.WriteByte(name[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(name[i:], "=2C"):
+			b.WriteByte(',')
+		case strings.HasPrefix(name[i:], "=3D"):
+			b.WriteByte('=')
+		default:
+			return "", fmt.Errorf("invalid escape in %q", name)
+		}
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,17 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type AppPasswordStorage interface {
+	CreateAppPassword(ctx context.Context, password *models.AppPassword) error
+	ListAppPasswords(ctx context.Context, login string) ([]models.AppPassword, error)
+	// UseAppPassword sets the last use of the password. It returns
+	// errors.ErrNotFound if the password was revoked meanwhile.
+	UseAppPassword(ctx context.Context, id string, usedAt time.Time) error
+	DeleteAppPassword(ctx context.Context, login, id string) error
+}
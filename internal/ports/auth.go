@@ -10,5 +10,43 @@ type Auth interface {
 	// Info(ctx context.Context, login string) (*models.User, error)
 	Validate(ctx context.Context, access_token string) (*models.User, error)
 	Login(ctx context.Context, login, password string) (models.TokenPair, error)
+	LoginMFA(ctx context.Context, challengeToken, code string) (models.TokenPair, error)
+	Register(ctx context.Context, login, password string) (*models.User, error)
 	ValidateAndRefresh(ctx context.Context, tokens *models.TokenPair) (*models.TokenPair, string, error)
+	Logout(ctx context.Context, tokens *models.TokenPair) error
+	Sessions(ctx context.Context, login string) ([]models.Session, error)
+	RevokeSession(ctx context.Context, login, id string) error
+	RevokeSessions(ctx context.Context, login string) (int, error)
+	JWKS(ctx context.Context) models.JWKSet
+
+	EnrollTOTP(ctx context.Context, login string) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, login, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, login, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, login, code string) ([]string, error)
+	RecoveryCodesLeft(ctx context.Context, login string) (int, error)
+
+	BeginWebAuthnRegistration(ctx context.Context, login string) (*models.WebAuthnRegistration, error)
+	FinishWebAuthnRegistration(ctx context.Context, login, challengeToken, name string, attestation models.WebAuthnAttestation) (*models.WebAuthnCredential, error)
+	BeginWebAuthnLogin(ctx context.Context, login string) (*models.WebAuthnLogin, error)
+	FinishWebAuthnLogin(ctx context.Context, challengeToken string, assertion models.WebAuthnAssertion) (models.TokenPair, error)
+	WebAuthnCredentials(ctx context.Context, login string) ([]models.WebAuthnCredential, error)
+	DeleteWebAuthnCredential(ctx context.Context, login string, id []byte) error
+
+	AuthenticatePlain(ctx context.Context, login, password, protocol string) (*models.User, error)
+	SCRAMCredentials(ctx context.Context, login string) (*models.SCRAMCredentials, error)
+	AuthenticateSCRAM(ctx context.Context, login, protocol string, verify func(models.SCRAMCredentials) bool) (*models.User, error)
+	CreateAppPassword(ctx context.Context, login, name string, scopes []string) (*models.AppPassword, string, error)
+	AppPasswords(ctx context.Context, login string) ([]models.AppPassword, error)
+	RevokeAppPassword(ctx context.Context, login, id string) error
+	CanSendAs(ctx context.Context, login, sender string) error
+	ResolveLogin(ctx context.Context, login string) string
+
+	ValidateRole(ctx context.Context, accessToken string, roles ...string) (*models.User, error)
+	ListUsers(ctx context.Context, actor *models.User, filter models.UserFilter) ([]models.User, int, error)
+	GetUser(ctx context.Context, actor *models.User, login string) (*models.User, error)
+	CreateUser(ctx context.Context, actor *models.User, login, password, role string) (*models.User, error)
+	UpdateUser(ctx context.Context, actor *models.User, login string, update models.UserUpdate) (*models.User, error)
+	ResetPassword(ctx context.Context, actor *models.User, login, password string) (string, error)
+	DeleteUser(ctx context.Context, actor *models.User, login string) error
+	UnlockLogin(ctx context.Context, actor *models.User, login string) error
 }
@@ -0,0 +1,18 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type LoginAttemptStorage interface {
+	// RecordLoginFailure atomically increments the failure count of key and
+	// returns it. A count whose last failure is older than resetAfter starts
+	// over.
+	RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAfter time.Duration) (*models.LoginFailures, error)
+	GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+	DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,26 @@
+package ports
+
+import (
+	"context"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type MFAStorage interface {
+	GetTOTP(ctx context.Context, login string) (*models.TOTP, error)
+	// SaveTOTP creates or replaces the TOTP secret of totp.Login.
+	SaveTOTP(ctx context.Context, totp *models.TOTP) error
+	DeleteTOTP(ctx context.Context, login string) error
+	// UseTOTPStep atomically records step as the last used one. It returns
+	// errors.ErrNotFound if login has no secret or already used step or a
+	// later one.
+	UseTOTPStep(ctx context.Context, login string, step int64) error
+
+	// ReplaceRecoveryCodes replaces the recovery code hashes of login; no
+	// hashes removes them all.
+	ReplaceRecoveryCodes(ctx context.Context, login string, hashes []string) error
+	// UseRecoveryCode atomically removes hash. It returns errors.ErrNotFound
+	// if login has no such unused code.
+	UseRecoveryCode(ctx context.Context, login, hash string) error
+	CountRecoveryCodes(ctx context.Context, login string) (int, error)
+}
@@ -0,0 +1,16 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+type RateLimitStorage interface {
+	// TakeToken atomically takes one token from the bucket of key, which
+	// refills at rate tokens per second up to burst. When the bucket is empty
+	// it reports false and the time until the next token.
+	TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error)
+	// DeleteRateLimitsBefore forgets buckets untouched since before. A
+	// forgotten bucket starts over full.
+	DeleteRateLimitsBefore(ctx context.Context, before time.Time) (int64, error)
+}
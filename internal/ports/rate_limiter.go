@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"context"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type RateLimiter interface {
+	// Allow returns a *errors.RateLimitError if a request of subject to route
+	// exceeds one of the configured limits.
+	Allow(ctx context.Context, route string, subject models.RateLimitSubject) error
+}
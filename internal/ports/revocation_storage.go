@@ -0,0 +1,14 @@
+package ports
+
+import (
+	"context"
+	"time"
+)
+
+// RevocationStorage is the list of token ids (jti) rejected before their
+// natural expiry. Entries only need to be kept until expiresAt.
+type RevocationStorage interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpiredRevocations(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,562 @@
+// Package storagetest is the conformance suite every storage adapter must
+// pass. Adapter tests call the suites with a constructor returning an empty
+// (or, for users, seeded) storage.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	domainerrors "gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/errors"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/ports"
+)
+
+// now is truncated so that stores with coarser time precision round-trip it.
+func now() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// UserStorage checks ports.UserStorage. Read-only stores may answer Create
+// and Delete with errors.ErrReadOnly; the write checks are skipped then.
+func UserStorage(t *testing.T, open func(t *testing.T, users ...models.User) ports.UserStorage) {
+	ctx := context.Background()
+	seed := []models.User{
+		{Login: "alice", Address: "alice@example.com", Domain: "example.com", Aliases: []string{"postmaster@example.com"}, DisplayName: "Alice", PasswordHash: "h1", Role: models.RoleUser},
+		{Login: "alfred", PasswordHash: "h2", Role: models.RoleUser},
+		{Login: "bob", PasswordHash: "h3", Role: models.RoleAdmin},
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		db := open(t, seed...)
+		user, err := db.Get(ctx, "bob")
+		if err != nil || !reflect.DeepEqual(*user, seed[2]) {
+			t.Fatalf("Expected %v, but was %v, %v", seed[2], user, err)
+		}
+		if _, err := db.Get(ctx, "carol"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+	})
+
+	t.Run("GetByAddress", func(t *testing.T) {
+		db := open(t, seed...)
+		for _, address := range []string{"alice@example.com", "postmaster@example.com"} {
+			user, err := db.GetByAddress(ctx, address)
+			if err != nil || !reflect.DeepEqual(*user, seed[0]) {
+				t.Fatalf("Expected %v for %s, but was %v, %v", seed[0], address, user, err)
+			}
+		}
+		if _, err := db.GetByAddress(ctx, "bob@example.com"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		db := open(t, seed...)
+		cases := []struct {
+			filter models.UserFilter
+			logins []string
+		}{
+			{filter: models.UserFilter{}, logins: []string{"alfred", "alice", "bob"}},
+			{filter: models.UserFilter{LoginPrefix: "al"}, logins: []string{"alfred", "alice"}},
+			{filter: models.UserFilter{Domain: "example.com"}, logins: []string{"alice"}},
+			{filter: models.UserFilter{LoginPrefix: "b", Domain: "example.com"}, logins: []string{}},
+			{filter: models.UserFilter{Offset: 1, Limit: 1}, logins: []string{"alice"}},
+			{filter: models.UserFilter{Offset: 5}, logins: []string{}},
+		}
+		for _, c := range cases {
+			users, err := db.List(ctx, c.filter)
+			if err != nil {
+				t.Fatalf("list failed: %s", err)
+			}
+			if !sameLogins(users, c.logins) {
+				t.Fatalf("Expected %v for %+v, but was %v", c.logins, c.filter, users)
+			}
+		}
+		if count, err := db.Count(ctx, models.UserFilter{LoginPrefix: "al", Limit: 1}); err != nil || count != 2 {
+			t.Fatalf("Expected 2 users, but was %d, %v", count, err)
+		}
+		if count, err := db.Count(ctx, models.UserFilter{Domain: "example.com"}); err != nil || count != 1 {
+			t.Fatalf("Expected 1 user, but was %d, %v", count, err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		db := open(t, seed...)
+		updated := models.User{
+			Login: "alice", Address: "alice@example.org", Domain: "example.org", Aliases: []string{"a@example.org", "al@example.org"},
+			DisplayName: "Alice B.", PasswordHash: "new", SCRAMSHA256: "SCRAM-SHA-256$4096:c2FsdA==$a2V5:a2V5", Role: models.RoleAdmin, Disabled: true,
+		}
+		if err := db.Update(ctx, &updated); err != nil {
+			t.Fatalf("update failed: %s", err)
+		}
+		if user, _ := db.Get(ctx, "alice"); user == nil || !reflect.DeepEqual(*user, updated) {
+			t.Fatalf("Expected %v, but was %v", updated, user)
+		}
+		if err := db.Update(ctx, &models.User{Login: "carol", PasswordHash: "h"}); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+		for _, taken := range []models.User{
+			{Login: "bob", Address: "al@example.org", Domain: "example.org", PasswordHash: "h3", Role: models.RoleAdmin},
+			{Login: "bob", Aliases: []string{"alice@example.org"}, PasswordHash: "h3", Role: models.RoleAdmin},
+		} {
+			if err := db.Update(ctx, &taken); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+				t.Fatalf("Expected %v for taken addresses %v, but was %v", domainerrors.ErrAlreadyExists, taken.Addresses(), err)
+			}
+		}
+		if user, err := db.GetByAddress(ctx, "al@example.org"); err != nil || user.Login != "alice" {
+			t.Fatalf("Expected alice, but was %v, %v", user, err)
+		}
+		if _, err := db.GetByAddress(ctx, "postmaster@example.com"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected a removed alias to be free, but was %v", err)
+		}
+	})
+
+	t.Run("CreateDelete", func(t *testing.T) {
+		db := open(t, seed...)
+		err := db.Create(ctx, &models.User{Login: "carol", PasswordHash: "h4"})
+		if errors.Is(err, domainerrors.ErrReadOnly) {
+			t.Skip("read-only storage")
+		}
+		if err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+		if err := db.Create(ctx, &models.User{Login: "carol", PasswordHash: "h5"}); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrAlreadyExists, err)
+		}
+		for _, taken := range []models.User{
+			{Login: "dave", Address: "alice@example.com", Domain: "example.com", PasswordHash: "h6"},
+			{Login: "dave", Address: "postmaster@example.com", Domain: "example.com", PasswordHash: "h6"},
+			{Login: "dave", Aliases: []string{"dave@example.com", "alice@example.com"}, PasswordHash: "h6"},
+		} {
+			if err := db.Create(ctx, &taken); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+				t.Fatalf("Expected %v for taken addresses %v, but was %v", domainerrors.ErrAlreadyExists, taken.Addresses(), err)
+			}
+		}
+		if _, err := db.Get(ctx, "dave"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected no user dave, but was %v", err)
+		}
+		if user, err := db.Get(ctx, "carol"); err != nil || user.PasswordHash != "h4" {
+			t.Fatalf("Expected created user, but was %v, %v", user, err)
+		}
+		if err := db.Delete(ctx, "carol"); err != nil {
+			t.Fatalf("delete failed: %s", err)
+		}
+		if err := db.Delete(ctx, "carol"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+	})
+}
+
+// TokenStorage checks ports.TokenStorage.
+func TokenStorage(t *testing.T, open func(t *testing.T) ports.TokenStorage) {
+	ctx := context.Background()
+
+	t.Run("Use", func(t *testing.T) {
+		db := open(t)
+		token := models.RefreshToken{ID: "t1", Family: "f1", Login: "alice", ExpiresAt: now().Add(time.Hour)}
+		if err := db.CreateRefreshToken(ctx, &token); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+		used, err := db.UseRefreshToken(ctx, "t1")
+		if err != nil || used.ID != "t1" || used.Family != "f1" || !used.Used {
+			t.Fatalf("Expected used token, but was %v, %v", used, err)
+		}
+		if _, err := db.UseRefreshToken(ctx, "t1"); !errors.Is(err, domainerrors.ErrTokenReused) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenReused, err)
+		}
+		if _, err := db.UseRefreshToken(ctx, "unknown"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+	})
+
+	t.Run("RevokeFamily", func(t *testing.T) {
+		db := open(t)
+		for _, token := range []models.RefreshToken{
+			{ID: "t1", Family: "f1", Login: "alice", ExpiresAt: now().Add(time.Hour)},
+			{ID: "t2", Family: "f2", Login: "alice", ExpiresAt: now().Add(time.Hour)},
+		} {
+			if err := db.CreateRefreshToken(ctx, &token); err != nil {
+				t.Fatalf("create failed: %s", err)
+			}
+		}
+		if err := db.RevokeTokenFamily(ctx, "f1"); err != nil {
+			t.Fatalf("revoke failed: %s", err)
+		}
+		if _, err := db.UseRefreshToken(ctx, "t1"); !errors.Is(err, domainerrors.ErrTokenRevoked) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrTokenRevoked, err)
+		}
+		if token, err := db.GetRefreshToken(ctx, "t2"); err != nil || token.Revoked {
+			t.Fatalf("Expected other family untouched, but was %v, %v", token, err)
+		}
+	})
+
+	t.Run("DeleteExpired", func(t *testing.T) {
+		db := open(t)
+		for _, token := range []models.RefreshToken{
+			{ID: "t1", Family: "f1", Login: "alice", ExpiresAt: now().Add(-time.Hour)},
+			{ID: "t2", Family: "f1", Login: "alice", ExpiresAt: now().Add(time.Hour)},
+		} {
+			if err := db.CreateRefreshToken(ctx, &token); err != nil {
+				t.Fatalf("create failed: %s", err)
+			}
+		}
+		if n, err := db.DeleteExpiredRefreshTokens(ctx, now()); err != nil || n != 1 {
+			t.Fatalf("Expected 1 deleted token, but was %d, %v", n, err)
+		}
+		if _, err := db.GetRefreshToken(ctx, "t1"); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+		}
+	})
+}
+
+// RevocationStorage checks ports.RevocationStorage.
+func RevocationStorage(t *testing.T, open func(t *testing.T) ports.RevocationStorage) {
+	ctx := context.Background()
+	db := open(t)
+
+	if err := db.Revoke(ctx, "j1", now().Add(-time.Hour)); err != nil {
+		t.Fatalf("revoke failed: %s", err)
+	}
+	if err := db.Revoke(ctx, "j2", now().Add(time.Hour)); err != nil {
+		t.Fatalf("revoke failed: %s", err)
+	}
+	if err := db.Revoke(ctx, "j2", now().Add(time.Hour)); err != nil {
+		t.Fatalf("Expected repeated revoke to succeed, but was %v", err)
+	}
+	if revoked, err := db.IsRevoked(ctx, "j2"); err != nil || !revoked {
+		t.Fatalf("Expected j2 revoked, but was %v, %v", revoked, err)
+	}
+	if revoked, err := db.IsRevoked(ctx, "j3"); err != nil || revoked {
+		t.Fatalf("Expected j3 not revoked, but was %v, %v", revoked, err)
+	}
+	if n, err := db.DeleteExpiredRevocations(ctx, now()); err != nil || n != 1 {
+		t.Fatalf("Expected 1 deleted revocation, but was %d, %v", n, err)
+	}
+}
+
+// SessionStorage checks ports.SessionStorage.
+func SessionStorage(t *testing.T, open func(t *testing.T) ports.SessionStorage) {
+	ctx := context.Background()
+	db := open(t)
+	start := now()
+
+	sessions := []models.Session{
+		{ID: "s1", Login: "alice", CreatedAt: start, LastSeenAt: start, ExpiresAt: start.Add(time.Hour), UserAgent: "curl", IP: "10.0.0.1"},
+		{ID: "s2", Login: "alice", CreatedAt: start, LastSeenAt: start.Add(time.Minute), ExpiresAt: start.Add(-time.Hour)},
+		{ID: "s3", Login: "bob", CreatedAt: start, LastSeenAt: start, ExpiresAt: start.Add(time.Hour)},
+	}
+	for _, session := range sessions {
+		if err := db.CreateSession(ctx, &session); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+	}
+
+	got, err := db.GetSession(ctx, "s1")
+	if err != nil || !sameSession(*got, sessions[0]) {
+		t.Fatalf("Expected %v, but was %v, %v", sessions[0], got, err)
+	}
+	if _, err := db.GetSession(ctx, "unknown"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+
+	updated := sessions[0]
+	updated.LastSeenAt = start.Add(2 * time.Minute)
+	updated.AccessTokenID, updated.RefreshTokenID = "a1", "r1"
+	if err := db.UpdateSession(ctx, &updated); err != nil {
+		t.Fatalf("update failed: %s", err)
+	}
+	if err := db.UpdateSession(ctx, &models.Session{ID: "unknown"}); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+
+	list, err := db.ListSessions(ctx, "alice")
+	if err != nil || len(list) != 2 || !sameSession(list[0], updated) || list[1].ID != "s2" {
+		t.Fatalf("Expected most recent session first, but was %v, %v", list, err)
+	}
+
+	if n, err := db.DeleteExpiredSessions(ctx, start); err != nil || n != 1 {
+		t.Fatalf("Expected 1 deleted session, but was %d, %v", n, err)
+	}
+	if err := db.DeleteSession(ctx, "s3"); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if err := db.DeleteSession(ctx, "s3"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+}
+
+// LoginAttemptStorage checks ports.LoginAttemptStorage.
+func LoginAttemptStorage(t *testing.T, open func(t *testing.T) ports.LoginAttemptStorage) {
+	ctx := context.Background()
+	db := open(t)
+	start := now()
+
+	for i := 1; i <= 3; i++ {
+		failures, err := db.RecordLoginFailure(ctx, "login:alice", start.Add(time.Duration(i)*time.Second), time.Minute)
+		if err != nil || failures.Count != i {
+			t.Fatalf("Expected %d failures, but was %v, %v", i, failures, err)
+		}
+	}
+	failures, err := db.GetLoginFailures(ctx, "login:alice")
+	if err != nil || failures.Count != 3 || !failures.LastFailureAt.Equal(start.Add(3*time.Second)) {
+		t.Fatalf("Expected 3 failures, but was %v, %v", failures, err)
+	}
+	// Failures older than resetAfter are forgotten.
+	failures, err = db.RecordLoginFailure(ctx, "login:alice", start.Add(time.Hour), time.Minute)
+	if err != nil || failures.Count != 1 {
+		t.Fatalf("Expected count to start over, but was %v, %v", failures, err)
+	}
+
+	if err := db.ResetLoginFailures(ctx, "login:alice"); err != nil {
+		t.Fatalf("reset failed: %s", err)
+	}
+	if _, err := db.GetLoginFailures(ctx, "login:alice"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+
+	if _, err := db.RecordLoginFailure(ctx, "ip:10.0.0.1", start, time.Minute); err != nil {
+		t.Fatalf("record failed: %s", err)
+	}
+	if _, err := db.RecordLoginFailure(ctx, "ip:10.0.0.2", start.Add(time.Hour), time.Minute); err != nil {
+		t.Fatalf("record failed: %s", err)
+	}
+	if n, err := db.DeleteLoginFailuresBefore(ctx, start.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("Expected 1 deleted counter, but was %d, %v", n, err)
+	}
+}
+
+// RateLimitStorage checks ports.RateLimitStorage.
+func RateLimitStorage(t *testing.T, open func(t *testing.T) ports.RateLimitStorage) {
+	ctx := context.Background()
+	db := open(t)
+	start := now()
+
+	// A new bucket is full: burst requests pass, the next one waits for a
+	// token refilled at one per second.
+	for i := 0; i < 2; i++ {
+		if ok, _, err := db.TakeToken(ctx, "ip:10.0.0.1", 1, 2, start); err != nil || !ok {
+			t.Fatalf("Expected token %d, but was %t, %v", i+1, ok, err)
+		}
+	}
+	ok, retryAfter, err := db.TakeToken(ctx, "ip:10.0.0.1", 1, 2, start)
+	if err != nil || ok || retryAfter <= 0 || retryAfter > time.Second {
+		t.Fatalf("Expected refusal for up to 1s, but was %t, %s, %v", ok, retryAfter, err)
+	}
+	// Other keys have their own bucket.
+	if ok, _, err := db.TakeToken(ctx, "ip:10.0.0.2", 1, 2, start); err != nil || !ok {
+		t.Fatalf("Expected token for another key, but was %t, %v", ok, err)
+	}
+	if ok, _, err := db.TakeToken(ctx, "ip:10.0.0.1", 1, 2, start.Add(time.Second)); err != nil || !ok {
+		t.Fatalf("Expected refilled token, but was %t, %v", ok, err)
+	}
+	// Refills stop at burst.
+	for i := 0; i < 3; i++ {
+		ok, _, err := db.TakeToken(ctx, "ip:10.0.0.1", 1, 2, start.Add(time.Hour))
+		if err != nil || ok != (i < 2) {
+			t.Fatalf("Expected token %d to be %t, but was %t, %v", i+1, i < 2, ok, err)
+		}
+	}
+
+	if n, err := db.DeleteRateLimitsBefore(ctx, start.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("Expected 1 deleted bucket, but was %d, %v", n, err)
+	}
+}
+
+// MFAStorage checks ports.MFAStorage.
+func MFAStorage(t *testing.T, open func(t *testing.T) ports.MFAStorage) {
+	ctx := context.Background()
+	db := open(t)
+
+	if _, err := db.GetTOTP(ctx, "alice"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	totp := models.TOTP{Login: "alice", Secret: "JBSWY3DPEHPK3PXP", CreatedAt: now()}
+	if err := db.SaveTOTP(ctx, &totp); err != nil {
+		t.Fatalf("save failed: %s", err)
+	}
+	totp.Confirmed = true
+	if err := db.SaveTOTP(ctx, &totp); err != nil {
+		t.Fatalf("replace failed: %s", err)
+	}
+	got, err := db.GetTOTP(ctx, "alice")
+	if err != nil || got.Secret != totp.Secret || !got.Confirmed || !got.CreatedAt.Equal(totp.CreatedAt) {
+		t.Fatalf("Expected %v, but was %v, %v", totp, got, err)
+	}
+
+	// A step is used once and never before a later one.
+	if err := db.UseTOTPStep(ctx, "alice", 100); err != nil {
+		t.Fatalf("use step failed: %s", err)
+	}
+	for _, step := range []int64{100, 99} {
+		if err := db.UseTOTPStep(ctx, "alice", step); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected step %d to be refused, but was %v", step, err)
+		}
+	}
+	if got, err := db.GetTOTP(ctx, "alice"); err != nil || got.LastUsedStep != 100 {
+		t.Fatalf("Expected last used step 100, but was %v, %v", got, err)
+	}
+	if err := db.UseTOTPStep(ctx, "bob", 100); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+
+	if err := db.DeleteTOTP(ctx, "alice"); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if err := db.DeleteTOTP(ctx, "alice"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+
+	// Recovery codes are used once and replaced as a batch.
+	if err := db.ReplaceRecoveryCodes(ctx, "alice", []string{"h1", "h2", "h3"}); err != nil {
+		t.Fatalf("replace recovery codes failed: %s", err)
+	}
+	if err := db.UseRecoveryCode(ctx, "alice", "h2"); err != nil {
+		t.Fatalf("use recovery code failed: %s", err)
+	}
+	for _, c := range []struct{ login, hash string }{{"alice", "h2"}, {"alice", "h4"}, {"bob", "h1"}} {
+		if err := db.UseRecoveryCode(ctx, c.login, c.hash); !errors.Is(err, domainerrors.ErrNotFound) {
+			t.Fatalf("Expected %s of %s to be refused, but was %v", c.hash, c.login, err)
+		}
+	}
+	if n, err := db.CountRecoveryCodes(ctx, "alice"); err != nil || n != 2 {
+		t.Fatalf("Expected 2 recovery codes, but was %d, %v", n, err)
+	}
+	if err := db.ReplaceRecoveryCodes(ctx, "alice", []string{"h5"}); err != nil {
+		t.Fatalf("replace recovery codes failed: %s", err)
+	}
+	if err := db.UseRecoveryCode(ctx, "alice", "h1"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected replaced code to be refused, but was %v", err)
+	}
+	if err := db.ReplaceRecoveryCodes(ctx, "alice", nil); err != nil {
+		t.Fatalf("remove recovery codes failed: %s", err)
+	}
+	if n, err := db.CountRecoveryCodes(ctx, "alice"); err != nil || n != 0 {
+		t.Fatalf("Expected no recovery codes, but was %d, %v", n, err)
+	}
+}
+
+// WebAuthnStorage checks ports.WebAuthnStorage.
+func WebAuthnStorage(t *testing.T, open func(t *testing.T) ports.WebAuthnStorage) {
+	ctx := context.Background()
+	db := open(t)
+	start := now()
+
+	first := models.WebAuthnCredential{ID: []byte{1, 2, 3}, Login: "alice", Name: "laptop",
+		PublicKey: []byte{0xa5}, SignCount: 7, AAGUID: make([]byte, 16), CreatedAt: start}
+	second := models.WebAuthnCredential{ID: []byte{4, 5, 6}, Login: "alice", Name: "phone",
+		PublicKey: []byte{0xa5}, AAGUID: make([]byte, 16), CreatedAt: start.Add(time.Second)}
+	for _, credential := range []models.WebAuthnCredential{first, second} {
+		if err := db.CreateWebAuthnCredential(ctx, &credential); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+	}
+	taken := first
+	taken.Login = "bob"
+	if err := db.CreateWebAuthnCredential(ctx, &taken); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrAlreadyExists, err)
+	}
+
+	got, err := db.GetWebAuthnCredential(ctx, first.ID)
+	if err != nil || got.Login != "alice" || got.Name != "laptop" || got.SignCount != 7 || !got.LastUsedAt.IsZero() {
+		t.Fatalf("Expected %v, but was %v, %v", first, got, err)
+	}
+	list, err := db.ListWebAuthnCredentials(ctx, "alice")
+	if err != nil || len(list) != 2 || list[0].Name != "laptop" || list[1].Name != "phone" {
+		t.Fatalf("Expected laptop and phone, but was %v, %v", list, err)
+	}
+
+	// The sign count only moves from the value the caller has seen.
+	if err := db.UseWebAuthnCredential(ctx, first.ID, 7, 8, start.Add(time.Minute)); err != nil {
+		t.Fatalf("use failed: %s", err)
+	}
+	if err := db.UseWebAuthnCredential(ctx, first.ID, 7, 9, start.Add(time.Minute)); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	got, err = db.GetWebAuthnCredential(ctx, first.ID)
+	if err != nil || got.SignCount != 8 || !got.LastUsedAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("Expected sign count 8, but was %v, %v", got, err)
+	}
+
+	if err := db.DeleteWebAuthnCredential(ctx, "bob", first.ID); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	if err := db.DeleteWebAuthnCredential(ctx, "alice", first.ID); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if _, err := db.GetWebAuthnCredential(ctx, first.ID); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+}
+
+func AppPasswordStorage(t *testing.T, open func(t *testing.T) ports.AppPasswordStorage) {
+	ctx := context.Background()
+	db := open(t)
+	start := now()
+
+	first := models.AppPassword{ID: "p1", Login: "alice", Name: "thunderbird", Hash: "h1",
+		Scopes: []string{models.ProtocolIMAP, models.ProtocolSMTP}, CreatedAt: start}
+	second := models.AppPassword{ID: "p2", Login: "alice", Name: "phone", Hash: "h2",
+		Scopes: []string{models.ProtocolPOP3}, CreatedAt: start.Add(time.Second)}
+	for _, password := range []models.AppPassword{first, second} {
+		if err := db.CreateAppPassword(ctx, &password); err != nil {
+			t.Fatalf("create failed: %s", err)
+		}
+	}
+	if err := db.CreateAppPassword(ctx, &first); !errors.Is(err, domainerrors.ErrAlreadyExists) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrAlreadyExists, err)
+	}
+
+	list, err := db.ListAppPasswords(ctx, "alice")
+	if err != nil || len(list) != 2 || list[0].Name != "thunderbird" || list[1].Name != "phone" {
+		t.Fatalf("Expected thunderbird and phone, but was %v, %v", list, err)
+	}
+	if list[0].Hash != "h1" || len(list[0].Scopes) != 2 || !list[0].HasScope(models.ProtocolSMTP) || !list[0].LastUsedAt.IsZero() {
+		t.Fatalf("Expected %v, but was %v", first, list[0])
+	}
+	if list, _ := db.ListAppPasswords(ctx, "bob"); len(list) != 0 {
+		t.Fatalf("Expected no passwords for bob, but was %v", list)
+	}
+
+	if err := db.UseAppPassword(ctx, "p1", start.Add(time.Minute)); err != nil {
+		t.Fatalf("use failed: %s", err)
+	}
+	if err := db.UseAppPassword(ctx, "p3", start.Add(time.Minute)); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	list, _ = db.ListAppPasswords(ctx, "alice")
+	if !list[0].LastUsedAt.Equal(start.Add(time.Minute)) {
+		t.Fatalf("Expected last use %v, but was %v", start.Add(time.Minute), list[0].LastUsedAt)
+	}
+
+	if err := db.DeleteAppPassword(ctx, "bob", "p1"); !errors.Is(err, domainerrors.ErrNotFound) {
+		t.Fatalf("Expected %v, but was %v", domainerrors.ErrNotFound, err)
+	}
+	if err := db.DeleteAppPassword(ctx, "alice", "p1"); err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	if list, _ := db.ListAppPasswords(ctx, "alice"); len(list) != 1 || list[0].ID != "p2" {
+		t.Fatalf("Expected only p2, but was %v", list)
+	}
+}
+
+func sameLogins(users []models.User, logins []string) bool {
+	if len(users) != len(logins) {
+		return false
+	}
+	for i := range users {
+		if users[i].Login != logins[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSession(a, b models.Session) bool {
+	return a.ID == b.ID && a.Login == b.Login && a.UserAgent == b.UserAgent && a.IP == b.IP &&
+		a.AccessTokenID == b.AccessTokenID && a.RefreshTokenID == b.RefreshTokenID &&
+		a.CreatedAt.Equal(b.CreatedAt) && a.LastSeenAt.Equal(b.LastSeenAt) && a.ExpiresAt.Equal(b.ExpiresAt)
+}
@@ -0,0 +1,19 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type TokenStorage interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// UseRefreshToken marks the token as used and returns it. Marking is
+	// atomic: of concurrent callers only one succeeds, the others get
+	// errors.ErrTokenReused together with the token.
+	UseRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, id string) (*models.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, family string) error
+	DeleteExpiredRefreshTokens(ctx context.Context, now time.Time) (int64, error)
+}
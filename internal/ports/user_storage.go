@@ -8,4 +8,14 @@ import (
 
 type UserStorage interface {
 	Get(ctx context.Context, login string) (*models.User, error)
+	// GetByAddress returns the user whose primary address or alias is the
+	// normalized address.
+	GetByAddress(ctx context.Context, address string) (*models.User, error)
+	List(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+	// Count returns the number of users matching filter, ignoring its
+	// Offset and Limit.
+	Count(ctx context.Context, filter models.UserFilter) (int, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, login string) error
 }
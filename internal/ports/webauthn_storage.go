@@ -0,0 +1,21 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/sukharnikov.aa/mail-service-auth/internal/domain/models"
+)
+
+type WebAuthnStorage interface {
+	// CreateWebAuthnCredential returns errors.ErrAlreadyExists if the
+	// credential id is registered already, by anyone.
+	CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, id []byte) (*models.WebAuthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, login string) ([]models.WebAuthnCredential, error)
+	// UseWebAuthnCredential atomically replaces the sign count old with new
+	// and sets the last use. It returns errors.ErrNotFound if the credential
+	// is gone or its count is no longer old.
+	UseWebAuthnCredential(ctx context.Context, id []byte, old, new uint32, usedAt time.Time) error
+	DeleteWebAuthnCredential(ctx context.Context, login string, id []byte) error
+}
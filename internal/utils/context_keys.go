@@ -17,3 +17,15 @@ type ctxKeyURL struct{}
 func CtxKeyURLGet() ctxKeyURL {
 	return ctxKeyURL{}
 }
+
+type ctxKeyUserAgent struct{}
+
+func CtxKeyUserAgentGet() ctxKeyUserAgent {
+	return ctxKeyUserAgent{}
+}
+
+type ctxKeyRemoteIP struct{}
+
+func CtxKeyRemoteIPGet() ctxKeyRemoteIP {
+	return ctxKeyRemoteIP{}
+}
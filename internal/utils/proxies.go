@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TrustedProxies lists the networks of reverse proxies whose forwarded
+// client addresses are believed. Forwarded addresses from anyone else are
+// ignored, since clients can send whatever headers they like.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses CIDR networks and single addresses.
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	proxies := TrustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client behind the connection from
+// peer, an address without port. Unless peer is a trusted proxy, that is
+// peer itself. Otherwise the X-Forwarded-For values are walked from the
+// right, skipping further trusted proxies, so that addresses a client put
+// in front of the chain are never reached.
+func (p TrustedProxies) ClientIP(peer string, forwarded []string) string {
+	client := peer
+	if !p.trusted(client) {
+		return client
+	}
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		client = hop
+		if !p.trusted(client) {
+			break
+		}
+	}
+	return client
+}
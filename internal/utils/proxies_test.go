@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("parse failed: %s", err)
+	}
+
+	cases := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		ip        string
+	}{
+		{name: "direct", peer: "198.51.100.7", ip: "198.51.100.7"},
+		{name: "spoofed header", peer: "198.51.100.7", forwarded: []string{"203.0.113.1"}, ip: "198.51.100.7"},
+		{name: "trusted proxy", peer: "10.1.2.3", forwarded: []string{"203.0.113.1"}, ip: "203.0.113.1"},
+		{name: "single trusted address", peer: "192.0.2.1", forwarded: []string{"203.0.113.1"}, ip: "203.0.113.1"},
+		{name: "injected hops", peer: "10.1.2.3", forwarded: []string{"1.1.1.1, 2.2.2.2", "203.0.113.1, 10.9.9.9"}, ip: "203.0.113.1"},
+		{name: "no header", peer: "10.1.2.3", ip: "10.1.2.3"},
+		{name: "garbage", peer: "10.1.2.3", forwarded: []string{"unknown"}, ip: "10.1.2.3"},
+		{name: "ipv6", peer: "2001:db8::1", forwarded: []string{"2001:db9::5"}, ip: "2001:db9::5"},
+	}
+	for _, c := range cases {
+		if ip := proxies.ClientIP(c.peer, c.forwarded); ip != c.ip {
+			t.Fatalf("%s: Expected %s, but was %s", c.name, c.ip, ip)
+		}
+	}
+
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("Expected invalid network to be rejected")
+	}
+}
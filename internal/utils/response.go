@@ -5,7 +5,7 @@ import (
 	"net/http"
 )
 
-func ResponseJSON(w http.ResponseWriter, code int, data map[string]string) {
+func ResponseJSON(w http.ResponseWriter, code int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	resp, _ := json.Marshal(data)
 	w.WriteHeader(code)
@@ -2,7 +2,7 @@
 // versions:
 // - protoc-gen-go-grpc v1.2.0
 // - protoc             v3.13.0
-// source: proto/mail-service-auth-grpc.proto
+// source: mail-service-auth-grpc.proto
 
 package authgrpc
 
@@ -23,6 +23,12 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type AuthGrpcClient interface {
 	Validate(ctx context.Context, in *TokenPair, opts ...grpc.CallOption) (*AuthResponse, error)
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*TokenPair, error)
+	LoginMFA(ctx context.Context, in *LoginMFARequest, opts ...grpc.CallOption) (*TokenPair, error)
+	ListSessions(ctx context.Context, in *SessionsRequest, opts ...grpc.CallOption) (*SessionsResponse, error)
+	RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...grpc.CallOption) (*RevokeSessionResponse, error)
+	SaslStep(ctx context.Context, in *SaslStepRequest, opts ...grpc.CallOption) (*SaslStepResponse, error)
 }
 
 type authGrpcClient struct {
@@ -42,11 +48,71 @@ func (c *authGrpcClient) Validate(ctx context.Context, in *TokenPair, opts ...gr
 	return out, nil
 }
 
+func (c *authGrpcClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authGrpcClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*TokenPair, error) {
+	out := new(TokenPair)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/Login", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authGrpcClient) LoginMFA(ctx context.Context, in *LoginMFARequest, opts ...grpc.CallOption) (*TokenPair, error) {
+	out := new(TokenPair)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/LoginMFA", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authGrpcClient) ListSessions(ctx context.Context, in *SessionsRequest, opts ...grpc.CallOption) (*SessionsResponse, error) {
+	out := new(SessionsResponse)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/ListSessions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authGrpcClient) RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...grpc.CallOption) (*RevokeSessionResponse, error) {
+	out := new(RevokeSessionResponse)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/RevokeSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *authGrpcClient) SaslStep(ctx context.Context, in *SaslStepRequest, opts ...grpc.CallOption) (*SaslStepResponse, error) {
+	out := new(SaslStepResponse)
+	err := c.cc.Invoke(ctx, "/authgrpc.AuthGrpc/SaslStep", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AuthGrpcServer is the server API for AuthGrpc service.
 // All implementations must embed UnimplementedAuthGrpcServer
 // for forward compatibility
 type AuthGrpcServer interface {
 	Validate(context.Context, *TokenPair) (*AuthResponse, error)
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	Login(context.Context, *LoginRequest) (*TokenPair, error)
+	LoginMFA(context.Context, *LoginMFARequest) (*TokenPair, error)
+	ListSessions(context.Context, *SessionsRequest) (*SessionsResponse, error)
+	RevokeSession(context.Context, *RevokeSessionRequest) (*RevokeSessionResponse, error)
+	SaslStep(context.Context, *SaslStepRequest) (*SaslStepResponse, error)
 	mustEmbedUnimplementedAuthGrpcServer()
 }
 
@@ -57,6 +123,24 @@ type UnimplementedAuthGrpcServer struct {
 func (UnimplementedAuthGrpcServer) Validate(context.Context, *TokenPair) (*AuthResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Validate not implemented")
 }
+func (UnimplementedAuthGrpcServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedAuthGrpcServer) Login(context.Context, *LoginRequest) (*TokenPair, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedAuthGrpcServer) LoginMFA(context.Context, *LoginMFARequest) (*TokenPair, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LoginMFA not implemented")
+}
+func (UnimplementedAuthGrpcServer) ListSessions(context.Context, *SessionsRequest) (*SessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedAuthGrpcServer) RevokeSession(context.Context, *RevokeSessionRequest) (*RevokeSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RevokeSession not implemented")
+}
+func (UnimplementedAuthGrpcServer) SaslStep(context.Context, *SaslStepRequest) (*SaslStepResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SaslStep not implemented")
+}
 func (UnimplementedAuthGrpcServer) mustEmbedUnimplementedAuthGrpcServer() {}
 
 // UnsafeAuthGrpcServer may be embedded to opt out of forward compatibility for this service.
@@ -88,6 +172,114 @@ func _AuthGrpc_Validate_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AuthGrpc_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthGrpc_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/Login",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthGrpc_LoginMFA_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginMFARequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).LoginMFA(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/LoginMFA",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).LoginMFA(ctx, req.(*LoginMFARequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthGrpc_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/ListSessions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).ListSessions(ctx, req.(*SessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthGrpc_RevokeSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RevokeSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).RevokeSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/RevokeSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).RevokeSession(ctx, req.(*RevokeSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AuthGrpc_SaslStep_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaslStepRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AuthGrpcServer).SaslStep(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/authgrpc.AuthGrpc/SaslStep",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AuthGrpcServer).SaslStep(ctx, req.(*SaslStepRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AuthGrpc_ServiceDesc is the grpc.ServiceDesc for AuthGrpc service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -99,7 +291,31 @@ var AuthGrpc_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Validate",
 			Handler:    _AuthGrpc_Validate_Handler,
 		},
+		{
+			MethodName: "Register",
+			Handler:    _AuthGrpc_Register_Handler,
+		},
+		{
+			MethodName: "Login",
+			Handler:    _AuthGrpc_Login_Handler,
+		},
+		{
+			MethodName: "LoginMFA",
+			Handler:    _AuthGrpc_LoginMFA_Handler,
+		},
+		{
+			MethodName: "ListSessions",
+			Handler:    _AuthGrpc_ListSessions_Handler,
+		},
+		{
+			MethodName: "RevokeSession",
+			Handler:    _AuthGrpc_RevokeSession_Handler,
+		},
+		{
+			MethodName: "SaslStep",
+			Handler:    _AuthGrpc_SaslStep_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
-	Metadata: "proto/mail-service-auth-grpc.proto",
+	Metadata: "mail-service-auth-grpc.proto",
 }